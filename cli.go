@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"diffbreak/pkg"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/go-github/v83/github"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Exit codes returned by the command-line mode.
+const (
+	exitOK        = 0
+	exitError     = 1
+	exitUsage     = 2
+	exitRiskGated = 3
+)
+
+// runAnalyzeCommand runs `diffbreak analyze` and returns the process exit code.
+func runAnalyzeCommand(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("analyze", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	defaults := pkg.DefaultConfig()
+	configPath := fs.String("config", os.Getenv("DIFFBREAK_CONFIG"), "YAML config file (see README); flags take precedence over it")
+	repoURL := fs.String("repo", "", "GitHub repository URL (https://github.com/owner/repo)")
+	packageName := fs.String("package", "", "package name to resolve instead of --repo (e.g. express)")
+	ecosystem := fs.String("ecosystem", "", "ecosystem of --package: go, npm, pypi or crates")
+	fromTag := fs.String("from", "", "tag (or package version with --package) currently in use")
+	toTag := fs.String("to", "", "tag (or package version with --package) to upgrade to")
+	mode := fs.String("mode", "fast", "analysis mode: fast, deep or thorough")
+	maxReleases := fs.Int("max-releases", 0, "maximum number of releases to include (1..60, default 30)")
+	format := fs.String("format", "json", "output format: json, markdown or sarif")
+	artifact := fs.String("artifact", "", "repository-relative file SARIF results are anchored to (e.g. go.mod)")
+	failOn := fs.String("fail-on", "", "exit with code 3 when the risk level is at or above this level (low, medium, high)")
+	llm := fs.String("llm", defaults.Ollama.URL, "Ollama base URL")
+	ghToken := fs.String("github", "", "GitHub access token (defaults to github.token, then $GITHUB_TOKEN)")
+	timeout := fs.Duration("timeout", defaults.Timeouts.Analyze, "overall analysis timeout")
+	verbose := fs.Bool("v", false, "log pipeline progress to stderr")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if *format != "json" && *format != "markdown" && *format != "sarif" {
+		fmt.Fprintln(stderr, "format must be 'json', 'markdown' or 'sarif'")
+		return exitUsage
+	}
+	if *failOn != "" && pkg.RiskLevelRank(*failOn) == 0 {
+		fmt.Fprintln(stderr, "fail-on must be 'low', 'medium' or 'high'")
+		return exitUsage
+	}
+	cfg, err := loadCLIConfig(fs, *configPath, func(cfg *pkg.Config, flag string) {
+		switch flag {
+		case "llm":
+			cfg.Ollama.URL = *llm
+		case "github":
+			cfg.GitHub.Token = *ghToken
+		case "timeout":
+			cfg.Timeouts.Analyze = *timeout
+		}
+	})
+	if err != nil {
+		fmt.Fprintf(stderr, "loading config: %v\n", err)
+		return exitUsage
+	}
+
+	logger := newCLILogger(*verbose)
+	defer func() {
+		_ = logger.Sync()
+	}()
+
+	analyzer, err := newCLIAnalyzer(cfg, logger)
+	if err != nil {
+		fmt.Fprintf(stderr, "setting up GitHub authentication: %v\n", err)
+		return exitError
+	}
+
+	req := pkg.AnalyzeRequest{
+		RepoUrl:   *repoURL,
+		Package:   *packageName,
+		Ecosystem: *ecosystem,
+		FromTag:   *fromTag,
+		ToTag:     *toTag,
+		Mode:      *mode,
+	}
+	req.Limits.MaxReleases = *maxReleases
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeouts.Analyze)
+	defer cancel()
+
+	resp, err := analyzer.Analyze(ctx, req)
+	if err != nil {
+		var reqErr *pkg.RequestError
+		if errors.As(err, &reqErr) {
+			fmt.Fprintln(stderr, reqErr.Message)
+			return exitUsage
+		}
+		fmt.Fprintf(stderr, "analysis failed: %v\n", err)
+		return exitError
+	}
+
+	if err := writeAnalysis(stdout, resp, *format, *artifact); err != nil {
+		fmt.Fprintf(stderr, "writing output: %v\n", err)
+		return exitError
+	}
+
+	if *failOn != "" && pkg.RiskLevelRank(resp.Risk.Level) >= pkg.RiskLevelRank(*failOn) {
+		fmt.Fprintf(stderr, "risk level %s meets --fail-on %s\n", resp.Risk.Level, *failOn)
+		return exitRiskGated
+	}
+	return exitOK
+}
+
+// runBulkCommand runs `diffbreak bulk` and returns the process exit code.
+func runBulkCommand(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("bulk", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	defaults := pkg.DefaultConfig()
+	configPath := fs.String("config", os.Getenv("DIFFBREAK_CONFIG"), "YAML config file (see README); flags take precedence over it")
+	manifest := fs.String("manifest", "", "manifest format: gomod, gosum or package-lock")
+	beforePath := fs.String("before", "", "manifest before the dependency bump")
+	afterPath := fs.String("after", "", "manifest after the dependency bump")
+	diffPath := fs.String("diff", "", "unified diff of the manifest (instead of --before/--after, - for stdin)")
+	mode := fs.String("mode", "fast", "analysis mode: fast, deep or thorough")
+	maxReleases := fs.Int("max-releases", 0, "maximum number of releases to include per dependency")
+	concurrency := fs.Int("concurrency", 0, "number of analyses to run in parallel (default 4, max 8)")
+	failOn := fs.String("fail-on", "", "exit with code 3 when any dependency's risk level is at or above this level")
+	llm := fs.String("llm", defaults.Ollama.URL, "Ollama base URL")
+	ghToken := fs.String("github", "", "GitHub access token (defaults to github.token, then $GITHUB_TOKEN)")
+	timeout := fs.Duration("timeout", defaults.Timeouts.Bulk, "overall timeout")
+	verbose := fs.Bool("v", false, "log pipeline progress to stderr")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *failOn != "" && pkg.RiskLevelRank(*failOn) == 0 {
+		fmt.Fprintln(stderr, "fail-on must be 'low', 'medium' or 'high'")
+		return exitUsage
+	}
+	cfg, err := loadCLIConfig(fs, *configPath, func(cfg *pkg.Config, flag string) {
+		switch flag {
+		case "llm":
+			cfg.Ollama.URL = *llm
+		case "github":
+			cfg.GitHub.Token = *ghToken
+		case "timeout":
+			cfg.Timeouts.Bulk = *timeout
+		}
+	})
+	if err != nil {
+		fmt.Fprintf(stderr, "loading config: %v\n", err)
+		return exitUsage
+	}
+
+	req := pkg.BulkAnalyzeRequest{Format: *manifest, Mode: *mode}
+	req.Limits.MaxReleases = *maxReleases
+	req.Limits.Concurrency = *concurrency
+
+	if *diffPath != "" {
+		req.Diff, err = readInputFile(*diffPath)
+	} else {
+		req.Before, err = readInputFile(*beforePath)
+		if err == nil {
+			req.After, err = readInputFile(*afterPath)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "reading manifest: %v\n", err)
+		return exitUsage
+	}
+
+	logger := newCLILogger(*verbose)
+	defer func() {
+		_ = logger.Sync()
+	}()
+
+	analyzer, err := newCLIAnalyzer(cfg, logger)
+	if err != nil {
+		fmt.Fprintf(stderr, "setting up GitHub authentication: %v\n", err)
+		return exitError
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeouts.Bulk)
+	defer cancel()
+
+	resp, err := analyzer.BulkAnalyze(ctx, req)
+	if err != nil {
+		var reqErr *pkg.RequestError
+		if errors.As(err, &reqErr) {
+			fmt.Fprintln(stderr, reqErr.Message)
+			return exitUsage
+		}
+		fmt.Fprintf(stderr, "bulk analysis failed: %v\n", err)
+		return exitError
+	}
+
+	if err := writeIndentedJSON(stdout, resp); err != nil {
+		fmt.Fprintf(stderr, "writing output: %v\n", err)
+		return exitError
+	}
+
+	if *failOn != "" && pkg.RiskLevelRank(resp.Summary.HighestRisk) >= pkg.RiskLevelRank(*failOn) {
+		fmt.Fprintf(stderr, "highest risk level %s meets --fail-on %s\n", resp.Summary.HighestRisk, *failOn)
+		return exitRiskGated
+	}
+	if resp.Summary.Failed > 0 {
+		return exitError
+	}
+	return exitOK
+}
+
+// runDetectCommand runs `diffbreak detect` and returns the process exit code.
+func runDetectCommand(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("detect", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	defaults := pkg.DefaultConfig()
+	configPath := fs.String("config", os.Getenv("DIFFBREAK_CONFIG"), "YAML config file (see README); flags take precedence over it")
+	repoURL := fs.String("repo", "", "GitHub repository URL (https://github.com/owner/repo)")
+	packageName := fs.String("package", "", "package name to resolve instead of --repo")
+	ecosystem := fs.String("ecosystem", "", "ecosystem of --package: go, npm, pypi or crates")
+	ghToken := fs.String("github", "", "GitHub access token (defaults to github.token, then $GITHUB_TOKEN)")
+	timeout := fs.Duration("timeout", defaults.Timeouts.Detect, "overall timeout")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	cfg, err := loadCLIConfig(fs, *configPath, func(cfg *pkg.Config, flag string) {
+		switch flag {
+		case "github":
+			cfg.GitHub.Token = *ghToken
+		case "timeout":
+			cfg.Timeouts.Detect = *timeout
+		}
+	})
+	if err != nil {
+		fmt.Fprintf(stderr, "loading config: %v\n", err)
+		return exitUsage
+	}
+
+	gh, err := newGitHubClient(cfg.GitHub, nil)
+	if err != nil {
+		fmt.Fprintf(stderr, "setting up GitHub authentication: %v\n", err)
+		return exitError
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeouts.Detect)
+	defer cancel()
+
+	var resolved *pkg.ResolvedPackage
+	if *repoURL == "" && *packageName != "" {
+		pkgInfo, err := pkg.NewPackageResolver(nil, gh).Resolve(ctx, *ecosystem, *packageName)
+		if err != nil {
+			fmt.Fprintf(stderr, "resolving package: %v\n", err)
+			if errors.Is(err, pkg.ErrUnsupportedEcosystem) {
+				return exitUsage
+			}
+			return exitError
+		}
+		resolved = &pkgInfo
+		*repoURL = pkgInfo.RepoUrl
+	}
+
+	resp, err := pkg.Detect(ctx, gh, *repoURL)
+	if err != nil {
+		if errors.Is(err, pkg.ErrInvalidRepoURL) {
+			fmt.Fprintln(stderr, "invalid repo URL")
+			return exitUsage
+		}
+		fmt.Fprintf(stderr, "detect failed: %v\n", err)
+		return exitError
+	}
+	resp.Package = resolved
+
+	if err := writeIndentedJSON(stdout, resp); err != nil {
+		fmt.Fprintf(stderr, "writing output: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+func writeAnalysis(w io.Writer, resp pkg.AnalyzeResponse, format, artifact string) error {
+	switch format {
+	case "markdown":
+		_, err := io.WriteString(w, pkg.RenderMarkdown(resp))
+		return err
+	case "sarif":
+		return writeIndentedJSON(w, pkg.RenderSARIF(resp, pkg.SARIFOptions{ArtifactURI: artifact}))
+	default:
+		return writeIndentedJSON(w, resp)
+	}
+}
+
+func readInputFile(path string) (string, error) {
+	if path == "" {
+		return "", errors.New("path is required")
+	}
+	if path == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		return string(data), err
+	}
+	data, err := os.ReadFile(path)
+	return string(data), err
+}
+
+func writeIndentedJSON(w io.Writer, payload any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(payload)
+}
+
+// loadCLIConfig loads the config file and DIFFBREAK_* environment variables like the server
+// does; apply copies each flag set on the command line over them. Without any GitHub
+// credentials, $GITHUB_TOKEN is used.
+func loadCLIConfig(fs *flag.FlagSet, path string, apply func(cfg *pkg.Config, flag string)) (pkg.Config, error) {
+	cfg, err := pkg.LoadConfig(path)
+	if err != nil {
+		return pkg.Config{}, err
+	}
+	fs.Visit(func(f *flag.Flag) { apply(&cfg, f.Name) })
+	if cfg.GitHub.Token == "" && len(cfg.GitHub.Tokens) == 0 && cfg.GitHub.App.ID == 0 {
+		cfg.GitHub.Token = os.Getenv("GITHUB_TOKEN")
+	}
+	// Nothing is served, so the server's write timeout does not have to outlast --timeout, and
+	// the only caller is whoever runs the command with the configured credentials.
+	cfg.Server.WriteTimeout = 0
+	cfg.GitHub.App.AnonymousAccess = true
+	if err := cfg.Validate(); err != nil {
+		return pkg.Config{}, err
+	}
+	return cfg, nil
+}
+
+func newCLIAnalyzer(cfg pkg.Config, logger *zap.Logger) (*pkg.Analyzer, error) {
+	gh, err := newGitHubClient(cfg.GitHub, logger)
+	if err != nil {
+		return nil, err
+	}
+	return &pkg.Analyzer{
+		GitHub:        gh,
+		OllamaBaseURL: cfg.Ollama.URL,
+		Logger:        logger,
+		Resolver:      pkg.NewPackageResolver(nil, gh),
+		Config:        &cfg,
+	}, nil
+}
+
+// newGitHubClient builds the GitHub client authenticated as configured in cfg.
+func newGitHubClient(cfg pkg.GitHubConfig, logger *zap.Logger) (*github.Client, error) {
+	httpClient, err := pkg.NewGitHubHTTPClient(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	return github.NewClient(httpClient), nil
+}
+
+// newCLILogger logs to stderr so stdout stays machine-readable; only warnings and errors
+// are shown unless verbose is set.
+func newCLILogger(verbose bool) *zap.Logger {
+	cfg := zap.NewProductionConfig()
+	cfg.OutputPaths = []string{"stderr"}
+	if !verbose {
+		cfg.Level = zap.NewAtomicLevelAt(zapcore.WarnLevel)
+	}
+	logger, err := cfg.Build()
+	if err != nil {
+		return zap.NewNop()
+	}
+	return logger
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// modelResponse is a minimal model answer at the given risk level.
+func modelResponse(level string, score int) string {
+	return fmt.Sprintf(`{"risk":{"level":%q,"score":%d,"confidence":"high","reasons":[]},"summary":{"highlights":["Minor update"],"grouped":[]},"breakers":[],"behaviorChanges":[],"upgradeSteps":[],"evidence":[],"meta":{}}`, level, score)
+}
+
+// redirectTransport sends api.github.com requests to a test server.
+type redirectTransport struct {
+	target *url.URL
+	base   http.RoundTripper
+}
+
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host == "api.github.com" {
+		req = req.Clone(req.Context())
+		req.URL.Scheme = t.target.Scheme
+		req.URL.Host = t.target.Host
+	}
+	return t.base.RoundTrip(req)
+}
+
+// newFakeGitHub serves octo/hello with tags v1.0.0 and v1.1.0 and an empty comparison between
+// them, and redirects the default transport, which the CLI's GitHub client builds on, to it.
+func newFakeGitHub(t *testing.T) {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"message":"This endpoint requires you to be authenticated."}`))
+	})
+	mux.HandleFunc("/repos/octo/hello/compare/v1.0.0...v1.1.0", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"commits":[],"files":[]}`))
+	})
+	mux.HandleFunc("/repos/octo/hello/releases", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[]`))
+	})
+	mux.HandleFunc("/repos/octo/hello/tags", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"name":"v1.1.0"},{"name":"v1.0.0"}]`))
+	})
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+
+	target, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("parse test server url: %v", err)
+	}
+	base := http.DefaultTransport
+	http.DefaultTransport = redirectTransport{target: target, base: base}
+	t.Cleanup(func() { http.DefaultTransport = base })
+
+	t.Setenv("GITHUB_TOKEN", "")
+	t.Setenv("DIFFBREAK_CONFIG", "")
+}
+
+// newFakeOllama starts a fake Ollama /api/generate that always answers modelResp, or fails
+// when modelResp is empty.
+func newFakeOllama(t *testing.T, modelResp string) string {
+	t.Helper()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if modelResp == "" {
+			http.Error(w, "model crashed", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"response": modelResp, "done": true})
+	}))
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
+
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestRunAnalyzeCommand(t *testing.T) {
+	tests := []struct {
+		name       string
+		model      string
+		args       []string
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{
+			name:       "json",
+			model:      modelResponse("low", 10),
+			args:       []string{"--from", "v1.0.0", "--to", "v1.1.0"},
+			wantCode:   exitOK,
+			wantStdout: `"level": "low"`,
+		},
+		{
+			name:       "markdown",
+			model:      modelResponse("low", 10),
+			args:       []string{"--from", "v1.0.0", "--to", "v1.1.0", "--format", "markdown"},
+			wantCode:   exitOK,
+			wantStdout: "Minor update",
+		},
+		{
+			name:       "sarif",
+			model:      modelResponse("low", 10),
+			args:       []string{"--from", "v1.0.0", "--to", "v1.1.0", "--format", "sarif"},
+			wantCode:   exitOK,
+			wantStdout: `"version": "2.1.0"`,
+		},
+		{
+			name:     "risk below fail-on",
+			model:    modelResponse("low", 10),
+			args:     []string{"--from", "v1.0.0", "--to", "v1.1.0", "--fail-on", "medium"},
+			wantCode: exitOK,
+		},
+		{
+			name:       "risk at fail-on",
+			model:      modelResponse("high", 90),
+			args:       []string{"--from", "v1.0.0", "--to", "v1.1.0", "--fail-on", "high"},
+			wantCode:   exitRiskGated,
+			wantStdout: `"level": "high"`,
+			wantStderr: "risk level high meets --fail-on high",
+		},
+		{
+			name:       "invalid format",
+			args:       []string{"--from", "v1.0.0", "--to", "v1.1.0", "--format", "xml"},
+			wantCode:   exitUsage,
+			wantStderr: "format must be",
+		},
+		{
+			name:       "invalid fail-on",
+			args:       []string{"--from", "v1.0.0", "--to", "v1.1.0", "--fail-on", "severe"},
+			wantCode:   exitUsage,
+			wantStderr: "fail-on must be",
+		},
+		{
+			name:     "unknown flag",
+			args:     []string{"--bogus"},
+			wantCode: exitUsage,
+		},
+		{
+			name:     "missing tags",
+			model:    modelResponse("low", 10),
+			args:     nil,
+			wantCode: exitUsage,
+		},
+		{
+			name:       "missing config file",
+			args:       []string{"--from", "v1.0.0", "--to", "v1.1.0", "--config", filepath.Join(t.TempDir(), "missing.yaml")},
+			wantCode:   exitUsage,
+			wantStderr: "loading config",
+		},
+		{
+			name:       "model failure",
+			args:       []string{"--from", "v1.0.0", "--to", "v1.1.0"},
+			wantCode:   exitError,
+			wantStderr: "analysis failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newFakeGitHub(t)
+			args := append([]string{"--repo", "https://github.com/octo/hello", "--llm", newFakeOllama(t, tt.model)}, tt.args...)
+
+			var stdout, stderr bytes.Buffer
+			code := runAnalyzeCommand(args, &stdout, &stderr)
+			if code != tt.wantCode {
+				t.Fatalf("expected exit code %d, got %d (stderr: %s)", tt.wantCode, code, stderr.String())
+			}
+			if !strings.Contains(stdout.String(), tt.wantStdout) {
+				t.Fatalf("expected %q in stdout, got %s", tt.wantStdout, stdout.String())
+			}
+			if !strings.Contains(stderr.String(), tt.wantStderr) {
+				t.Fatalf("expected %q in stderr, got %s", tt.wantStderr, stderr.String())
+			}
+		})
+	}
+}
+
+func TestRunAnalyzeCommandReadsConfig(t *testing.T) {
+	newFakeGitHub(t)
+	config := writeTestFile(t, "config.yaml", "ollama:\n  url: "+newFakeOllama(t, modelResponse("medium", 50))+"\n")
+
+	var stdout, stderr bytes.Buffer
+	code := runAnalyzeCommand([]string{"--config", config, "--repo", "https://github.com/octo/hello", "--from", "v1.0.0", "--to", "v1.1.0", "--fail-on", "medium"}, &stdout, &stderr)
+	if code != exitRiskGated {
+		t.Fatalf("expected exit code %d from the configured model, got %d (stderr: %s)", exitRiskGated, code, stderr.String())
+	}
+
+	// --llm takes precedence over ollama.url.
+	stdout.Reset()
+	stderr.Reset()
+	code = runAnalyzeCommand([]string{"--config", config, "--llm", newFakeOllama(t, modelResponse("low", 10)), "--repo", "https://github.com/octo/hello", "--from", "v1.0.0", "--to", "v1.1.0", "--fail-on", "medium"}, &stdout, &stderr)
+	if code != exitOK {
+		t.Fatalf("expected exit code %d from the --llm model, got %d (stderr: %s)", exitOK, code, stderr.String())
+	}
+}
+
+func TestRunBulkCommand(t *testing.T) {
+	before := writeTestFile(t, "go.mod.before", "module example.com/app\n\ngo 1.22\n\nrequire github.com/octo/hello v1.0.0\n")
+	after := writeTestFile(t, "go.mod.after", "module example.com/app\n\ngo 1.22\n\nrequire github.com/octo/hello v1.1.0\n")
+
+	tests := []struct {
+		name       string
+		model      string
+		args       []string
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{
+			name:       "analyzes the bump",
+			model:      modelResponse("low", 10),
+			args:       []string{"--manifest", "gomod", "--before", before, "--after", after},
+			wantCode:   exitOK,
+			wantStdout: `"highestRisk": "low"`,
+		},
+		{
+			name:       "risk at fail-on",
+			model:      modelResponse("high", 90),
+			args:       []string{"--manifest", "gomod", "--before", before, "--after", after, "--fail-on", "high"},
+			wantCode:   exitRiskGated,
+			wantStderr: "highest risk level high meets --fail-on high",
+		},
+		{
+			name:       "missing manifest",
+			args:       []string{"--manifest", "gomod", "--before", before},
+			wantCode:   exitUsage,
+			wantStderr: "reading manifest",
+		},
+		{
+			name:       "invalid fail-on",
+			args:       []string{"--manifest", "gomod", "--before", before, "--after", after, "--fail-on", "severe"},
+			wantCode:   exitUsage,
+			wantStderr: "fail-on must be",
+		},
+		{
+			name:       "failed analyses",
+			args:       []string{"--manifest", "gomod", "--before", before, "--after", after},
+			wantCode:   exitError,
+			wantStdout: `"failed": 1`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newFakeGitHub(t)
+			args := append([]string{"--llm", newFakeOllama(t, tt.model)}, tt.args...)
+
+			var stdout, stderr bytes.Buffer
+			code := runBulkCommand(args, &stdout, &stderr)
+			if code != tt.wantCode {
+				t.Fatalf("expected exit code %d, got %d (stderr: %s)", tt.wantCode, code, stderr.String())
+			}
+			if !strings.Contains(stdout.String(), tt.wantStdout) {
+				t.Fatalf("expected %q in stdout, got %s", tt.wantStdout, stdout.String())
+			}
+			if !strings.Contains(stderr.String(), tt.wantStderr) {
+				t.Fatalf("expected %q in stderr, got %s", tt.wantStderr, stderr.String())
+			}
+		})
+	}
+}
+
+func TestRunDetectCommand(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{
+			name:       "lists tags",
+			args:       []string{"--repo", "https://github.com/octo/hello"},
+			wantCode:   exitOK,
+			wantStdout: `"v1.1.0"`,
+		},
+		{
+			name:       "invalid repo URL",
+			args:       []string{"--repo", "https://example.com/octo/hello"},
+			wantCode:   exitUsage,
+			wantStderr: "invalid repo URL",
+		},
+		{
+			name:       "unknown repository",
+			args:       []string{"--repo", "https://github.com/octo/missing"},
+			wantCode:   exitError,
+			wantStderr: "detect failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newFakeGitHub(t)
+
+			var stdout, stderr bytes.Buffer
+			code := runDetectCommand(tt.args, &stdout, &stderr)
+			if code != tt.wantCode {
+				t.Fatalf("expected exit code %d, got %d (stderr: %s)", tt.wantCode, code, stderr.String())
+			}
+			if !strings.Contains(stdout.String(), tt.wantStdout) {
+				t.Fatalf("expected %q in stdout, got %s", tt.wantStdout, stdout.String())
+			}
+			if !strings.Contains(stderr.String(), tt.wantStderr) {
+				t.Fatalf("expected %q in stderr, got %s", tt.wantStderr, stderr.String())
+			}
+		})
+	}
+}
@@ -1,34 +1,126 @@
 package main
 
 import (
+	"context"
 	"diffbreak/pkg"
 	"flag"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"go.uber.org/zap"
-
-	"github.com/google/go-github/v83/github"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
 )
 
 func main() {
+	args := os.Args[1:]
+	if len(args) > 0 {
+		switch args[0] {
+		case "analyze":
+			os.Exit(runAnalyzeCommand(args[1:], os.Stdout, os.Stderr))
+		case "bulk":
+			os.Exit(runBulkCommand(args[1:], os.Stdout, os.Stderr))
+		case "detect":
+			os.Exit(runDetectCommand(args[1:], os.Stdout, os.Stderr))
+		case "serve":
+			args = args[1:]
+		}
+	}
+	serve(args)
+}
+
+// serve runs the HTTP API server.
+func serve(args []string) {
 	logger, _ := zap.NewProduction()
 	defer func() {
 		_ = logger.Sync()
 	}()
 
-	// CLI configuration for Ollama address, HTTP port, and optional GitHub token.
-	llmPtr := flag.String("llm", "http://localhost:11434", "Ollama base URL (e.g. http://localhost:11434)")
-	portPtr := flag.String("port", "8080", "port to listen on")
-	ifacePtr := flag.String("interface", "0.0.0.0", "interface to listen on")
+	// Flags override the config file and DIFFBREAK_* environment variables, so only flags that
+	// were set explicitly are applied; their defaults are the built-in config defaults.
+	defaults := pkg.DefaultConfig()
+	configPtr := flag.String("config", os.Getenv("DIFFBREAK_CONFIG"), "YAML config file (see README); flags take precedence over it")
+	llmPtr := flag.String("llm", defaults.Ollama.URL, "Ollama base URL (e.g. http://localhost:11434)")
+	portPtr := flag.String("port", defaults.Server.Port, "port to listen on")
+	ifacePtr := flag.String("interface", defaults.Server.Interface, "interface to listen on")
 	ghPtr := flag.String("github", "", "GitHub access token to evade rate limits a bit")
-	flag.Parse()
+	watchStorePtr := flag.String("watch-store", "", "JSON file to persist watches in (in-memory when empty)")
+	watchIntervalPtr := flag.Duration("watch-interval", defaults.Watch.Interval, "how often watched repositories are polled for new releases")
+	webhookSecretPtr := flag.String("webhook-secret", "", "GitHub webhook secret; enables /webhooks/github when set")
+	prCommentsPtr := flag.Bool("pr-comments", false, "comment analyses on Dependabot/Renovate pull requests received via /webhooks/github")
+	apiKeysPtr := flag.String("api-keys", "", "JSON file with API keys and quotas; requests are unauthenticated when empty")
+	rateLimitPtr := flag.Float64("rate-limit", defaults.RateLimit.PerMinute, "analysis requests per minute per client (API key or IP); 0 disables")
+	rateBurstPtr := flag.Int("rate-burst", defaults.RateLimit.Burst, "analysis requests a client may make in a burst")
+	trustProxyPtr := flag.Bool("trust-proxy", false, "take client IPs from X-Forwarded-For for rate limiting")
+	modelConcurrencyPtr := flag.Int("model-concurrency", defaults.ModelQueue.Concurrency, "model calls running at once")
+	modelQueuePtr := flag.Int("model-queue", defaults.ModelQueue.MaxQueued, "model calls allowed to wait for a slot before requests are rejected with 503")
+	modelQueueWaitPtr := flag.Duration("model-queue-wait", defaults.ModelQueue.MaxWait, "how long a model call may wait for a slot")
+	resultStorePtr := flag.String("result-store", "", "JSON file to persist webhook-precomputed analyses in (in-memory when empty)")
+	_ = flag.CommandLine.Parse(args)
+
+	cfg, err := pkg.LoadConfig(*configPtr)
+	if err != nil {
+		logger.Fatal("loading config", zap.Error(err))
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "llm":
+			cfg.Ollama.URL = *llmPtr
+		case "port":
+			cfg.Server.Port = *portPtr
+		case "interface":
+			cfg.Server.Interface = *ifacePtr
+		case "github":
+			cfg.GitHub.Token = *ghPtr
+		case "watch-store":
+			cfg.Watch.Store = *watchStorePtr
+		case "watch-interval":
+			cfg.Watch.Interval = *watchIntervalPtr
+		case "webhook-secret":
+			cfg.Webhook.Secret = *webhookSecretPtr
+		case "pr-comments":
+			cfg.Webhook.PRComments = *prCommentsPtr
+		case "api-keys":
+			cfg.Auth.APIKeysFile = *apiKeysPtr
+		case "rate-limit":
+			cfg.RateLimit.PerMinute = *rateLimitPtr
+		case "rate-burst":
+			cfg.RateLimit.Burst = *rateBurstPtr
+		case "trust-proxy":
+			cfg.RateLimit.TrustProxy = *trustProxyPtr
+		case "model-concurrency":
+			cfg.ModelQueue.Concurrency = *modelConcurrencyPtr
+		case "model-queue":
+			cfg.ModelQueue.MaxQueued = *modelQueuePtr
+		case "model-queue-wait":
+			cfg.ModelQueue.MaxWait = *modelQueueWaitPtr
+		case "result-store":
+			cfg.Webhook.ResultStore = *resultStorePtr
+		}
+	})
+	if err := cfg.Validate(); err != nil {
+		logger.Fatal("invalid config", zap.Error(err))
+	}
+
+	shutdownTracing, err := pkg.SetupTracing(context.Background(), cfg.Tracing)
+	if err != nil {
+		logger.Fatal("setting up tracing", zap.Error(err))
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Warn("flushing traces", zap.Error(err))
+		}
+	}()
 
 	// Create GitHub client (optionally authenticated to reduce rate limiting).
-	client := github.NewClient(nil)
-	if *ghPtr != "" {
-		client = github.NewClient(nil).WithAuthToken(*ghPtr)
+	client, err := newGitHubClient(cfg.GitHub, logger)
+	if err != nil {
+		logger.Fatal("setting up GitHub authentication", zap.Error(err))
 	}
 
 	// Use a custom Prometheus registry for app-specific metrics.
@@ -39,12 +131,80 @@ func main() {
 	metricsHandler := promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
 
 	http.Handle("/metrics", metricsHandler)
+
+	resultStore, err := pkg.NewResultStore(cfg.Webhook.ResultStore)
+	if err != nil {
+		logger.Fatal("loading result store", zap.Error(err))
+	}
+
+	var auth *pkg.APIKeyAuth
+	if cfg.Auth.APIKeysFile != "" {
+		auth, err = pkg.LoadAPIKeys(cfg.Auth.APIKeysFile)
+		if err != nil {
+			logger.Fatal("loading api keys", zap.Error(err))
+		}
+	} else {
+		logger.Warn("no API keys configured; the API is open to anyone who can reach it")
+	}
+
+	var limiter *pkg.RateLimiter
+	if cfg.RateLimit.PerMinute > 0 {
+		limiter = pkg.NewRateLimiter(cfg.RateLimit.PerMinute, cfg.RateLimit.Burst)
+		limiter.TrustForwardedFor = cfg.RateLimit.TrustProxy
+	}
+
+	withCORS := func(h http.Handler) http.Handler { return pkg.WithCORSOrigins(cfg.Server.CORSOrigins, h) }
+
 	// Public API endpoints for repo detection and upgrade analysis.
-	http.Handle("/detect", pkg.WithCORS(pkg.WrapHandler("detect", pkg.DetectHandler(client, logger), logger)))
-	http.Handle("/analyze", pkg.WithCORS(pkg.WrapHandler("analyze", pkg.AnalyzeHandler(client, *llmPtr, logger), logger)))
-	err := http.ListenAndServe(*ifacePtr+":"+*portPtr, nil)
+	analyzer := &pkg.Analyzer{
+		GitHub:        client,
+		OllamaBaseURL: cfg.Ollama.URL,
+		Logger:        logger,
+		Resolver:      pkg.NewPackageResolver(nil, client),
+		Results:       resultStore,
+		Queue:         pkg.NewModelQueue(cfg.ModelQueue.Concurrency, cfg.ModelQueue.MaxQueued, cfg.ModelQueue.MaxWait),
+		Config:        &cfg,
+	}
+	// Probes stay unauthenticated and unlogged; readiness checks Ollama and reports GitHub.
+	http.Handle("/healthz", pkg.NewLivenessHandler())
+	http.Handle("/readyz", pkg.NewReadinessHandler(analyzer))
+	http.Handle("/detect", withCORS(pkg.WrapHandler("detect", pkg.WithGitHubToken(pkg.WithAPIKey(auth, pkg.NewDetectHandler(analyzer))), logger)))
+	http.Handle("/analyze", withCORS(pkg.WrapHandler("analyze", pkg.WithGitHubToken(pkg.WithAPIKey(auth, pkg.WithRateLimit(limiter, pkg.WithAnalysisQuota(pkg.NewAnalyzeHandler(analyzer))))), logger)))
+	http.Handle("/analyze/bulk", withCORS(pkg.WrapHandler("analyze_bulk", pkg.WithGitHubToken(pkg.WithAPIKey(auth, pkg.WithRateLimit(limiter, pkg.WithAnalysisQuota(pkg.BulkAnalyzeHandler(analyzer))))), logger)))
+
+	watchStore, err := pkg.NewWatchStore(cfg.Watch.Store)
 	if err != nil {
-		logger.Fatal("starting http server", zap.Error(err))
+		logger.Fatal("loading watch store", zap.Error(err))
+	}
+	http.Handle("/watches", withCORS(pkg.WrapHandler("watches", pkg.WithAPIKey(auth, pkg.WatchesHandler(watchStore, logger)), logger)))
+	http.Handle("/watches/", withCORS(pkg.WrapHandler("watches", pkg.WithAPIKey(auth, pkg.WatchesHandler(watchStore, logger)), logger)))
+	// SIGTERM stops the poller and starts the graceful shutdown of the server.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	poller := &pkg.WatchPoller{Store: watchStore, Analyzer: analyzer, Interval: cfg.Watch.Interval, Logger: logger}
+	pollerDone := make(chan struct{})
+	go func() {
+		defer close(pollerDone)
+		poller.Run(ctx)
+	}()
+	drain := []func(){func() { <-pollerDone }}
+
+	if cfg.Webhook.Secret != "" {
+		receiver := &pkg.GitHubWebhookReceiver{
+			Analyzer:              analyzer,
+			Results:               resultStore,
+			Secret:                []byte(cfg.Webhook.Secret),
+			CommentOnPullRequests: cfg.Webhook.PRComments,
+			Logger:                logger,
+		}
+		http.Handle("/webhooks/github", pkg.WrapHandler("github_webhook", receiver.Handler(), logger))
+		drain = append(drain, receiver.Wait)
 	}
 
+	srv := pkg.NewHTTPServer(cfg.Server, http.DefaultServeMux, logger)
+	logger.Info("listening", zap.String("addr", srv.Addr))
+	if err := pkg.ServeUntilDone(ctx, srv, cfg.Server.ShutdownTimeout, logger, drain...); err != nil {
+		logger.Fatal("starting http server", zap.Error(err))
+	}
 }
@@ -0,0 +1,75 @@
+package pkg
+
+import (
+	"context"
+	"sync"
+)
+
+// analysisGroup collapses concurrent identical analyses into one execution whose result is
+// shared by every caller, similar to x/sync/singleflight. Unlike singleflight, the shared run is
+// detached from the first caller's cancellation and is only cancelled once every caller gave up.
+type analysisGroup struct {
+	mu    sync.Mutex
+	calls map[string]*analysisCall
+}
+
+type analysisCall struct {
+	done   chan struct{}
+	resp   AnalyzeResponse
+	err    error
+	refs   int
+	cancel context.CancelFunc
+}
+
+// do runs fn once per key at a time. Callers arriving while a run is in flight wait for it and
+// receive the same result; shared reports whether the caller joined an existing run.
+func (g *analysisGroup) do(ctx context.Context, key string, fn func(context.Context) (AnalyzeResponse, error)) (resp AnalyzeResponse, shared bool, err error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*analysisCall)
+	}
+	call, shared := g.calls[key]
+	if !shared {
+		// Keep the first caller's deadline but not its cancellation, so a client hanging up does
+		// not fail the analysis for everyone else waiting on it.
+		runCtx := context.WithoutCancel(ctx)
+		var cancel context.CancelFunc
+		if deadline, ok := ctx.Deadline(); ok {
+			runCtx, cancel = context.WithDeadline(runCtx, deadline)
+		} else {
+			runCtx, cancel = context.WithCancel(runCtx)
+		}
+		call = &analysisCall{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = call
+
+		go func() {
+			call.resp, call.err = fn(runCtx)
+			cancel()
+			g.mu.Lock()
+			if g.calls[key] == call {
+				delete(g.calls, key)
+			}
+			g.mu.Unlock()
+			close(call.done)
+		}()
+	}
+	call.refs++
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.resp, shared, call.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		call.refs--
+		if call.refs == 0 {
+			// Nobody is waiting anymore: stop the run and let the next caller start a fresh one.
+			call.cancel()
+			if g.calls[key] == call {
+				delete(g.calls, key)
+			}
+		}
+		g.mu.Unlock()
+		return AnalyzeResponse{}, shared, ctx.Err()
+	}
+}
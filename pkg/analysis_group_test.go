@@ -0,0 +1,215 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitForRefs blocks until the in-flight call for key has n waiting callers.
+func waitForRefs(t *testing.T, g *analysisGroup, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		g.mu.Lock()
+		refs := 0
+		for _, call := range g.calls {
+			refs += call.refs
+		}
+		g.mu.Unlock()
+		if refs == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d callers", n)
+}
+
+func TestAnalyzeHandlerCoalescesIdenticalRequests(t *testing.T) {
+	var compareCalls atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octo/hello/compare/v1.0.0...v1.1.0", func(w http.ResponseWriter, r *http.Request) {
+		compareCalls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"commits":[],"files":[]}`))
+	})
+	mux.HandleFunc("/repos/octo/hello/releases", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[]`))
+	})
+	client := newGitHubTestClient(t, mux)
+
+	release := make(chan struct{})
+	var modelCalls atomic.Int32
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		modelCalls.Add(1)
+		<-release
+		_ = json.NewEncoder(w).Encode(map[string]any{"response": validModelResponse, "done": true})
+	}))
+	defer ollama.Close()
+
+	analyzer := &Analyzer{GitHub: client, OllamaBaseURL: ollama.URL}
+	handler := NewAnalyzeHandler(analyzer)
+	body := []byte(`{"repoUrl":"https://github.com/octo/hello","fromTag":"v1.0.0","toTag":"v1.1.0","mode":"fast"}`)
+
+	var wg sync.WaitGroup
+	recs := make([]*httptest.ResponseRecorder, 3)
+	for i := range recs {
+		recs[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handler.ServeHTTP(recs[i], httptest.NewRequest(http.MethodPost, "/analyze", bytes.NewReader(body)))
+		}()
+	}
+	waitForRefs(t, &analyzer.inflight, 3)
+	close(release)
+	wg.Wait()
+
+	for i, rec := range recs {
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d: expected status %d, got %d: %s", i, http.StatusOK, rec.Code, rec.Body.String())
+		}
+		if rec.Body.String() != recs[0].Body.String() {
+			t.Fatalf("request %d: expected identical responses", i)
+		}
+	}
+	if compareCalls.Load() != 1 || modelCalls.Load() != 1 {
+		t.Fatalf("expected one pipeline run, got %d compare and %d model calls", compareCalls.Load(), modelCalls.Load())
+	}
+}
+
+func TestAnalysisGroupSurvivesLeaderCancellation(t *testing.T) {
+	var g analysisGroup
+	release := make(chan struct{})
+	var runs atomic.Int32
+	fn := func(ctx context.Context) (AnalyzeResponse, error) {
+		runs.Add(1)
+		select {
+		case <-release:
+			return AnalyzeResponse{Risk: RiskInfo{Level: "low"}}, nil
+		case <-ctx.Done():
+			return AnalyzeResponse{}, ctx.Err()
+		}
+	}
+
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leaderErr := make(chan error)
+	go func() {
+		_, _, err := g.do(leaderCtx, "k", fn)
+		leaderErr <- err
+	}()
+	waitForRefs(t, &g, 1)
+
+	followerResult := make(chan AnalyzeResponse)
+	go func() {
+		resp, shared, err := g.do(context.Background(), "k", fn)
+		if err != nil || !shared {
+			t.Errorf("expected shared success, got shared=%v err=%v", shared, err)
+		}
+		followerResult <- resp
+	}()
+	waitForRefs(t, &g, 2)
+
+	cancelLeader()
+	if err := <-leaderErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected leader to see its own cancellation, got %v", err)
+	}
+	close(release)
+	if resp := <-followerResult; resp.Risk.Level != "low" {
+		t.Fatalf("expected follower to receive the shared result, got %+v", resp)
+	}
+	if runs.Load() != 1 {
+		t.Fatalf("expected a single run, got %d", runs.Load())
+	}
+}
+
+func TestAnalysisGroupCancelsWhenAllCallersLeave(t *testing.T) {
+	var g analysisGroup
+	cancelled := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		_, _, _ = g.do(ctx, "k", func(runCtx context.Context) (AnalyzeResponse, error) {
+			<-runCtx.Done()
+			close(cancelled)
+			return AnalyzeResponse{}, runCtx.Err()
+		})
+	}()
+	waitForRefs(t, &g, 1)
+	cancel()
+
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the run to be cancelled once nobody waits for it")
+	}
+}
+
+func TestAnalyzeKeepsCallersOfDifferentRoutesApart(t *testing.T) {
+	ghMux := http.NewServeMux()
+	emptyCompareMux(ghMux, "octo", "hello", "v1.0.0", "v1.1.0")
+
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var models []string
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ollamaRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		models = append(models, req.Model)
+		mu.Unlock()
+		<-release
+		_ = json.NewEncoder(w).Encode(map[string]any{"response": validModelResponse, "done": true})
+	}))
+	defer ollama.Close()
+
+	cfg := DefaultConfig()
+	cfg.Ollama.Routes = []ModelRoute{{Clients: []string{"premium"}, Model: "big"}}
+	analyzer := &Analyzer{GitHub: newGitHubTestClient(t, ghMux), OllamaBaseURL: ollama.URL, Config: &cfg}
+	req := AnalyzeRequest{RepoUrl: "https://github.com/octo/hello", FromTag: "v1.0.0", ToTag: "v1.1.0", Mode: "fast"}
+
+	clients := []string{"basic", "premium"}
+	resps := make([]AnalyzeResponse, len(clients))
+	var wg sync.WaitGroup
+	for i, client := range clients {
+		ctx := context.WithValue(context.Background(), requestInfoKey{}, &requestInfo{Client: client})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := analyzer.Analyze(ctx, req)
+			if err != nil {
+				t.Errorf("client %s: %v", client, err)
+			}
+			resps[i] = resp
+		}()
+	}
+	// A shared pipeline would only ever make one model call.
+	waitForRefs(t, &analyzer.inflight, 2)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(models)
+		mu.Unlock()
+		if n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			close(release)
+			t.Fatalf("expected a model call per route, got %d", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if resps[0].Meta.Model != cfg.Ollama.Fast.Model || resps[1].Meta.Model != "big" {
+		t.Fatalf("expected each caller's routed model, got %q and %q", resps[0].Meta.Model, resps[1].Meta.Model)
+	}
+}
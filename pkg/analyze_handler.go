@@ -16,11 +16,14 @@ import (
 
 // AnalyzeHandler handles POST /analyze requests.
 func AnalyzeHandler(gh *github.Client, ollamaBaseURL string, logger *zap.Logger) http.HandlerFunc {
-	if logger == nil {
-		logger = zap.NewNop()
-	}
+	return NewAnalyzeHandler(&Analyzer{GitHub: gh, OllamaBaseURL: ollamaBaseURL, Logger: logger})
+}
+
+// NewAnalyzeHandler serves POST /analyze using the provided Analyzer.
+func NewAnalyzeHandler(analyzer *Analyzer) http.HandlerFunc {
+	logger := analyzer.logger()
 	return func(w http.ResponseWriter, r *http.Request) {
-		log := logger.With(zap.String("handler", "analyze"))
+		log := requestLogger(r.Context(), logger).With(zap.String("handler", "analyze"))
 
 		if r.Method != http.MethodPost {
 			log.Warn("method not allowed", zap.String("method", r.Method))
@@ -28,7 +31,14 @@ func AnalyzeHandler(gh *github.Client, ollamaBaseURL string, logger *zap.Logger)
 			return
 		}
 
-		ctx, cancel := context.WithTimeout(r.Context(), 120*time.Second)
+		format := r.URL.Query().Get("format")
+		if format != "" && format != "json" && format != "sarif" {
+			log.Warn("invalid format", zap.String("format", format))
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "format must be 'json' or 'sarif'"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), analyzer.config().Timeouts.Analyze)
 		defer cancel()
 
 		var req AnalyzeRequest
@@ -39,124 +49,16 @@ func AnalyzeHandler(gh *github.Client, ollamaBaseURL string, logger *zap.Logger)
 			return
 		}
 
-		req.RepoUrl = strings.TrimSpace(req.RepoUrl)
-		if req.RepoUrl == "" {
-			log.Warn("missing repoUrl")
-			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "repoUrl is required"})
-			return
-		}
-		if strings.TrimSpace(req.FromTag) == "" {
-			log.Warn("missing fromTag", zap.String("repo_url", req.RepoUrl))
-			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "fromTag is required"})
-			return
-		}
-		if strings.TrimSpace(req.ToTag) == "" {
-			log.Warn("missing toTag", zap.String("repo_url", req.RepoUrl))
-			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "toTag is required"})
-			return
-		}
-		if req.Mode != "fast" && req.Mode != "deep" {
-			log.Warn("invalid mode", zap.String("mode", req.Mode), zap.String("repo_url", req.RepoUrl))
-			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "mode must be 'fast' or 'deep'"})
-			return
-		}
-
-		maxReleases := req.Limits.MaxReleases
-		if maxReleases == 0 {
-			maxReleases = 30
-		}
-		if maxReleases < 1 {
-			maxReleases = 1
-		}
-		if maxReleases > 60 {
-			maxReleases = 60
-		}
-
-		owner, repo, err := ParseGitHubRepoURL(req.RepoUrl)
+		resp, err := analyzer.Analyze(ctx, req)
 		if err != nil {
-			log.Warn("invalid repoUrl", zap.String("repo_url", req.RepoUrl))
-			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid repoUrl"})
+			handleAnalyzeError(w, err, ctx, log.With(zap.String("repo_url", req.RepoUrl)))
 			return
 		}
 
-		log = log.With(
-			zap.String("repo_url", req.RepoUrl),
-			zap.String("from_tag", req.FromTag),
-			zap.String("to_tag", req.ToTag),
-			zap.String("mode", req.Mode),
-		)
-
-		data, err := fetchComparisonData(ctx, gh, owner, repo, req.FromTag, req.ToTag, maxReleases, req.Mode)
-		if err != nil {
-			handleAnalyzeError(w, err, ctx, log)
+		if format == "sarif" {
+			writeJSON(w, http.StatusOK, RenderSARIF(resp, SARIFOptions{ArtifactURI: r.URL.Query().Get("artifact")}))
 			return
 		}
-
-		bundle := analysisInputBundle{
-			Repo:         req.RepoUrl,
-			From:         req.FromTag,
-			To:           req.ToTag,
-			ReleaseNotes: data.ReleaseNotes,
-			CommitTitles: data.CommitTitles,
-			ChangedFiles: data.ChangedFiles,
-		}
-
-		prompt, err := buildAnalysisPrompt(bundle)
-		if err != nil {
-			log.Error("failed to build prompt", zap.Error(err))
-			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to build analysis prompt"})
-			return
-		}
-
-		model, numPredict := ollamaConfig(req.Mode)
-		log.Info("ollama prompt stats",
-			zap.Int("prompt_bytes", len(prompt)),
-			zap.Int("prompt_tokens_est", len(prompt)/4),
-			zap.String("model", model),
-			zap.Int("num_predict", numPredict),
-		)
-
-		modelPayload, err := callOllama(ctx, ollamaBaseURL, prompt, req.Mode)
-		if err != nil {
-			handleAnalyzeError(w, err, ctx, log)
-			return
-		}
-
-		resp, shapeInvalid, err := validateAndNormalizeResponse(modelPayload)
-		if err != nil {
-			logModelParseFailure(log, "initial", err, model, numPredict, modelPayload)
-			if shapeInvalid {
-				repairPrompt, promptErr := buildRepairPrompt(modelPayload)
-				if promptErr != nil {
-					log.Error("failed to build repair prompt", zap.Error(promptErr))
-					writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "model returned invalid JSON"})
-					return
-				}
-
-				repairPayload, repairErr := callOllama(ctx, ollamaBaseURL, repairPrompt, req.Mode)
-				if repairErr != nil {
-					handleAnalyzeError(w, repairErr, ctx, log)
-					return
-				}
-
-				resp, _, err = validateAndNormalizeResponse(repairPayload)
-				if err != nil {
-					logModelParseFailure(log, "repair", err, model, numPredict, repairPayload)
-					writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "model returned invalid JSON"})
-					return
-				}
-			} else {
-				writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "model returned invalid JSON"})
-				return
-			}
-		}
-
-		resp.Meta.Repo.Url = req.RepoUrl
-		resp.Meta.FromTag = req.FromTag
-		resp.Meta.ToTag = req.ToTag
-		resp.Meta.GeneratedAt = time.Now().UTC().Format(time.RFC3339)
-
-		log.Info("analysis completed", zap.Int("risk_score", resp.Risk.Score), zap.String("risk_level", resp.Risk.Level))
 		writeJSON(w, http.StatusOK, resp)
 	}
 }
@@ -165,6 +67,19 @@ func handleAnalyzeError(w http.ResponseWriter, err error, ctx context.Context, l
 	if logger == nil {
 		logger = zap.NewNop()
 	}
+	var reqErr *RequestError
+	if errors.As(err, &reqErr) {
+		logger.Warn("invalid request", zap.String("reason", reqErr.Message))
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: reqErr.Message})
+		return
+	}
+	var busyErr *ModelBusyError
+	if errors.As(err, &busyErr) {
+		logger.Warn("model queue full", zap.Duration("retry_after", busyErr.RetryAfter))
+		writeRetryAfter(w, busyErr.RetryAfter)
+		writeJSON(w, http.StatusServiceUnavailable, errorResponse{Error: "model is busy, retry later"})
+		return
+	}
 	if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
 		logger.Warn("request timed out")
 		writeJSON(w, http.StatusGatewayTimeout, errorResponse{Error: "request timed out"})
@@ -176,15 +91,53 @@ func handleAnalyzeError(w http.ResponseWriter, err error, ctx context.Context, l
 		return
 	}
 	if errors.Is(err, ErrRateLimited) {
-		logger.Warn("github rate limit exceeded")
-		writeJSON(w, http.StatusTooManyRequests, errorResponse{Error: "github rate limit exceeded"})
+		writeGitHubRateLimited(w, err, logger)
+		return
+	}
+	if errors.Is(err, ErrForbidden) {
+		logger.Warn("github denied access", zap.Error(err))
+		writeJSON(w, http.StatusBadGateway, errorResponse{Error: "github denied access"})
+		return
+	}
+	if errors.Is(err, ErrPackageNotFound) {
+		logger.Warn("package not found")
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "package not found"})
+		return
+	}
+	if errors.Is(err, ErrPackageRepoUnknown) {
+		logger.Warn("package repository unknown")
+		writeJSON(w, http.StatusUnprocessableEntity, errorResponse{Error: "package has no GitHub source repository"})
+		return
+	}
+	if errors.Is(err, ErrInvalidModelResponse) {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "model returned invalid JSON"})
 		return
 	}
 	logger.Error("internal server error", zap.Error(err))
 	writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "internal server error"})
 }
 
+// writeGitHubRateLimited answers 429 for an exhausted GitHub rate limit, with Retry-After and
+// resetAt when the reset time is known.
+func writeGitHubRateLimited(w http.ResponseWriter, err error, logger *zap.Logger) {
+	resp := errorResponse{Error: "github rate limit exceeded"}
+	var rateErr *GitHubRateLimitError
+	if errors.As(err, &rateErr) && rateErr.Secondary {
+		resp.Error = "github secondary rate limit exceeded"
+	}
+	if resetAt, ok := rateLimitReset(err); ok {
+		resp.ResetAt = resetAt.UTC().Format(time.RFC3339)
+		writeRetryAfter(w, time.Until(resetAt))
+	}
+	logger.Warn(resp.Error, zap.String("reset_at", resp.ResetAt))
+	writeJSON(w, http.StatusTooManyRequests, resp)
+}
+
 func writeJSON(w http.ResponseWriter, status int, payload any) {
+	if errResp, ok := payload.(errorResponse); ok && errResp.RequestID == "" {
+		errResp.RequestID = w.Header().Get(RequestIDHeader)
+		payload = errResp
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	_ = json.NewEncoder(w).Encode(payload)
@@ -204,12 +157,15 @@ func buildAnalysisPrompt(bundle analysisInputBundle) (string, error) {
 	return prompt, nil
 }
 
+// errEmptyModelResponse is returned when the model's answer contains no JSON object.
+var errEmptyModelResponse = errors.New("empty model response")
+
 // validateAndNormalizeResponse validates JSON shape, then normalizes risk level and empty slices.
 func validateAndNormalizeResponse(raw []byte) (AnalyzeResponse, bool, error) {
 	cleaned := extractJSONObject(raw)
 	cleaned = bytes.TrimSpace(cleaned)
 	if len(cleaned) == 0 {
-		return AnalyzeResponse{}, false, errors.New("empty model response")
+		return AnalyzeResponse{}, false, errEmptyModelResponse
 	}
 
 	var obj map[string]json.RawMessage
@@ -226,6 +182,13 @@ func validateAndNormalizeResponse(raw []byte) (AnalyzeResponse, bool, error) {
 		return AnalyzeResponse{}, false, err
 	}
 
+	normalizeResponse(&resp)
+	return resp, false, nil
+}
+
+// normalizeResponse clamps the risk score, derives the risk level from it and replaces nil
+// slices with empty ones.
+func normalizeResponse(resp *AnalyzeResponse) {
 	resp.Risk.Score = clampScore(resp.Risk.Score)
 	expectedLevel := riskLevelForScore(resp.Risk.Score)
 	if resp.Risk.Level != expectedLevel {
@@ -272,8 +235,6 @@ func validateAndNormalizeResponse(raw []byte) (AnalyzeResponse, bool, error) {
 	if resp.Evidence == nil {
 		resp.Evidence = []EvidenceItem{}
 	}
-
-	return resp, false, nil
 }
 
 func clampScore(score int) int {
@@ -315,6 +276,31 @@ func validateResponseShape(obj map[string]json.RawMessage) error {
 		}
 	}
 
+	if err := validateRiskAndSummaryShape(obj); err != nil {
+		return err
+	}
+
+	if err := validateArrayOfObjects(obj["breakers"], "breakers", "evidence"); err != nil {
+		return err
+	}
+	if err := validateArrayOfObjects(obj["behaviorChanges"], "behaviorChanges", "evidence"); err != nil {
+		return err
+	}
+	if err := validateArrayOfObjects(obj["upgradeSteps"], "upgradeSteps", "evidence"); err != nil {
+		return err
+	}
+	if err := validateArrayOfObjects(obj["evidence"], "evidence", ""); err != nil {
+		return err
+	}
+
+	if !isJSONObject(obj["meta"]) {
+		return errors.New("meta must be object")
+	}
+	return nil
+}
+
+// validateRiskAndSummaryShape checks the risk and summary objects every answer has.
+func validateRiskAndSummaryShape(obj map[string]json.RawMessage) error {
 	var risk map[string]json.RawMessage
 	if err := json.Unmarshal(obj["risk"], &risk); err != nil {
 		return errors.New("risk must be object")
@@ -342,23 +328,6 @@ func validateResponseShape(obj map[string]json.RawMessage) error {
 			}
 		}
 	}
-
-	if err := validateArrayOfObjects(obj["breakers"], "breakers", "evidence"); err != nil {
-		return err
-	}
-	if err := validateArrayOfObjects(obj["behaviorChanges"], "behaviorChanges", "evidence"); err != nil {
-		return err
-	}
-	if err := validateArrayOfObjects(obj["upgradeSteps"], "upgradeSteps", "evidence"); err != nil {
-		return err
-	}
-	if err := validateArrayOfObjects(obj["evidence"], "evidence", ""); err != nil {
-		return err
-	}
-
-	if !isJSONObject(obj["meta"]) {
-		return errors.New("meta must be object")
-	}
 	return nil
 }
 
@@ -2,12 +2,17 @@ package pkg
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"go.uber.org/zap"
 )
 
@@ -18,6 +23,7 @@ type ollamaRequest struct {
 	Options struct {
 		Temperature float64 `json:"temperature"`
 		NumPredict  int     `json:"num_predict"`
+		NumCtx      int     `json:"num_ctx"`
 	} `json:"options"`
 }
 
@@ -222,12 +228,18 @@ func TestAnalyzeHandlerRepairsInvalidShape(t *testing.T) {
 			}`
 		}
 
-		resp := map[string]any{"response": modelResp, "done": true}
+		resp := map[string]any{"response": modelResp, "done": true, "prompt_eval_count": 900, "eval_count": 120, "eval_duration": int64(4 * time.Second)}
 		w.Header().Set("Content-Type", "application/json")
 		_ = json.NewEncoder(w).Encode(resp)
 	}))
 	defer ollama.Close()
 
+	model := DefaultConfig().Ollama.Fast.Model
+	attempts := testutil.ToFloat64(ModelRepairAttemptCounter.WithLabelValues(model))
+	successes := testutil.ToFloat64(ModelRepairSuccessCounter.WithLabelValues(model))
+	shapeFailures := testutil.ToFloat64(ModelValidationFailureCounter.WithLabelValues("initial", "shape"))
+	lowRisk := testutil.ToFloat64(AnalysisRiskLevelCounter.WithLabelValues("fast", "low"))
+
 	handler := AnalyzeHandler(ghClient, ollama.URL, zap.NewNop())
 
 	body := `{"repoUrl":"https://github.com/octo/hello","fromTag":"v1.0.0","toTag":"v1.1.0","mode":"fast","limits":{"maxReleases":10}}`
@@ -242,6 +254,43 @@ func TestAnalyzeHandlerRepairsInvalidShape(t *testing.T) {
 	if requestCount != 2 {
 		t.Fatalf("expected 2 ollama calls (repair), got %d", requestCount)
 	}
+
+	if got := testutil.ToFloat64(ModelRepairAttemptCounter.WithLabelValues(model)) - attempts; got != 1 {
+		t.Fatalf("expected 1 repair attempt, got %v", got)
+	}
+	if got := testutil.ToFloat64(ModelRepairSuccessCounter.WithLabelValues(model)) - successes; got != 1 {
+		t.Fatalf("expected 1 repair success, got %v", got)
+	}
+	if got := testutil.ToFloat64(ModelValidationFailureCounter.WithLabelValues("initial", "shape")) - shapeFailures; got != 1 {
+		t.Fatalf("expected 1 shape validation failure, got %v", got)
+	}
+	if got := testutil.ToFloat64(AnalysisRiskLevelCounter.WithLabelValues("fast", "low")) - lowRisk; got != 1 {
+		t.Fatalf("expected 1 low risk analysis, got %v", got)
+	}
+	if n := testutil.CollectAndCount(OllamaTokensPerSecond); n == 0 {
+		t.Fatalf("expected tokens per second to be observed")
+	}
+}
+
+func TestValidationFailureReason(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    string
+	}{
+		{payload: "", want: "empty"},
+		{payload: `{"risk": `, want: "syntax"},
+		{payload: `{"risk": {}}`, want: "shape"},
+		{payload: `{"risk":{"score":"high"},"summary":{},"breakers":[],"behaviorChanges":[],"upgradeSteps":[],"evidence":[],"meta":{}}`, want: "type"},
+	}
+	for _, tt := range tests {
+		_, shapeInvalid, err := validateAndNormalizeResponse([]byte(tt.payload))
+		if err == nil {
+			t.Fatalf("expected %q to fail validation", tt.payload)
+		}
+		if got := validationFailureReason(err, shapeInvalid); got != tt.want {
+			t.Errorf("validationFailureReason(%q) = %q, want %q", tt.payload, got, tt.want)
+		}
+	}
 }
 
 func TestAnalyzeHandlerSalvageFencedJSON(t *testing.T) {
@@ -302,3 +351,176 @@ func assertErrorJSON(t *testing.T, payload []byte) {
 		t.Fatalf("expected error message")
 	}
 }
+
+func TestAnalyzeHandlerRoutesModel(t *testing.T) {
+	ghMux := http.NewServeMux()
+	emptyCompareMux(ghMux, "octo", "hello", "v1.0.0", "v1.1.0")
+
+	var got ollamaRequest
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"response": validModelResponse, "done": true})
+	}))
+	defer ollama.Close()
+
+	cfg := DefaultConfig()
+	zero := 0.0
+	cfg.Ollama.Routes = []ModelRoute{
+		{Name: "other", Repos: []string{"someone/*"}, Model: "unused"},
+		{Name: "octo", Modes: []string{"fast"}, Repos: []string{"Octo/*"}, Model: "qwen2.5:14b", NumCtx: 16384, Temperature: &zero},
+	}
+	analyzer := &Analyzer{GitHub: newGitHubTestClient(t, ghMux), OllamaBaseURL: ollama.URL, Config: &cfg}
+
+	body := `{"repoUrl":"https://github.com/octo/hello","fromTag":"v1.0.0","toTag":"v1.1.0","mode":"fast"}`
+	rec := httptest.NewRecorder()
+	NewAnalyzeHandler(analyzer).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/analyze", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	if got.Model != "qwen2.5:14b" || got.Options.NumCtx != 16384 || got.Options.Temperature != 0 || got.Options.NumPredict != cfg.Ollama.Fast.NumPredict {
+		t.Fatalf("unexpected routed model request %+v", got)
+	}
+	var resp AnalyzeResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Meta.Model != "qwen2.5:14b" {
+		t.Fatalf("expected meta.model to record the routed model, got %q", resp.Meta.Model)
+	}
+}
+
+func TestAnalyzerFallsBackToNextModel(t *testing.T) {
+	ghMux := http.NewServeMux()
+	emptyCompareMux(ghMux, "octo", "hello", "v1.0.0", "v1.1.0")
+
+	var models []string
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ollamaRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		models = append(models, req.Model)
+		if req.Model != "good" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"response": validModelResponse, "done": true})
+	}))
+	defer primary.Close()
+	garbage, garbageCalls := newOllamaTestServer(t, `{"risk": "unknown"}`)
+
+	cfg := DefaultConfig()
+	cfg.Ollama.Fallbacks = []ModelFallback{
+		{Modes: []string{"deep"}, ModelConfig: ModelConfig{Model: "deep-only", NumPredict: 100}},
+		{URL: garbage.URL, ModelConfig: ModelConfig{Model: "bad", NumPredict: 100}},
+		{ModelConfig: ModelConfig{Model: "good", NumPredict: 100}},
+	}
+	analyzer := &Analyzer{GitHub: newGitHubTestClient(t, ghMux), OllamaBaseURL: primary.URL, Config: &cfg}
+
+	resp, err := analyzer.Analyze(context.Background(), AnalyzeRequest{RepoUrl: "https://github.com/octo/hello", FromTag: "v1.0.0", ToTag: "v1.1.0", Mode: "fast"})
+	if err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	if resp.Meta.Model != "good" || !resp.Meta.Fallback {
+		t.Fatalf("expected fallback model in meta, got %+v", resp.Meta)
+	}
+	if strings.Join(models, ",") != cfg.Ollama.Fast.Model+",good" {
+		t.Fatalf("unexpected models on primary server: %v", models)
+	}
+	if garbageCalls.Load() != 2 {
+		t.Fatalf("expected initial and repair call on the invalid model, got %d", garbageCalls.Load())
+	}
+}
+
+func TestAnalyzerFallbackChainExhausted(t *testing.T) {
+	ghMux := http.NewServeMux()
+	emptyCompareMux(ghMux, "octo", "hello", "v1.0.0", "v1.1.0")
+	garbage, _ := newOllamaTestServer(t, `not json at all`)
+
+	cfg := DefaultConfig()
+	cfg.Ollama.Fallbacks = []ModelFallback{{ModelConfig: ModelConfig{Model: "backup", NumPredict: 100}}}
+	analyzer := &Analyzer{GitHub: newGitHubTestClient(t, ghMux), OllamaBaseURL: garbage.URL, Config: &cfg}
+
+	_, err := analyzer.Analyze(context.Background(), AnalyzeRequest{RepoUrl: "https://github.com/octo/hello", FromTag: "v1.0.0", ToTag: "v1.1.0", Mode: "fast"})
+	if !errors.Is(err, ErrInvalidModelResponse) {
+		t.Fatalf("expected ErrInvalidModelResponse once every model failed, got %v", err)
+	}
+}
+
+func TestAnalyzerRollback(t *testing.T) {
+	// The rollback from v2.0.0 to v1.0.0 undoes the upgrade v1.0.0...v2.0.0.
+	ghMux := http.NewServeMux()
+	emptyCompareMux(ghMux, "octo", "hello", "v1.0.0", "v2.0.0")
+
+	const rollbackResponse = `{"risk":{"level":"low","score":70,"confidence":"medium","reasons":["schema"]},"summary":{"highlights":[],"grouped":[]},"removedFeatures":[{"title":"Export API","severity":"medium","reason":"added in v2"}],"irreversibleMigrations":[{"title":"Schema v5","severity":"high","reason":"drops column"}],"dataFormatChanges":[],"rollbackSteps":[{"step":"Restore backup","why":"schema cannot be downgraded"}],"evidence":[],"meta":{}}`
+	var prompts []string
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ollamaRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		prompts = append(prompts, req.Prompt)
+		answer := rollbackResponse
+		if len(prompts) == 1 {
+			// An upgrade-shaped answer has to be repaired into the rollback format.
+			answer = validModelResponse
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"response": answer, "done": true})
+	}))
+	defer ollama.Close()
+
+	analyzer := &Analyzer{GitHub: newGitHubTestClient(t, ghMux), OllamaBaseURL: ollama.URL}
+	resp, err := analyzer.Analyze(context.Background(), AnalyzeRequest{RepoUrl: "https://github.com/octo/hello", FromTag: "v2.0.0", ToTag: "v1.0.0", Mode: "fast"})
+	if err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+
+	if len(prompts) != 2 || !strings.Contains(prompts[0], "ROLLBACK from v2.0.0 to the older version v1.0.0") || !strings.Contains(prompts[1], "irreversibleMigrations") {
+		t.Fatalf("expected a rollback prompt and a rollback repair prompt, got %q", prompts)
+	}
+	if !resp.Meta.Downgrade || resp.Meta.FromTag != "v2.0.0" {
+		t.Fatalf("expected downgrade meta, got %+v", resp.Meta)
+	}
+	rb := resp.Rollback
+	if rb == nil {
+		t.Fatalf("expected rollback findings")
+	}
+	if len(rb.RemovedFeatures) != 1 || len(rb.IrreversibleMigrations) != 1 || rb.IrreversibleMigrations[0].Title != "Schema v5" || len(rb.Steps) != 1 {
+		t.Fatalf("unexpected rollback findings: %+v", rb)
+	}
+	if rb.DataFormatChanges == nil || rb.IrreversibleMigrations[0].Evidence == nil || resp.Breakers == nil {
+		t.Fatalf("expected empty slices instead of nil, got %+v", resp)
+	}
+	if resp.Risk.Level != "high" {
+		t.Fatalf("expected risk level derived from the score, got %q", resp.Risk.Level)
+	}
+}
+
+func TestAnalyzeHandlerGitHubRateLimited(t *testing.T) {
+	reset := time.Now().Add(10 * time.Minute).Truncate(time.Second)
+	ghMux := http.NewServeMux()
+	ghMux.HandleFunc("/repos/octo/hello/compare/v1.0.0...v1.1.0", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		w.WriteHeader(http.StatusForbidden)
+	})
+
+	handler := AnalyzeHandler(newGitHubTestClient(t, ghMux), "http://localhost:11434", zap.NewNop())
+	body := `{"repoUrl":"https://github.com/octo/hello","fromTag":"v1.0.0","toTag":"v1.1.0","mode":"fast"}`
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/analyze", strings.NewReader(body)))
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected Retry-After header")
+	}
+	var resp errorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.ResetAt != reset.UTC().Format(time.RFC3339) {
+		t.Fatalf("expected resetAt %s, got %q", reset.UTC().Format(time.RFC3339), resp.ResetAt)
+	}
+}
@@ -0,0 +1,458 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v83/github"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// analysisModeMessage is the error message for an unknown analysis mode.
+const analysisModeMessage = "mode must be 'fast', 'deep' or 'thorough'"
+
+// isAnalysisMode reports whether mode is fast, deep or thorough. Thorough analyses use the deep
+// data and model settings but sample the model several times.
+func isAnalysisMode(mode string) bool {
+	return mode == "fast" || mode == "deep" || mode == "thorough"
+}
+
+// ErrInvalidModelResponse is returned when the model output cannot be turned into a valid analysis.
+var ErrInvalidModelResponse = errors.New("model returned invalid JSON")
+
+// RequestError reports an analysis request that failed validation.
+type RequestError struct {
+	Message string
+}
+
+func (e *RequestError) Error() string {
+	return e.Message
+}
+
+// Analyzer runs the upgrade analysis pipeline: GitHub fetch, prompt building, model call and validation.
+// It is shared by the HTTP handlers and the command-line mode.
+type Analyzer struct {
+	GitHub        *github.Client
+	OllamaBaseURL string
+	Logger        *zap.Logger
+	// Resolver maps package coordinates to repositories; requests using package/ecosystem are
+	// rejected when it is nil.
+	Resolver *PackageResolver
+	// Results holds precomputed analyses (e.g. from release webhooks) that are served instead of
+	// calling the model; optional.
+	Results *ResultStore
+	// Queue bounds concurrent model calls across all callers; unbounded when nil.
+	Queue *ModelQueue
+	// Config provides models, limits and timeouts; DefaultConfig() when nil.
+	Config *Config
+
+	inflight analysisGroup
+}
+
+func (a *Analyzer) logger() *zap.Logger {
+	if a.Logger == nil {
+		return zap.NewNop()
+	}
+	return a.Logger
+}
+
+func (a *Analyzer) config() Config {
+	if a.Config == nil {
+		return DefaultConfig()
+	}
+	return *a.Config
+}
+
+// Analyze validates req and returns the normalized analysis between its two tags.
+// The caller controls the overall deadline through ctx.
+func (a *Analyzer) Analyze(ctx context.Context, req AnalyzeRequest) (resp AnalyzeResponse, err error) {
+	ctx, span := tracer().Start(ctx, "analysis.analyze")
+	defer func() { endSpan(span, err) }()
+
+	if err := a.resolvePackageRequest(ctx, &req); err != nil {
+		return AnalyzeResponse{}, err
+	}
+
+	owner, repo, maxReleases, err := normalizeAnalyzeRequest(&req, a.config().Analysis)
+	if err != nil {
+		return AnalyzeResponse{}, err
+	}
+	span.SetAttributes(
+		attribute.String("repo", owner+"/"+repo),
+		attribute.String("from_tag", req.FromTag),
+		attribute.String("to_tag", req.ToTag),
+		attribute.String("mode", req.Mode),
+		attribute.Int("max_releases", maxReleases),
+	)
+
+	log := requestLogger(ctx, a.logger()).With(
+		zap.String("repo_url", req.RepoUrl),
+		zap.String("from_tag", req.FromTag),
+		zap.String("to_tag", req.ToTag),
+		zap.String("mode", req.Mode),
+	)
+
+	// Stored analyses were made with the server's credentials; callers with their own token
+	// get analyses scoped to that token only. Analyses of private repositories are only shared
+	// between callers that may use the GitHub App.
+	scope := githubTokenScope(ctx)
+	appAccess := hasGitHubAppAccess(ctx)
+	// Callers routed to different models must not share analyses.
+	route := a.routeScope(ctx, req.Mode, owner, repo)
+	if a.Results != nil && scope == "" {
+		if stored, ok := a.Results.Get(req.RepoUrl, req.FromTag, req.ToTag, req.Mode, route, appAccess); ok {
+			log.Info("serving stored analysis")
+			span.SetAttributes(attribute.Bool("analysis.stored", true))
+			return stored, nil
+		}
+	}
+
+	// Identical requests in flight share one execution of the pipeline.
+	key := fmt.Sprintf("%s/%s\x00%s\x00%s\x00%s\x00%d\x00%s\x00%t\x00%s", strings.ToLower(owner), strings.ToLower(repo), req.FromTag, req.ToTag, req.Mode, maxReleases, scope, appAccess, route)
+	resp, shared, err := a.inflight.do(ctx, key, func(ctx context.Context) (AnalyzeResponse, error) {
+		return a.runAnalysis(ctx, req, owner, repo, maxReleases, log)
+	})
+	span.SetAttributes(attribute.Bool("analysis.coalesced", shared))
+	if shared {
+		observeAnalysisCoalesced()
+		log.Info("joined in-flight analysis")
+	}
+	return resp, err
+}
+
+// routeScope identifies the models and settings an analysis of owner/repo in mode will use for
+// the caller of ctx.
+func (a *Analyzer) routeScope(ctx context.Context, mode, owner, repo string) string {
+	return a.config().Ollama.routeScope(a.OllamaBaseURL, modelRouteInput{
+		Mode:   mode,
+		Repo:   owner + "/" + repo,
+		Client: requestClient(ctx),
+	})
+}
+
+// runAnalysis fetches the comparison, calls the model and validates its answer.
+func (a *Analyzer) runAnalysis(ctx context.Context, req AnalyzeRequest, owner, repo string, maxReleases int, log *zap.Logger) (AnalyzeResponse, error) {
+	cfg := a.config()
+	// A rollback undoes the changes of the upgrade in the other direction, so those are fetched.
+	rollback := isDowngrade(req.FromTag, req.ToTag)
+	fetchFrom, fetchTo := req.FromTag, req.ToTag
+	if rollback {
+		fetchFrom, fetchTo = req.ToTag, req.FromTag
+	}
+	data, err := fetchComparisonData(ctx, a.githubClient(ctx), owner, repo, fetchFrom, fetchTo, maxReleases, req.Mode, cfg.Analysis.ForMode(req.Mode), cfg.GitHub.useGraphQL(userGitHubToken(ctx) != ""))
+	if err != nil {
+		return AnalyzeResponse{}, err
+	}
+
+	bundle := analysisInputBundle{
+		Repo:         req.RepoUrl,
+		From:         req.FromTag,
+		To:           req.ToTag,
+		ReleaseNotes: data.ReleaseNotes,
+		CommitTitles: data.CommitTitles,
+		ChangedFiles: data.ChangedFiles,
+		PullRequests: data.PullRequests,
+	}
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Bool("analysis.rollback", rollback),
+		attribute.String("analysis.from_commit", data.FromCommit),
+		attribute.String("analysis.to_commit", data.ToCommit),
+	)
+
+	_, promptSpan := tracer().Start(ctx, "analysis.build_prompt")
+	buildPrompt := buildAnalysisPrompt
+	if rollback {
+		buildPrompt = buildRollbackPrompt
+	}
+	prompt, err := buildPrompt(bundle)
+	promptSpan.SetAttributes(
+		attribute.Int("prompt.bytes", len(prompt)),
+		attribute.Int("prompt.release_notes", len(data.ReleaseNotes)),
+		attribute.Int("prompt.commit_titles", len(data.CommitTitles)),
+		attribute.Int("prompt.changed_files", len(data.ChangedFiles)),
+		attribute.Int("prompt.pull_requests", len(data.PullRequests)),
+	)
+	endSpan(promptSpan, err)
+	if err != nil {
+		return AnalyzeResponse{}, fmt.Errorf("build analysis prompt: %w", err)
+	}
+
+	promptTokens := len(prompt) / 4
+	observePromptSize(req.Mode, len(prompt), promptTokens)
+	model, route := cfg.Ollama.Route(modelRouteInput{
+		Mode:         req.Mode,
+		Repo:         owner + "/" + repo,
+		Client:       requestClient(ctx),
+		PromptTokens: promptTokens,
+	})
+	log.Info("ollama prompt stats",
+		zap.Int("prompt_bytes", len(prompt)),
+		zap.Int("prompt_tokens_est", promptTokens),
+		zap.String("model", model.Model),
+		zap.String("model_route", route),
+		zap.Bool("rollback", rollback),
+		zap.Int("num_ctx", model.NumCtx),
+		zap.Int("num_predict", model.NumPredict),
+	)
+
+	chain := cfg.Ollama.fallbackChain(a.OllamaBaseURL, model, req.Mode)
+	var (
+		resp     AnalyzeResponse
+		producer ModelConfig
+		fallback bool
+	)
+	if req.Mode == "thorough" {
+		resp, producer, fallback, err = a.generateSamples(ctx, prompt, chain, cfg.Timeouts.ModelCall, cfg.Analysis.ThoroughSamples, rollback, log)
+	} else {
+		resp, producer, fallback, err = a.generateWithFallback(ctx, prompt, chain, cfg.Timeouts.ModelCall, rollback, log)
+	}
+	if err != nil {
+		return AnalyzeResponse{}, err
+	}
+
+	resp.Meta.Repo.Url = req.RepoUrl
+	resp.Meta.FromTag = req.FromTag
+	resp.Meta.ToTag = req.ToTag
+	resp.Meta.GeneratedAt = time.Now().UTC().Format(time.RFC3339)
+	resp.Meta.Model = producer.Model
+	resp.Meta.Fallback = fallback
+	resp.Meta.Downgrade = isDowngrade(req.FromTag, req.ToTag)
+	observeModelAnalysis(producer.Model, fallback)
+	observeAnalysisRiskLevel(req.Mode, resp.Risk.Level)
+
+	log.Info("analysis completed", zap.Int("risk_score", resp.Risk.Score), zap.String("risk_level", resp.Risk.Level))
+	return resp, nil
+}
+
+// generateWithFallback asks the models of chain in order until one produces a valid analysis.
+// A model is skipped on transport errors, timeouts of the individual call and answers that stay
+// invalid after the repair attempt. Rejections by the model queue and the end of ctx stop the
+// chain. It returns the model that produced the analysis and whether it was a fallback. rollback
+// selects the answer format of rollback prompts.
+func (a *Analyzer) generateWithFallback(ctx context.Context, prompt string, chain []modelCandidate, callTimeout time.Duration, rollback bool, log *zap.Logger) (AnalyzeResponse, ModelConfig, bool, error) {
+	var lastErr error
+	for i, candidate := range chain {
+		if i > 0 {
+			log.Warn("falling back to next model", zap.String("model", candidate.Model.Model), zap.String("ollama_url", candidate.URL), zap.Error(lastErr))
+		}
+		resp, err := a.generate(ctx, prompt, candidate, callTimeout, rollback, log)
+		if err == nil {
+			return resp, candidate.Model, i > 0, nil
+		}
+		if errors.Is(err, ErrModelBusy) || ctx.Err() != nil {
+			return AnalyzeResponse{}, ModelConfig{}, false, err
+		}
+		lastErr = err
+		if i < len(chain)-1 {
+			observeModelFallback(candidate.Model.Model, modelFailureReason(err))
+		}
+	}
+	return AnalyzeResponse{}, ModelConfig{}, false, lastErr
+}
+
+// generate runs the prompt on one model and validates the answer, asking the model once to
+// repair JSON of the wrong shape.
+func (a *Analyzer) generate(ctx context.Context, prompt string, candidate modelCandidate, callTimeout time.Duration, rollback bool, log *zap.Logger) (AnalyzeResponse, error) {
+	model := candidate.Model
+	modelPayload, err := a.callModel(ctx, candidate.URL, prompt, model, callTimeout, "initial")
+	if err != nil {
+		return AnalyzeResponse{}, err
+	}
+
+	resp, shapeInvalid, err := validateModelPayload(ctx, modelPayload, "initial", rollback)
+	if err == nil {
+		return resp, nil
+	}
+	logModelParseFailure(log, "initial", err, model.Model, model.NumPredict, modelPayload)
+	if !shapeInvalid {
+		return AnalyzeResponse{}, ErrInvalidModelResponse
+	}
+
+	buildRepair := buildRepairPrompt
+	if rollback {
+		buildRepair = buildRollbackRepairPrompt
+	}
+	repairPrompt, promptErr := buildRepair(modelPayload)
+	if promptErr != nil {
+		log.Error("failed to build repair prompt", zap.Error(promptErr))
+		return AnalyzeResponse{}, ErrInvalidModelResponse
+	}
+
+	observeModelRepairAttempt(model.Model)
+	repairPayload, err := a.callModel(ctx, candidate.URL, repairPrompt, model, callTimeout, "repair")
+	if err != nil {
+		return AnalyzeResponse{}, err
+	}
+
+	resp, _, err = validateModelPayload(ctx, repairPayload, "repair", rollback)
+	if err != nil {
+		logModelParseFailure(log, "repair", err, model.Model, model.NumPredict, repairPayload)
+		return AnalyzeResponse{}, ErrInvalidModelResponse
+	}
+	observeModelRepairSuccess(model.Model)
+	return resp, nil
+}
+
+// callModel runs one model call once the queue has a free slot. A positive timeout bounds the
+// call itself, not the wait for the slot. phase tells initial and repair calls apart in traces.
+func (a *Analyzer) callModel(ctx context.Context, baseURL, prompt string, model ModelConfig, timeout time.Duration, phase string) (payload []byte, err error) {
+	ctx, span := tracer().Start(ctx, "ollama.generate", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("phase", phase),
+		attribute.String("model", model.Model),
+		attribute.String("ollama.url", baseURL),
+		attribute.Int("prompt.bytes", len(prompt)),
+		attribute.Int("num_predict", model.NumPredict),
+		attribute.Int("num_ctx", model.NumCtx),
+	))
+	defer func() {
+		span.SetAttributes(attribute.Int("response.bytes", len(payload)))
+		endSpan(span, err)
+	}()
+
+	release, err := a.Queue.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	span.AddEvent("model slot acquired")
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return callOllama(ctx, baseURL, model, prompt)
+}
+
+// validateModelPayload runs validateAndNormalizeResponse, or its rollback variant, in a span.
+func validateModelPayload(ctx context.Context, payload []byte, phase string, rollback bool) (AnalyzeResponse, bool, error) {
+	_, span := tracer().Start(ctx, "analysis.validate", trace.WithAttributes(
+		attribute.String("phase", phase),
+		attribute.Int("response.bytes", len(payload)),
+	))
+	validate := validateAndNormalizeResponse
+	if rollback {
+		validate = validateAndNormalizeRollbackResponse
+	}
+	resp, shapeInvalid, err := validate(payload)
+	span.SetAttributes(attribute.Bool("shape_invalid", shapeInvalid))
+	if err != nil {
+		reason := validationFailureReason(err, shapeInvalid)
+		span.SetAttributes(attribute.String("failure_reason", reason))
+		observeModelValidationFailure(phase, reason)
+	}
+	endSpan(span, err)
+	return resp, shapeInvalid, err
+}
+
+// validationFailureReason classifies an error of validateAndNormalizeResponse for metrics.
+func validationFailureReason(err error, shapeInvalid bool) string {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case shapeInvalid:
+		return "shape"
+	case errors.Is(err, errEmptyModelResponse):
+		return "empty"
+	case errors.As(err, &syntaxErr):
+		return "syntax"
+	case errors.As(err, &typeErr):
+		return "type"
+	default:
+		return "other"
+	}
+}
+
+// modelFailureReason classifies a failed model attempt for metrics.
+func modelFailureReason(err error) string {
+	switch {
+	case errors.Is(err, ErrInvalidModelResponse):
+		return "invalid_response"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	default:
+		return "error"
+	}
+}
+
+// resolvePackageRequest fills RepoUrl and maps FromTag/ToTag from package versions to tags when
+// the request names a package instead of a repository.
+func (a *Analyzer) resolvePackageRequest(ctx context.Context, req *AnalyzeRequest) error {
+	if strings.TrimSpace(req.RepoUrl) != "" || strings.TrimSpace(req.Package) == "" {
+		return nil
+	}
+	resolved, err := a.ResolvePackage(ctx, req.Ecosystem, req.Package)
+	if err != nil {
+		return err
+	}
+	req.RepoUrl = resolved.RepoUrl
+	req.FromTag = resolved.TagForVersion(strings.TrimSpace(req.FromTag))
+	req.ToTag = resolved.TagForVersion(strings.TrimSpace(req.ToTag))
+	return nil
+}
+
+// ResolvePackage resolves package coordinates through the configured registries.
+func (a *Analyzer) ResolvePackage(ctx context.Context, ecosystem, name string) (ResolvedPackage, error) {
+	if a.Resolver == nil {
+		return ResolvedPackage{}, &RequestError{Message: "package resolution is not enabled"}
+	}
+	resolved, err := a.Resolver.Resolve(ctx, ecosystem, name)
+	if errors.Is(err, ErrUnsupportedEcosystem) {
+		return ResolvedPackage{}, &RequestError{Message: "ecosystem must be 'go', 'npm', 'pypi' or 'crates'"}
+	}
+	return resolved, err
+}
+
+// normalizeAnalyzeRequest trims and validates req in place and returns the parsed repository
+// and the release limit clamped to limits.
+func normalizeAnalyzeRequest(req *AnalyzeRequest, limits AnalysisConfig) (owner, repo string, maxReleases int, err error) {
+	req.RepoUrl = strings.TrimSpace(req.RepoUrl)
+	if req.RepoUrl == "" {
+		return "", "", 0, &RequestError{Message: "repoUrl is required"}
+	}
+	if strings.TrimSpace(req.FromTag) == "" {
+		return "", "", 0, &RequestError{Message: "fromTag is required"}
+	}
+	if strings.TrimSpace(req.ToTag) == "" {
+		return "", "", 0, &RequestError{Message: "toTag is required"}
+	}
+	if !isAnalysisMode(req.Mode) {
+		return "", "", 0, &RequestError{Message: analysisModeMessage}
+	}
+
+	maxReleases = req.Limits.MaxReleases
+	if maxReleases == 0 {
+		maxReleases = limits.DefaultMaxReleases
+	}
+	if maxReleases < 1 {
+		maxReleases = 1
+	}
+	if maxReleases > limits.MaxReleases {
+		maxReleases = limits.MaxReleases
+	}
+
+	owner, repo, err = ParseGitHubRepoURL(req.RepoUrl)
+	if err != nil {
+		return "", "", 0, &RequestError{Message: "invalid repoUrl"}
+	}
+	return owner, repo, maxReleases, nil
+}
+
+// RiskLevelRank orders risk levels so thresholds can be compared; unknown levels rank below "low".
+func RiskLevelRank(level string) int {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "low":
+		return 1
+	case "medium":
+		return 2
+	case "high":
+		return 3
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,227 @@
+package pkg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIKey is one entry of the API key file.
+type APIKey struct {
+	ID  string `json:"id"`
+	Key string `json:"key"`
+	// RequestsPerMinute limits the requests made with this key; 0 means unlimited.
+	RequestsPerMinute int `json:"requestsPerMinute"`
+	// MaxConcurrent limits the analyses running at the same time for this key; 0 means unlimited.
+	MaxConcurrent int `json:"maxConcurrent"`
+}
+
+type apiKeyFile struct {
+	Keys []APIKey `json:"keys"`
+}
+
+// apiKeyState tracks the quota usage of one key.
+type apiKeyState struct {
+	key APIKey
+
+	mu          sync.Mutex
+	windowStart time.Time
+	requests    int
+	running     int
+}
+
+// APIKeyAuth validates bearer API keys and enforces their quotas.
+type APIKeyAuth struct {
+	// keys is indexed by the SHA-256 of the key so lookups do not compare secrets byte by byte.
+	keys map[[sha256.Size]byte]*apiKeyState
+	now  func() time.Time
+}
+
+// NewAPIKeyAuth validates keys and builds an authenticator for them.
+func NewAPIKeyAuth(keys []APIKey) (*APIKeyAuth, error) {
+	auth := &APIKeyAuth{keys: make(map[[sha256.Size]byte]*apiKeyState), now: time.Now}
+	ids := make(map[string]bool)
+	for i, k := range keys {
+		if strings.TrimSpace(k.ID) == "" {
+			return nil, fmt.Errorf("api key %d: id is required", i)
+		}
+		if ids[k.ID] {
+			return nil, fmt.Errorf("api key %q: duplicate id", k.ID)
+		}
+		if len(k.Key) < 16 {
+			return nil, fmt.Errorf("api key %q: key must be at least 16 characters", k.ID)
+		}
+		if k.RequestsPerMinute < 0 || k.MaxConcurrent < 0 {
+			return nil, fmt.Errorf("api key %q: quotas must not be negative", k.ID)
+		}
+		hash := sha256.Sum256([]byte(k.Key))
+		if _, ok := auth.keys[hash]; ok {
+			return nil, fmt.Errorf("api key %q: duplicate key", k.ID)
+		}
+		ids[k.ID] = true
+		auth.keys[hash] = &apiKeyState{key: k}
+	}
+	return auth, nil
+}
+
+// LoadAPIKeys reads an API key file of the form {"keys": [{"id", "key", "requestsPerMinute", "maxConcurrent"}]}.
+func LoadAPIKeys(path string) (*APIKeyAuth, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file apiKeyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid api key file: %w", err)
+	}
+	if len(file.Keys) == 0 {
+		return nil, errors.New("api key file contains no keys")
+	}
+	return NewAPIKeyAuth(file.Keys)
+}
+
+func (a *APIKeyAuth) lookup(r *http.Request) (*apiKeyState, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return nil, false
+	}
+	state, ok := a.keys[sha256.Sum256([]byte(strings.TrimSpace(token)))]
+	return state, ok
+}
+
+// allowRequest counts a request against the per-minute quota of the key. When the quota is
+// exhausted it returns the time until the current window ends.
+func (s *apiKeyState) allowRequest(now time.Time) (bool, time.Duration) {
+	if s.key.RequestsPerMinute == 0 {
+		return true, 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if elapsed := now.Sub(s.windowStart); elapsed >= time.Minute {
+		// Requests charged beyond the quota by chargeRequests carry over into later windows.
+		s.requests = max(0, s.requests-int(elapsed/time.Minute)*s.key.RequestsPerMinute)
+		s.windowStart = now
+	}
+	if s.requests >= s.key.RequestsPerMinute {
+		return false, s.windowStart.Add(time.Minute).Sub(now)
+	}
+	s.requests++
+	return true, 0
+}
+
+// chargeRequests counts n more requests against the per-minute quota, even beyond it.
+func (s *apiKeyState) chargeRequests(n int) {
+	if s.key.RequestsPerMinute == 0 || n <= 0 {
+		return
+	}
+	s.mu.Lock()
+	s.requests += n
+	s.mu.Unlock()
+}
+
+func (s *apiKeyState) acquire() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.key.MaxConcurrent > 0 && s.running >= s.key.MaxConcurrent {
+		return false
+	}
+	s.running++
+	return true
+}
+
+func (s *apiKeyState) release() {
+	s.mu.Lock()
+	s.running--
+	s.mu.Unlock()
+}
+
+type apiKeyContextKey struct{}
+
+// WithAPIKey rejects requests without a valid bearer API key (401) or over the key's request
+// quota (429). The key ID is recorded for request logs and metrics. A nil auth disables
+// authentication.
+func WithAPIKey(auth *APIKeyAuth, handler http.Handler) http.Handler {
+	if auth == nil {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state, ok := auth.lookup(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="diffbreak"`)
+			writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "missing or invalid API key"})
+			return
+		}
+		setRequestClient(r.Context(), state.key.ID)
+
+		if allowed, retryAfter := state.allowRequest(auth.now()); !allowed {
+			writeRetryAfter(w, retryAfter)
+			writeJSON(w, http.StatusTooManyRequests, errorResponse{Error: "request quota exceeded for API key"})
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), apiKeyContextKey{}, state)
+		handler.ServeHTTP(w, r.WithContext(withGitHubAppAccess(ctx)))
+	})
+}
+
+// apiKeyID returns the ID of the API key the request of ctx was authenticated with, or "" when
+// authentication is disabled.
+func apiKeyID(ctx context.Context) string {
+	if state, ok := ctx.Value(apiKeyContextKey{}).(*apiKeyState); ok {
+		return state.key.ID
+	}
+	return ""
+}
+
+// WithAnalysisQuota holds one of the API key's concurrent-analysis slots while handler runs and
+// answers 429 when none is free. It must be wrapped by WithAPIKey; without a key it is a no-op.
+func WithAnalysisQuota(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state, ok := r.Context().Value(apiKeyContextKey{}).(*apiKeyState)
+		if !ok {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		if !state.acquire() {
+			writeJSON(w, http.StatusTooManyRequests, errorResponse{Error: "too many concurrent analyses for API key"})
+			return
+		}
+		defer state.release()
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// acquireAnalysisSlots takes up to n more of the API key's concurrent-analysis slots for a
+// request that runs analyses in parallel. It returns how many it got, n without an API key, and
+// a function releasing them.
+func acquireAnalysisSlots(ctx context.Context, n int) (int, func()) {
+	state, ok := ctx.Value(apiKeyContextKey{}).(*apiKeyState)
+	if !ok {
+		return n, func() {}
+	}
+	acquired := 0
+	for acquired < n && state.acquire() {
+		acquired++
+	}
+	return acquired, func() {
+		for range acquired {
+			state.release()
+		}
+	}
+}
+
+func writeRetryAfter(w http.ResponseWriter, d time.Duration) {
+	seconds := int((d + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+}
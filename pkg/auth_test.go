@@ -0,0 +1,154 @@
+package pkg
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func newTestAPIKeyAuth(t *testing.T, keys ...APIKey) *APIKeyAuth {
+	t.Helper()
+	auth, err := NewAPIKeyAuth(keys)
+	if err != nil {
+		t.Fatalf("new api key auth: %v", err)
+	}
+	return auth
+}
+
+func authRequest(key string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/detect", nil)
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	return req
+}
+
+func TestWithAPIKeyRejectsMissingAndInvalidKeys(t *testing.T) {
+	auth := newTestAPIKeyAuth(t, APIKey{ID: "ci", Key: "0123456789abcdef"})
+	handler := WithAPIKey(auth, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !hasGitHubAppAccess(r.Context()) {
+			t.Errorf("expected API key callers to get GitHub App access")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, key := range []string{"", "wrong-key-wrong-key"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, authRequest(key))
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("key %q: expected status %d, got %d", key, http.StatusUnauthorized, rec.Code)
+		}
+		assertErrorJSON(t, rec.Body.Bytes())
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, authRequest("0123456789abcdef"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+}
+
+func TestWithAPIKeyEnforcesRequestQuota(t *testing.T) {
+	auth := newTestAPIKeyAuth(t, APIKey{ID: "ci", Key: "0123456789abcdef", RequestsPerMinute: 2})
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	auth.now = func() time.Time { return now }
+	handler := WithAPIKey(auth, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	codes := make([]int, 0, 3)
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, authRequest("0123456789abcdef"))
+		codes = append(codes, rec.Code)
+		if rec.Code == http.StatusTooManyRequests {
+			assertErrorJSON(t, rec.Body.Bytes())
+			if rec.Header().Get("Retry-After") != "60" {
+				t.Fatalf("expected Retry-After 60, got %q", rec.Header().Get("Retry-After"))
+			}
+		}
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK || codes[2] != http.StatusTooManyRequests {
+		t.Fatalf("unexpected status codes %v", codes)
+	}
+
+	now = now.Add(time.Minute)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, authRequest("0123456789abcdef"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected quota to reset after a minute, got %d", rec.Code)
+	}
+}
+
+func TestWithAnalysisQuotaLimitsConcurrency(t *testing.T) {
+	auth := newTestAPIKeyAuth(t, APIKey{ID: "ci", Key: "0123456789abcdef", MaxConcurrent: 1})
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := WithAPIKey(auth, WithAnalysisQuota(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	})))
+
+	done := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, authRequest("0123456789abcdef"))
+		done <- rec.Code
+	}()
+	<-started
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, authRequest("0123456789abcdef"))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+	assertErrorJSON(t, rec.Body.Bytes())
+
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Fatalf("expected first analysis to succeed, got %d", code)
+	}
+
+	go func() { <-started }()
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, authRequest("0123456789abcdef"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected slot to be released, got %d", rec.Code)
+	}
+}
+
+func TestWrapHandlerRecordsAPIKeyClient(t *testing.T) {
+	auth := newTestAPIKeyAuth(t, APIKey{ID: "ci", Key: "0123456789abcdef"})
+	var client string
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+			client = info.Client
+		}
+	})
+	handler := WrapHandler("detect", WithAPIKey(auth, inner), zap.NewNop())
+
+	handler.ServeHTTP(httptest.NewRecorder(), authRequest("0123456789abcdef"))
+	if client != "ci" {
+		t.Fatalf("expected client ci, got %q", client)
+	}
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, []byte(`{"keys":[{"id":"ci","key":"0123456789abcdef","requestsPerMinute":10,"maxConcurrent":2}]}`), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := LoadAPIKeys(path); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if _, err := NewAPIKeyAuth([]APIKey{{ID: "short", Key: "abc"}}); err == nil {
+		t.Fatalf("expected short key to be rejected")
+	}
+	if _, err := NewAPIKeyAuth([]APIKey{{ID: "a", Key: "0123456789abcdef"}, {ID: "a", Key: "fedcba9876543210"}}); err == nil {
+		t.Fatalf("expected duplicate id to be rejected")
+	}
+}
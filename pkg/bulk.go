@@ -0,0 +1,345 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	bulkMaxChanges         = 50
+	bulkDefaultConcurrency = 4
+	bulkMaxConcurrency     = 8
+)
+
+// Bulk result statuses.
+const (
+	BulkStatusOK         = "ok"
+	BulkStatusError      = "error"
+	BulkStatusUnresolved = "unresolved"
+)
+
+// errNoRepository is returned when a dependency cannot be mapped to a GitHub repository.
+var errNoRepository = errors.New("could not resolve dependency to a GitHub repository")
+
+// BulkAnalyzeRequest is the input payload of the /analyze/bulk endpoint. Either Before and
+// After (full manifests) or Diff (a unified diff of one manifest) must be set.
+type BulkAnalyzeRequest struct {
+	Format string `json:"format"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+	Diff   string `json:"diff"`
+	Mode   string `json:"mode"`
+	Limits struct {
+		MaxReleases int `json:"maxReleases"`
+		Concurrency int `json:"concurrency"`
+	} `json:"limits"`
+}
+
+// BulkAnalyzeResponse aggregates the analyses of every changed dependency, highest risk first.
+type BulkAnalyzeResponse struct {
+	Results []BulkAnalyzeResult `json:"results"`
+	Summary BulkSummary         `json:"summary"`
+}
+
+// BulkAnalyzeResult is the outcome of analyzing one dependency change.
+type BulkAnalyzeResult struct {
+	Dependency DependencyChange `json:"dependency"`
+	RepoUrl    string           `json:"repoUrl,omitempty"`
+	FromTag    string           `json:"fromTag,omitempty"`
+	ToTag      string           `json:"toTag,omitempty"`
+	Status     string           `json:"status"`
+	Error      string           `json:"error,omitempty"`
+	Analysis   *AnalyzeResponse `json:"analysis,omitempty"`
+}
+
+// BulkSummary counts results by status and reports the highest risk level found.
+type BulkSummary struct {
+	Total       int    `json:"total"`
+	Analyzed    int    `json:"analyzed"`
+	Failed      int    `json:"failed"`
+	Unresolved  int    `json:"unresolved"`
+	HighestRisk string `json:"highestRisk,omitempty"`
+}
+
+// BulkAnalyze diffs the manifests in req, resolves every changed dependency to its repository
+// and analyzes each from→to pair concurrently.
+func (a *Analyzer) BulkAnalyze(ctx context.Context, req BulkAnalyzeRequest) (BulkAnalyzeResponse, error) {
+	if _, err := ecosystemForFormat(req.Format); err != nil {
+		return BulkAnalyzeResponse{}, &RequestError{Message: "format must be 'gomod', 'gosum' or 'package-lock'"}
+	}
+	if req.Mode == "" {
+		req.Mode = "fast"
+	}
+	if !isAnalysisMode(req.Mode) {
+		return BulkAnalyzeResponse{}, &RequestError{Message: analysisModeMessage}
+	}
+
+	before, after := req.Before, req.After
+	if strings.TrimSpace(req.Diff) != "" {
+		before, after = SplitUnifiedDiff(req.Diff)
+	} else if strings.TrimSpace(before) == "" || strings.TrimSpace(after) == "" {
+		return BulkAnalyzeResponse{}, &RequestError{Message: "either diff or both before and after are required"}
+	}
+
+	changes, err := DiffDependencies(req.Format, before, after)
+	if err != nil {
+		return BulkAnalyzeResponse{}, &RequestError{Message: err.Error()}
+	}
+	if len(changes) > bulkMaxChanges {
+		return BulkAnalyzeResponse{}, &RequestError{Message: "too many dependency changes (max 50)"}
+	}
+
+	// The request was admitted as one analysis; every further dependency change is charged
+	// against the caller's rate limit and quota, and each parallel analysis needs its own
+	// concurrent-analysis slot of the API key.
+	chargeAnalyses(ctx, len(changes)-1)
+
+	concurrency := req.Limits.Concurrency
+	if concurrency <= 0 {
+		concurrency = bulkDefaultConcurrency
+	}
+	if concurrency > bulkMaxConcurrency {
+		concurrency = bulkMaxConcurrency
+	}
+	extra, releaseSlots := acquireAnalysisSlots(ctx, concurrency-1)
+	defer releaseSlots()
+	concurrency = 1 + extra
+
+	log := requestLogger(ctx, a.logger()).With(zap.String("format", req.Format), zap.Int("changes", len(changes)))
+	log.Info("bulk analysis started", zap.Int("concurrency", concurrency))
+
+	results := make([]BulkAnalyzeResult, len(changes))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, change := range changes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				results[i] = BulkAnalyzeResult{Dependency: change, Status: BulkStatusError, Error: ctx.Err().Error()}
+				return
+			}
+			defer func() { <-sem }()
+			results[i] = a.analyzeDependency(ctx, change, req.Mode, req.Limits.MaxReleases)
+		}()
+	}
+	wg.Wait()
+
+	sortBulkResults(results)
+	resp := BulkAnalyzeResponse{Results: results, Summary: summarizeBulkResults(results)}
+	log.Info("bulk analysis completed",
+		zap.Int("analyzed", resp.Summary.Analyzed),
+		zap.Int("failed", resp.Summary.Failed),
+		zap.Int("unresolved", resp.Summary.Unresolved),
+	)
+	return resp, nil
+}
+
+func (a *Analyzer) analyzeDependency(ctx context.Context, change DependencyChange, mode string, maxReleases int) BulkAnalyzeResult {
+	result := BulkAnalyzeResult{Dependency: change}
+
+	repoURL, fromTag, toTag, err := a.resolveDependency(ctx, change)
+	if err != nil {
+		result.Status = BulkStatusUnresolved
+		result.Error = err.Error()
+		return result
+	}
+	result.RepoUrl, result.FromTag, result.ToTag = repoURL, fromTag, toTag
+
+	req := AnalyzeRequest{RepoUrl: repoURL, FromTag: fromTag, ToTag: toTag, Mode: mode}
+	req.Limits.MaxReleases = maxReleases
+
+	analysisCtx, cancel := context.WithTimeout(ctx, a.config().Timeouts.Analyze)
+	defer cancel()
+
+	resp, err := a.Analyze(analysisCtx, req)
+	if err != nil {
+		result.Status = BulkStatusError
+		result.Error = analysisErrorMessage(err)
+		return result
+	}
+	result.Status = BulkStatusOK
+	result.Analysis = &resp
+	return result
+}
+
+// resolveDependency maps a dependency change onto a GitHub repository and the tags to compare.
+// github.com Go modules are mapped directly; everything else goes through the package resolver.
+func (a *Analyzer) resolveDependency(ctx context.Context, change DependencyChange) (repoURL, fromTag, toTag string, err error) {
+	if change.Ecosystem == EcosystemGo {
+		if repoURL, subdir, ok := goModuleGitHubRepo(change.Name); ok {
+			return repoURL, goModuleVersionTag(subdir, change.From), goModuleVersionTag(subdir, change.To), nil
+		}
+	}
+	if a.Resolver == nil {
+		return "", "", "", errNoRepository
+	}
+	resolved, err := a.Resolver.Resolve(ctx, change.Ecosystem, change.Name)
+	if err != nil {
+		if errors.Is(err, ErrPackageNotFound) || errors.Is(err, ErrPackageRepoUnknown) {
+			return "", "", "", errNoRepository
+		}
+		return "", "", "", err
+	}
+	return resolved.RepoUrl, resolved.TagForVersion(change.From), resolved.TagForVersion(change.To), nil
+}
+
+// goModuleGitHubRepo maps github.com/owner/repo[/sub/dir][/vN] to its repository URL and the
+// module's subdirectory inside the repository.
+func goModuleGitHubRepo(modulePath string) (repoURL, subdir string, ok bool) {
+	parts := strings.Split(modulePath, "/")
+	if len(parts) < 3 || parts[0] != "github.com" || parts[1] == "" || parts[2] == "" {
+		return "", "", false
+	}
+	rest := parts[3:]
+	if n := len(rest); n > 0 && isGoMajorVersionSuffix(rest[n-1]) {
+		rest = rest[:n-1]
+	}
+	return "https://github.com/" + parts[1] + "/" + parts[2], strings.Join(rest, "/"), true
+}
+
+// goModuleVersionTag converts a module version into the git ref to compare: the tag (prefixed
+// by the module subdirectory for nested modules) or, for pseudo-versions, the commit hash.
+func goModuleVersionTag(subdir, version string) string {
+	version = strings.TrimSuffix(version, "+incompatible")
+	if rev, ok := goPseudoVersionRevision(version); ok {
+		return rev
+	}
+	if subdir != "" {
+		return subdir + "/" + version
+	}
+	return version
+}
+
+func isGoMajorVersionSuffix(segment string) bool {
+	if len(segment) < 2 || segment[0] != 'v' {
+		return false
+	}
+	for _, r := range segment[1:] {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// goPseudoVersionRevision extracts the 12-character commit hash of a pseudo-version such as
+// v0.0.0-20240101120000-abcdef123456.
+func goPseudoVersionRevision(version string) (string, bool) {
+	i := strings.LastIndexByte(version, '-')
+	if i == -1 || len(version)-i-1 != 12 {
+		return "", false
+	}
+	rev := version[i+1:]
+	stamp := version[:i]
+	j := strings.LastIndexAny(stamp, "-.")
+	if j == -1 || len(stamp)-j-1 != 14 {
+		return "", false
+	}
+	for _, r := range stamp[j+1:] {
+		if r < '0' || r > '9' {
+			return "", false
+		}
+	}
+	return rev, true
+}
+
+// sortBulkResults orders analyzed results by descending risk score, followed by failures and
+// unresolved dependencies, with the dependency name as tie breaker.
+func sortBulkResults(results []BulkAnalyzeResult) {
+	statusRank := map[string]int{BulkStatusOK: 0, BulkStatusError: 1, BulkStatusUnresolved: 2}
+	sort.SliceStable(results, func(i, j int) bool {
+		ri, rj := results[i], results[j]
+		if statusRank[ri.Status] != statusRank[rj.Status] {
+			return statusRank[ri.Status] < statusRank[rj.Status]
+		}
+		if ri.Analysis != nil && rj.Analysis != nil && ri.Analysis.Risk.Score != rj.Analysis.Risk.Score {
+			return ri.Analysis.Risk.Score > rj.Analysis.Risk.Score
+		}
+		return ri.Dependency.Name < rj.Dependency.Name
+	})
+}
+
+func summarizeBulkResults(results []BulkAnalyzeResult) BulkSummary {
+	summary := BulkSummary{Total: len(results)}
+	for _, r := range results {
+		switch r.Status {
+		case BulkStatusOK:
+			summary.Analyzed++
+			if RiskLevelRank(r.Analysis.Risk.Level) > RiskLevelRank(summary.HighestRisk) {
+				summary.HighestRisk = r.Analysis.Risk.Level
+			}
+		case BulkStatusError:
+			summary.Failed++
+		case BulkStatusUnresolved:
+			summary.Unresolved++
+		}
+	}
+	return summary
+}
+
+func analysisErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "request timed out"
+	case errors.Is(err, ErrRepoNotFound):
+		return "repository not found"
+	case errors.Is(err, ErrRateLimited):
+		if resetAt, ok := rateLimitReset(err); ok {
+			return "github rate limit exceeded until " + resetAt.UTC().Format(time.RFC3339)
+		}
+		return "github rate limit exceeded"
+	case errors.Is(err, ErrForbidden):
+		return "github denied access"
+	case errors.Is(err, ErrInvalidModelResponse):
+		return "model returned invalid JSON"
+	case errors.Is(err, ErrModelBusy):
+		return "model is busy, retry later"
+	}
+	var reqErr *RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.Message
+	}
+	return "internal server error"
+}
+
+// BulkAnalyzeHandler serves POST /analyze/bulk.
+func BulkAnalyzeHandler(analyzer *Analyzer) http.HandlerFunc {
+	logger := analyzer.logger()
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := requestLogger(r.Context(), logger).With(zap.String("handler", "analyze_bulk"))
+
+		if r.Method != http.MethodPost {
+			log.Warn("method not allowed", zap.String("method", r.Method))
+			writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+			return
+		}
+
+		var req BulkAnalyzeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Warn("invalid JSON body", zap.Error(err))
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid JSON body"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), analyzer.config().Timeouts.Bulk)
+		defer cancel()
+
+		resp, err := analyzer.BulkAnalyze(ctx, req)
+		if err != nil {
+			handleAnalyzeError(w, err, ctx, log)
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
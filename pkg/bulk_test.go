@@ -0,0 +1,165 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestGoModuleGitHubRepo(t *testing.T) {
+	tests := []struct {
+		module, version string
+		repo, tag       string
+		ok              bool
+	}{
+		{"github.com/spf13/cobra", "v1.8.0", "https://github.com/spf13/cobra", "v1.8.0", true},
+		{"github.com/jackc/pgx/v5", "v5.5.0", "https://github.com/jackc/pgx", "v5.5.0", true},
+		{"github.com/aws/aws-sdk-go-v2/service/s3", "v1.40.0", "https://github.com/aws/aws-sdk-go-v2", "service/s3/v1.40.0", true},
+		{"github.com/docker/docker", "v24.0.7+incompatible", "https://github.com/docker/docker", "v24.0.7", true},
+		{"github.com/octo/hello", "v0.0.0-20240101120000-abcdef123456", "https://github.com/octo/hello", "abcdef123456", true},
+		{"golang.org/x/sys", "v0.20.0", "", "", false},
+	}
+	for _, tt := range tests {
+		repo, subdir, ok := goModuleGitHubRepo(tt.module)
+		if ok != tt.ok || repo != tt.repo {
+			t.Fatalf("goModuleGitHubRepo(%q) = %q, %v; want %q, %v", tt.module, repo, ok, tt.repo, tt.ok)
+		}
+		if !ok {
+			continue
+		}
+		if tag := goModuleVersionTag(subdir, tt.version); tag != tt.tag {
+			t.Fatalf("goModuleVersionTag(%q, %q) = %q; want %q", subdir, tt.version, tag, tt.tag)
+		}
+	}
+}
+
+func TestBulkAnalyzeSortsByRisk(t *testing.T) {
+	ghMux := http.NewServeMux()
+	for _, repo := range []string{"low", "high"} {
+		ghMux.HandleFunc("/repos/octo/"+repo+"/compare/v1.0.0...v1.1.0", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"commits":[],"files":[]}`))
+		})
+		ghMux.HandleFunc("/repos/octo/"+repo+"/releases", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`[]`))
+		})
+	}
+	ghClient := newGitHubTestClient(t, ghMux)
+
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ollamaRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		score := "10"
+		if strings.Contains(req.Prompt, "octo/high") {
+			score = "90"
+		}
+		modelResp := `{"risk":{"level":"low","score":` + score + `,"confidence":"high","reasons":[]},"summary":{"highlights":[],"grouped":[]},"breakers":[],"behaviorChanges":[],"upgradeSteps":[],"evidence":[],"meta":{}}`
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"response": modelResp, "done": true})
+	}))
+	defer ollama.Close()
+
+	analyzer := &Analyzer{GitHub: ghClient, OllamaBaseURL: ollama.URL, Logger: zap.NewNop()}
+
+	before := "require (\n\tgithub.com/octo/low v1.0.0\n\tgithub.com/octo/high v1.0.0\n\tgolang.org/x/sys v0.1.0\n)\n"
+	after := "require (\n\tgithub.com/octo/low v1.1.0\n\tgithub.com/octo/high v1.1.0\n\tgolang.org/x/sys v0.2.0\n)\n"
+	resp, err := analyzer.BulkAnalyze(context.Background(), BulkAnalyzeRequest{Format: FormatGoMod, Before: before, After: after})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(resp.Results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(resp.Results))
+	}
+	wantOrder := []string{"github.com/octo/high", "github.com/octo/low", "golang.org/x/sys"}
+	for i, name := range wantOrder {
+		if resp.Results[i].Dependency.Name != name {
+			t.Fatalf("result %d: expected %s, got %s", i, name, resp.Results[i].Dependency.Name)
+		}
+	}
+	if resp.Results[0].Analysis == nil || resp.Results[0].Analysis.Risk.Level != "high" {
+		t.Fatalf("expected high risk analysis first, got %+v", resp.Results[0])
+	}
+	if resp.Results[2].Status != BulkStatusUnresolved {
+		t.Fatalf("expected unresolved status, got %s", resp.Results[2].Status)
+	}
+	if resp.Summary.Analyzed != 2 || resp.Summary.Unresolved != 1 || resp.Summary.HighestRisk != "high" {
+		t.Fatalf("unexpected summary %+v", resp.Summary)
+	}
+}
+
+func TestBulkAnalyzeHandlerRejectsUnknownFormat(t *testing.T) {
+	handler := BulkAnalyzeHandler(&Analyzer{Logger: zap.NewNop()})
+
+	req := httptest.NewRequest(http.MethodPost, "/analyze/bulk", strings.NewReader(`{"format":"yarn","before":"a","after":"b"}`))
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+	assertErrorJSON(t, rec.Body.Bytes())
+}
+
+func TestBulkAnalyzeHandlerChargesEveryDependencyChange(t *testing.T) {
+	auth := newTestAPIKeyAuth(t, APIKey{ID: "ci", Key: "0123456789abcdef", RequestsPerMinute: 8})
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	auth.now = func() time.Time { return now }
+	limiter := NewRateLimiter(60, 10)
+	limiter.now = func() time.Time { return now }
+	handler := WrapHandler("analyze_bulk", WithAPIKey(auth, WithRateLimit(limiter, WithAnalysisQuota(BulkAnalyzeHandler(&Analyzer{Logger: zap.NewNop()})))), zap.NewNop())
+
+	// Five changes of modules outside github.com: they stay unresolved but are still charged.
+	var before, after strings.Builder
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		before.WriteString("require golang.org/x/" + name + " v0.1.0\n")
+		after.WriteString("require golang.org/x/" + name + " v0.2.0\n")
+	}
+	body, _ := json.Marshal(BulkAnalyzeRequest{Format: FormatGoMod, Before: before.String(), After: after.String()})
+	serve := func(body string) *httptest.ResponseRecorder {
+		req := authRequest("0123456789abcdef")
+		req.Method = http.MethodPost
+		req.Body = io.NopCloser(strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := serve(string(body)); rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if tokens := limiter.buckets["key:ci"].tokens; tokens != 5 {
+		t.Fatalf("expected 5 rate limit tokens to be charged, %v left", tokens)
+	}
+
+	// The quota of 8 requests per minute now has 3 left; the third bulk request goes over it.
+	if rec := serve(string(body)); rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if rec := serve(`{}`); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the request quota to be exhausted, got %d", rec.Code)
+	}
+
+	// The 10 requests charged carry 2 over into the next minute.
+	now = now.Add(time.Minute)
+	for i := 0; i < 6; i++ {
+		if rec := serve(`{}`); rec.Code == http.StatusTooManyRequests {
+			t.Fatalf("request %d: expected quota left, got %d: %s", i, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := serve(`{}`); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the carried-over requests to count, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,575 @@
+package pkg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v2"
+)
+
+// configEnvPrefix prefixes the environment variables that override config file values, e.g.
+// DIFFBREAK_OLLAMA_FAST_MODEL overrides ollama.fast.model.
+const configEnvPrefix = "DIFFBREAK"
+
+// Config holds the service settings. Values are layered: built-in defaults, then the YAML
+// config file, then DIFFBREAK_* environment variables, then command-line flags.
+type Config struct {
+	Server     ServerConfig     `yaml:"server"`
+	GitHub     GitHubConfig     `yaml:"github"`
+	Ollama     OllamaConfig     `yaml:"ollama"`
+	Analysis   AnalysisConfig   `yaml:"analysis"`
+	Timeouts   TimeoutConfig    `yaml:"timeouts"`
+	Watch      WatchConfig      `yaml:"watch"`
+	Webhook    WebhookConfig    `yaml:"webhook"`
+	Auth       AuthConfig       `yaml:"auth"`
+	RateLimit  RateLimitConfig  `yaml:"rate_limit"`
+	ModelQueue ModelQueueConfig `yaml:"model_queue"`
+	Tracing    TracingConfig    `yaml:"tracing"`
+}
+
+// ServerConfig configures the HTTP listener.
+type ServerConfig struct {
+	Port      string `yaml:"port"`
+	Interface string `yaml:"interface"`
+	// CORSOrigins are the browser origins allowed to call the API.
+	CORSOrigins []string `yaml:"cors_origins"`
+
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	// WriteTimeout must leave room for the slowest handler, i.e. timeouts.bulk; 0 disables it.
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+	// ShutdownTimeout is how long in-flight requests and background analyses may keep running
+	// after SIGTERM before they are aborted.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+// GitHubConfig configures GitHub API access.
+type GitHubConfig struct {
+	Token string `yaml:"token"`
+	// Tokens are further personal access tokens pooled with Token; each request uses the one
+	// with the most remaining quota.
+	Tokens []string `yaml:"tokens"`
+	// App authenticates as a GitHub App for repositories of accounts that installed it, which
+	// also covers their private repositories.
+	App GitHubAppConfig `yaml:"app"`
+	// MaxRateLimitWait is how long a GitHub call may wait for an exhausted rate limit to reset
+	// before failing; 0 disables waiting. The request deadline always takes precedence.
+	MaxRateLimitWait time.Duration `yaml:"max_rate_limit_wait"`
+	// GraphQL fetches releases, commits and their pull requests in a few GraphQL queries
+	// instead of paging the REST API. It needs a token or app; failures fall back to REST.
+	// Unset, it is enabled whenever a token or app authenticates the request.
+	GraphQL *bool `yaml:"graphql"`
+}
+
+// GitHubAppConfig configures GitHub App authentication; it is disabled while ID is 0.
+type GitHubAppConfig struct {
+	ID int64 `yaml:"id"`
+	// PrivateKeyFile is the path of the app's PEM private key; PrivateKey holds the key itself
+	// and takes precedence.
+	PrivateKeyFile string `yaml:"private_key_file"`
+	PrivateKey     string `yaml:"private_key"`
+	// AnonymousAccess lets callers without an API key use installation tokens too, which opens
+	// the private repositories of every installed owner to them. By default only API key
+	// callers and signed webhooks do.
+	AnonymousAccess bool `yaml:"anonymous_access"`
+}
+
+// OllamaConfig configures the model server and the model used per analysis mode.
+type OllamaConfig struct {
+	URL  string      `yaml:"url"`
+	Fast ModelConfig `yaml:"fast"`
+	Deep ModelConfig `yaml:"deep"`
+	// Routes override the mode's model for matching analyses; the first match wins.
+	Routes []ModelRoute `yaml:"routes"`
+	// Fallbacks are tried in order when the routed model fails or keeps answering invalid JSON.
+	Fallbacks []ModelFallback `yaml:"fallbacks"`
+}
+
+// ModelFallback is a model of the fallback chain.
+type ModelFallback struct {
+	// URL is the Ollama server to use; empty means ollama.url.
+	URL string `yaml:"url"`
+	// Modes limits the fallback to some analysis modes; empty means all.
+	Modes       []string `yaml:"modes"`
+	ModelConfig `yaml:",inline"`
+}
+
+// ModelConfig selects a model and its generation options.
+type ModelConfig struct {
+	Model string `yaml:"model"`
+	// NumCtx is the context window in tokens; 0 keeps the model's default.
+	NumCtx      int     `yaml:"num_ctx"`
+	NumPredict  int     `yaml:"num_predict"`
+	Temperature float64 `yaml:"temperature"`
+}
+
+// ModelRoute is a routing rule. Every condition that is set must match; settings left unset
+// keep the values of the analysis mode.
+type ModelRoute struct {
+	Name  string   `yaml:"name"`
+	Modes []string `yaml:"modes"`
+	// MinPromptTokens and MaxPromptTokens bound the estimated prompt size; 0 means no bound.
+	MinPromptTokens int `yaml:"min_prompt_tokens"`
+	MaxPromptTokens int `yaml:"max_prompt_tokens"`
+	// Repos are owner/repo names; owner/* matches every repository of an owner.
+	Repos []string `yaml:"repos"`
+	// Clients are API key IDs.
+	Clients []string `yaml:"clients"`
+
+	Model       string   `yaml:"model"`
+	NumCtx      int      `yaml:"num_ctx"`
+	NumPredict  int      `yaml:"num_predict"`
+	Temperature *float64 `yaml:"temperature"`
+}
+
+// modelRouteInput describes an analysis for model routing.
+type modelRouteInput struct {
+	Mode string
+	// Repo is owner/repo.
+	Repo         string
+	Client       string
+	PromptTokens int
+}
+
+func (r ModelRoute) matches(in modelRouteInput) bool {
+	if r.MinPromptTokens > 0 && in.PromptTokens < r.MinPromptTokens {
+		return false
+	}
+	if r.MaxPromptTokens > 0 && in.PromptTokens > r.MaxPromptTokens {
+		return false
+	}
+	return r.matchesAnalysis(in)
+}
+
+// matchesAnalysis is matches without the prompt size, which is only known once the comparison
+// was fetched.
+func (r ModelRoute) matchesAnalysis(in modelRouteInput) bool {
+	if len(r.Modes) > 0 && !slices.Contains(r.Modes, in.Mode) {
+		return false
+	}
+	if len(r.Repos) > 0 && !slices.ContainsFunc(r.Repos, func(pattern string) bool { return matchRepoPattern(pattern, in.Repo) }) {
+		return false
+	}
+	if len(r.Clients) > 0 && !slices.Contains(r.Clients, in.Client) {
+		return false
+	}
+	return true
+}
+
+func matchRepoPattern(pattern, repo string) bool {
+	if owner, ok := strings.CutSuffix(pattern, "/*"); ok {
+		repoOwner, _, _ := strings.Cut(repo, "/")
+		return strings.EqualFold(owner, repoOwner)
+	}
+	return strings.EqualFold(pattern, repo)
+}
+
+// Route returns the model settings for an analysis and the name of the matching route, which is
+// empty when the mode's defaults apply.
+func (c OllamaConfig) Route(in modelRouteInput) (ModelConfig, string) {
+	model := c.ForMode(in.Mode)
+	for i, r := range c.Routes {
+		if !r.matches(in) {
+			continue
+		}
+		if r.Model != "" {
+			model.Model = r.Model
+		}
+		if r.NumCtx > 0 {
+			model.NumCtx = r.NumCtx
+		}
+		if r.NumPredict > 0 {
+			model.NumPredict = r.NumPredict
+		}
+		if r.Temperature != nil {
+			model.Temperature = *r.Temperature
+		}
+		name := r.Name
+		if name == "" {
+			name = "route " + strconv.Itoa(i)
+		}
+		return model, name
+	}
+	return model, ""
+}
+
+// routeScope fingerprints everything that decides the models of an analysis before its prompt
+// size is known: the mode's defaults, the routes that may match and the fallback chain. Analyses
+// with the same comparison and scope are answered by the same models with the same settings.
+func (c OllamaConfig) routeScope(baseURL string, in modelRouteInput) string {
+	scope := struct {
+		Routes []ModelRoute
+		Chain  []modelCandidate
+	}{
+		Chain: c.fallbackChain(baseURL, c.ForMode(in.Mode), in.Mode),
+	}
+	for _, r := range c.Routes {
+		if r.matchesAnalysis(in) {
+			// A route's name and which clients and repositories it lists do not change its models.
+			r.Name, r.Clients, r.Repos = "", nil, nil
+			scope.Routes = append(scope.Routes, r)
+		}
+	}
+	data, _ := json.Marshal(scope)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// ForMode returns the model settings of an analysis mode; thorough uses the deep model.
+func (c OllamaConfig) ForMode(mode string) ModelConfig {
+	if mode == "fast" {
+		return c.Fast
+	}
+	return c.Deep
+}
+
+// modelCandidate is a model together with the Ollama server it runs on.
+type modelCandidate struct {
+	URL   string
+	Model ModelConfig
+}
+
+// fallbackChain returns primary followed by the fallbacks configured for mode. Fallbacks without
+// a URL run on baseURL.
+func (c OllamaConfig) fallbackChain(baseURL string, primary ModelConfig, mode string) []modelCandidate {
+	chain := []modelCandidate{{URL: baseURL, Model: primary}}
+	for _, f := range c.Fallbacks {
+		if len(f.Modes) > 0 && !slices.Contains(f.Modes, mode) {
+			continue
+		}
+		u := f.URL
+		if u == "" {
+			u = baseURL
+		}
+		chain = append(chain, modelCandidate{URL: u, Model: f.ModelConfig})
+	}
+	return chain
+}
+
+// AnalysisConfig bounds the data fed into an analysis.
+type AnalysisConfig struct {
+	// DefaultMaxReleases is used when a request does not set limits.maxReleases.
+	DefaultMaxReleases int `yaml:"default_max_releases"`
+	// MaxReleases is the upper bound requests are clamped to.
+	MaxReleases int `yaml:"max_releases"`
+	// ThoroughSamples is the number of independent analyses merged in thorough mode.
+	ThoroughSamples int              `yaml:"thorough_samples"`
+	Fast            TruncationConfig `yaml:"fast"`
+	Deep            TruncationConfig `yaml:"deep"`
+}
+
+// ForMode returns the truncation limits of an analysis mode; thorough uses the deep limits.
+func (c AnalysisConfig) ForMode(mode string) TruncationConfig {
+	if mode == "fast" {
+		return c.Fast
+	}
+	return c.Deep
+}
+
+// TruncationConfig limits how much of the GitHub data ends up in the prompt; 0 means unlimited.
+type TruncationConfig struct {
+	MaxCommits           int `yaml:"max_commits"`
+	MaxCommitTitleLength int `yaml:"max_commit_title_length"`
+	MaxReleaseNoteLength int `yaml:"max_release_note_length"`
+}
+
+// TimeoutConfig holds request deadlines.
+type TimeoutConfig struct {
+	Analyze time.Duration `yaml:"analyze"`
+	Detect  time.Duration `yaml:"detect"`
+	Bulk    time.Duration `yaml:"bulk"`
+	// ModelCall bounds a single model call so a stuck model leaves time for the fallbacks;
+	// 0 means calls are only bounded by the analysis deadline.
+	ModelCall time.Duration `yaml:"model_call"`
+}
+
+// WatchConfig configures the watch list poller.
+type WatchConfig struct {
+	Store    string        `yaml:"store"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+// WebhookConfig configures the GitHub webhook receiver.
+type WebhookConfig struct {
+	Secret      string `yaml:"secret"`
+	PRComments  bool   `yaml:"pr_comments"`
+	ResultStore string `yaml:"result_store"`
+}
+
+// AuthConfig configures API key authentication.
+type AuthConfig struct {
+	APIKeysFile string `yaml:"api_keys_file"`
+}
+
+// RateLimitConfig configures the per-client token bucket.
+type RateLimitConfig struct {
+	PerMinute  float64 `yaml:"per_minute"`
+	Burst      int     `yaml:"burst"`
+	TrustProxy bool    `yaml:"trust_proxy"`
+}
+
+// ModelQueueConfig configures the global model call queue.
+type ModelQueueConfig struct {
+	Concurrency int           `yaml:"concurrency"`
+	MaxQueued   int           `yaml:"max_queued"`
+	MaxWait     time.Duration `yaml:"max_wait"`
+}
+
+// TracingConfig configures the OpenTelemetry trace exporter.
+type TracingConfig struct {
+	// Endpoint is the host:port of an OTLP/HTTP collector; tracing is disabled when empty.
+	Endpoint string `yaml:"endpoint"`
+	// Insecure sends spans over plain HTTP.
+	Insecure bool `yaml:"insecure"`
+	// SampleRatio is the fraction of new traces recorded; incoming sampled traces are always kept.
+	SampleRatio float64 `yaml:"sample_ratio"`
+	ServiceName string  `yaml:"service_name"`
+}
+
+// DefaultConfig returns the built-in settings.
+func DefaultConfig() Config {
+	return Config{
+		Server: ServerConfig{
+			Port:        "8080",
+			Interface:   "0.0.0.0",
+			CORSOrigins: []string{"https://diffbreak.fyi"},
+
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			WriteTimeout:      11 * time.Minute,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   150 * time.Second,
+		},
+		GitHub: GitHubConfig{
+			MaxRateLimitWait: 10 * time.Second,
+		},
+		Ollama: OllamaConfig{
+			URL:  "http://localhost:11434",
+			Fast: ModelConfig{Model: "qwen2.5:3b", NumPredict: 600, Temperature: 0.2},
+			Deep: ModelConfig{Model: "qwen2.5:7b", NumPredict: 1200, Temperature: 0.2},
+		},
+		Analysis: AnalysisConfig{
+			DefaultMaxReleases: 30,
+			MaxReleases:        60,
+			ThoroughSamples:    3,
+			Fast:               TruncationConfig{MaxCommits: 150, MaxCommitTitleLength: 120, MaxReleaseNoteLength: 1200},
+			Deep:               TruncationConfig{MaxReleaseNoteLength: 5000},
+		},
+		Timeouts: TimeoutConfig{
+			Analyze: 120 * time.Second,
+			Detect:  20 * time.Second,
+			Bulk:    10 * time.Minute,
+		},
+		Watch: WatchConfig{Interval: 15 * time.Minute},
+		RateLimit: RateLimitConfig{
+			PerMinute: 10,
+			Burst:     5,
+		},
+		ModelQueue: ModelQueueConfig{
+			Concurrency: 1,
+			MaxQueued:   16,
+			MaxWait:     60 * time.Second,
+		},
+		Tracing: TracingConfig{
+			SampleRatio: 1,
+			ServiceName: "diffbreak",
+		},
+	}
+}
+
+// LoadConfig returns the defaults overlaid with the YAML file at path (skipped when empty) and
+// DIFFBREAK_* environment variables. The result is not validated so flags can still be applied.
+func LoadConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+		if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+			return Config{}, fmt.Errorf("parse config %s: %w", path, err)
+		}
+	}
+	if err := applyConfigEnv(reflect.ValueOf(&cfg).Elem(), configEnvPrefix, os.LookupEnv); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// applyConfigEnv overrides the fields of v from environment variables named after their YAML
+// path, e.g. DIFFBREAK_TIMEOUTS_ANALYZE for timeouts.analyze. Lists are comma separated.
+func applyConfigEnv(v reflect.Value, prefix string, lookup func(string) (string, bool)) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(tag)
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct {
+			if err := applyConfigEnv(fv, name, lookup); err != nil {
+				return err
+			}
+			continue
+		}
+
+		raw, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		if err := setConfigValue(fv, raw); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func setConfigValue(v reflect.Value, raw string) error {
+	raw = strings.TrimSpace(raw)
+	switch {
+	case v.Kind() == reflect.Pointer:
+		elem := reflect.New(v.Type().Elem())
+		if err := setConfigValue(elem.Elem(), raw); err != nil {
+			return err
+		}
+		v.Set(elem)
+	case v.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+	case v.Kind() == reflect.Int || v.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case v.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported config type %s", v.Type())
+	}
+	return nil
+}
+
+// Validate reports every invalid setting at once.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Port != "", "server.port is required")
+	check(c.Server.ReadHeaderTimeout >= 0 && c.Server.ReadTimeout >= 0 && c.Server.IdleTimeout >= 0,
+		"server read and idle timeouts must not be negative")
+	check(c.Server.WriteTimeout == 0 || c.Server.WriteTimeout > c.Timeouts.Bulk,
+		"server.write_timeout must exceed timeouts.bulk (or be 0)")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	for _, origin := range c.Server.CORSOrigins {
+		u, err := url.Parse(origin)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && (u.Path == "" || u.Path == "/"),
+			"server.cors_origins: %q is not an origin like https://example.com", origin)
+	}
+
+	u, err := url.Parse(c.Ollama.URL)
+	check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "ollama.url must be an http(s) URL")
+	for _, mode := range []string{"fast", "deep"} {
+		m := c.Ollama.ForMode(mode)
+		check(strings.TrimSpace(m.Model) != "", "ollama.%s.model is required", mode)
+		check(m.NumCtx >= 0, "ollama.%s.num_ctx must not be negative", mode)
+		check(m.NumPredict > 0, "ollama.%s.num_predict must be positive", mode)
+		check(m.Temperature >= 0 && m.Temperature <= 2, "ollama.%s.temperature must be between 0 and 2", mode)
+	}
+	for i, r := range c.Ollama.Routes {
+		for _, mode := range r.Modes {
+			check(isAnalysisMode(mode), "ollama.routes[%d].modes: %q is not an analysis mode", i, mode)
+		}
+		for _, repo := range r.Repos {
+			owner, name, ok := strings.Cut(repo, "/")
+			check(ok && owner != "" && name != "" && !strings.Contains(name, "/"), "ollama.routes[%d].repos: %q must be owner/repo or owner/*", i, repo)
+		}
+		check(r.MinPromptTokens >= 0 && r.MaxPromptTokens >= 0, "ollama.routes[%d] prompt token bounds must not be negative", i)
+		check(r.MaxPromptTokens == 0 || r.MinPromptTokens <= r.MaxPromptTokens, "ollama.routes[%d].min_prompt_tokens must not exceed max_prompt_tokens", i)
+		check(r.NumCtx >= 0 && r.NumPredict >= 0, "ollama.routes[%d] num_ctx and num_predict must not be negative", i)
+		check(r.Temperature == nil || (*r.Temperature >= 0 && *r.Temperature <= 2), "ollama.routes[%d].temperature must be between 0 and 2", i)
+	}
+	for i, f := range c.Ollama.Fallbacks {
+		for _, mode := range f.Modes {
+			check(isAnalysisMode(mode), "ollama.fallbacks[%d].modes: %q is not an analysis mode", i, mode)
+		}
+		if f.URL != "" {
+			u, err := url.Parse(f.URL)
+			check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "ollama.fallbacks[%d].url must be an http(s) URL", i)
+		}
+		check(strings.TrimSpace(f.Model) != "", "ollama.fallbacks[%d].model is required", i)
+		check(f.NumCtx >= 0, "ollama.fallbacks[%d].num_ctx must not be negative", i)
+		check(f.NumPredict > 0, "ollama.fallbacks[%d].num_predict must be positive", i)
+		check(f.Temperature >= 0 && f.Temperature <= 2, "ollama.fallbacks[%d].temperature must be between 0 and 2", i)
+	}
+
+	check(c.Analysis.MaxReleases >= 1, "analysis.max_releases must be at least 1")
+	check(c.Analysis.DefaultMaxReleases >= 1 && c.Analysis.DefaultMaxReleases <= c.Analysis.MaxReleases,
+		"analysis.default_max_releases must be between 1 and analysis.max_releases")
+	check(c.Analysis.ThoroughSamples >= 2 && c.Analysis.ThoroughSamples <= 10, "analysis.thorough_samples must be between 2 and 10")
+	for _, mode := range []string{"fast", "deep"} {
+		tr := c.Analysis.ForMode(mode)
+		check(tr.MaxCommits >= 0 && tr.MaxCommitTitleLength >= 0 && tr.MaxReleaseNoteLength >= 0,
+			"analysis.%s truncation limits must not be negative", mode)
+	}
+
+	check(c.GitHub.MaxRateLimitWait >= 0, "github.max_rate_limit_wait must not be negative")
+	check(c.GitHub.App.ID >= 0, "github.app.id must not be negative")
+	check(c.GitHub.App.ID == 0 || c.GitHub.App.PrivateKey != "" || c.GitHub.App.PrivateKeyFile != "",
+		"github.app.private_key or github.app.private_key_file is required with github.app.id")
+	check(c.Timeouts.Analyze > 0, "timeouts.analyze must be positive")
+	check(c.Timeouts.Detect > 0, "timeouts.detect must be positive")
+	check(c.Timeouts.Bulk > 0, "timeouts.bulk must be positive")
+	check(c.Timeouts.ModelCall >= 0, "timeouts.model_call must not be negative")
+	check(c.Watch.Interval > 0, "watch.interval must be positive")
+	check(c.RateLimit.PerMinute >= 0, "rate_limit.per_minute must not be negative")
+	check(c.RateLimit.Burst >= 1, "rate_limit.burst must be at least 1")
+	check(c.ModelQueue.Concurrency >= 1, "model_queue.concurrency must be at least 1")
+	check(c.ModelQueue.MaxQueued >= 0, "model_queue.max_queued must not be negative")
+	check(c.ModelQueue.MaxWait >= 0, "model_queue.max_wait must not be negative")
+
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1")
+	check(c.Tracing.Endpoint == "" || c.Tracing.ServiceName != "", "tracing.service_name is required when tracing is enabled")
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,202 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "diffbreak.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+func TestDefaultConfigIsValid(t *testing.T) {
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Fatalf("expected default config to validate, got %v", err)
+	}
+}
+
+func TestLoadConfigFileAndEnvOverrides(t *testing.T) {
+	path := writeConfigFile(t, `
+server:
+  cors_origins: ["https://a.example", "https://b.example"]
+ollama:
+  fast:
+    model: llama3.2:3b
+analysis:
+  fast:
+    max_commits: 50
+timeouts:
+  analyze: 3m
+`)
+	t.Setenv("DIFFBREAK_OLLAMA_FAST_NUM_PREDICT", "800")
+	t.Setenv("DIFFBREAK_TIMEOUTS_ANALYZE", "90s")
+	t.Setenv("DIFFBREAK_SERVER_CORS_ORIGINS", "https://c.example, https://d.example")
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	fast := cfg.Ollama.ForMode("fast")
+	if fast.Model != "llama3.2:3b" || fast.NumPredict != 800 || fast.Temperature != 0.2 {
+		t.Fatalf("unexpected fast model config %+v", fast)
+	}
+	if cfg.Ollama.Deep != DefaultConfig().Ollama.Deep {
+		t.Fatalf("expected deep model to keep defaults, got %+v", cfg.Ollama.Deep)
+	}
+	if tr := cfg.Analysis.ForMode("fast"); tr.MaxCommits != 50 || tr.MaxCommitTitleLength != 120 {
+		t.Fatalf("unexpected fast truncation %+v", tr)
+	}
+	if cfg.Timeouts.Analyze != 90*time.Second {
+		t.Fatalf("expected env to override the file, got %v", cfg.Timeouts.Analyze)
+	}
+	if got := strings.Join(cfg.Server.CORSOrigins, " "); got != "https://c.example https://d.example" {
+		t.Fatalf("unexpected cors origins %q", got)
+	}
+}
+
+func TestLoadConfigRejectsUnknownKeys(t *testing.T) {
+	path := writeConfigFile(t, "ollama:\n  modle: qwen\n")
+	if _, err := LoadConfig(path); err == nil {
+		t.Fatalf("expected unknown key to be rejected")
+	}
+}
+
+func TestLoadConfigRejectsInvalidEnv(t *testing.T) {
+	t.Setenv("DIFFBREAK_RATE_LIMIT_BURST", "many")
+	_, err := LoadConfig("")
+	if err == nil || !strings.Contains(err.Error(), "DIFFBREAK_RATE_LIMIT_BURST") {
+		t.Fatalf("expected env parse error naming the variable, got %v", err)
+	}
+}
+
+func TestGitHubConfigUseGraphQL(t *testing.T) {
+	cfg, err := LoadConfig("")
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.GitHub.useGraphQL(false) {
+		t.Fatalf("expected GraphQL to be off without credentials")
+	}
+	if !cfg.GitHub.useGraphQL(true) {
+		t.Fatalf("expected GraphQL to be on with the caller's token")
+	}
+	for name, gh := range map[string]GitHubConfig{
+		"token": {Token: "t"},
+		"pool":  {Tokens: []string{"", "t"}},
+		"app":   {App: GitHubAppConfig{ID: 42}},
+	} {
+		if !gh.useGraphQL(false) {
+			t.Fatalf("expected GraphQL to be on with a %s", name)
+		}
+	}
+
+	t.Setenv("DIFFBREAK_GITHUB_TOKEN", "t")
+	t.Setenv("DIFFBREAK_GITHUB_GRAPHQL", "false")
+	cfg, err = LoadConfig("")
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.GitHub.useGraphQL(true) {
+		t.Fatalf("expected github.graphql=false to take precedence over credentials")
+	}
+}
+
+func TestConfigValidateReportsAllErrors(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Ollama.URL = "localhost"
+	cfg.Ollama.Deep.Model = ""
+	cfg.Analysis.DefaultMaxReleases = 100
+	cfg.Timeouts.Detect = 0
+	cfg.Server.CORSOrigins = []string{"https://diffbreak.fyi/app"}
+	cfg.GitHub.App.ID = 42
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatalf("expected validation errors")
+	}
+	for _, want := range []string{"ollama.url", "ollama.deep.model", "analysis.default_max_releases", "timeouts.detect", "server.cors_origins", "github.app.private_key"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to mention %s, got %v", want, err)
+		}
+	}
+}
+
+func TestOllamaConfigRoute(t *testing.T) {
+	cfg := DefaultConfig().Ollama
+	cfg.Routes = []ModelRoute{
+		{Name: "large", Modes: []string{"deep"}, MinPromptTokens: 6000, Model: "qwen2.5:7b-32k", NumCtx: 32768},
+		{Name: "ci", Clients: []string{"ci"}, NumPredict: 400},
+	}
+
+	tests := []struct {
+		name      string
+		in        modelRouteInput
+		wantRoute string
+		want      ModelConfig
+	}{
+		{"mode default", modelRouteInput{Mode: "deep", PromptTokens: 1000}, "", cfg.Deep},
+		{"large prompt", modelRouteInput{Mode: "deep", PromptTokens: 8000, Client: "ci"}, "large",
+			ModelConfig{Model: "qwen2.5:7b-32k", NumCtx: 32768, NumPredict: cfg.Deep.NumPredict, Temperature: cfg.Deep.Temperature}},
+		{"large prompt in fast mode", modelRouteInput{Mode: "fast", PromptTokens: 8000}, "", cfg.Fast},
+		{"caller", modelRouteInput{Mode: "fast", Client: "ci"}, "ci",
+			ModelConfig{Model: cfg.Fast.Model, NumPredict: 400, Temperature: cfg.Fast.Temperature}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, route := cfg.Route(tt.in)
+			if route != tt.wantRoute || got != tt.want {
+				t.Fatalf("got %+v via %q, want %+v via %q", got, route, tt.want, tt.wantRoute)
+			}
+		})
+	}
+}
+
+func TestConfigValidateRoutes(t *testing.T) {
+	cfg := DefaultConfig()
+	hot := 3.0
+	cfg.Ollama.Routes = []ModelRoute{{Modes: []string{"slow"}, Repos: []string{"octo"}, MinPromptTokens: 10, MaxPromptTokens: 5, Temperature: &hot}}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatalf("expected validation errors")
+	}
+	for _, want := range []string{"modes", "repos", "min_prompt_tokens", "temperature"} {
+		if !strings.Contains(err.Error(), "ollama.routes[0]") || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to mention routes[0] %s, got %v", want, err)
+		}
+	}
+}
+
+func TestRouteScope(t *testing.T) {
+	cfg := DefaultConfig().Ollama
+	cfg.Routes = []ModelRoute{
+		{Name: "premium", Clients: []string{"premium"}, Model: "big"},
+		{Name: "large prompts", MinPromptTokens: 4000, Model: "long"},
+	}
+	scope := func(client string) string {
+		return cfg.routeScope("http://ollama", modelRouteInput{Mode: "fast", Repo: "octo/hello", Client: client})
+	}
+
+	if scope("basic") != scope("other") {
+		t.Fatalf("expected clients without a route of their own to share a scope")
+	}
+	if scope("basic") == scope("premium") {
+		t.Fatalf("expected a client routed to another model to get its own scope")
+	}
+	deep := cfg.routeScope("http://ollama", modelRouteInput{Mode: "deep", Repo: "octo/hello", Client: "basic"})
+	if deep == scope("basic") {
+		t.Fatalf("expected modes with different models to get different scopes")
+	}
+}
@@ -0,0 +1,294 @@
+package pkg
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"go.uber.org/zap"
+)
+
+// breakerSimilarityThreshold is the word overlap (Jaccard index) above which two breaker titles
+// are considered the same breaking change.
+const breakerSimilarityThreshold = 0.5
+
+// generateSamples runs the prompt samples times concurrently (bounded by the model queue) and
+// merges the valid analyses with mergeAnalysisSamples. The model and fallback flag reported are
+// those of the representative sample the merged sections come from. Failed samples are dropped;
+// it only fails when no sample succeeded.
+func (a *Analyzer) generateSamples(ctx context.Context, prompt string, chain []modelCandidate, callTimeout time.Duration, samples int, rollback bool, log *zap.Logger) (AnalyzeResponse, ModelConfig, bool, error) {
+	type sample struct {
+		resp     AnalyzeResponse
+		producer ModelConfig
+		fallback bool
+		err      error
+	}
+	results := make([]sample, samples)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s := &results[i]
+			s.resp, s.producer, s.fallback, s.err = a.generateWithFallback(ctx, prompt, chain, callTimeout, rollback, log.With(zap.Int("sample", i)))
+		}()
+	}
+	wg.Wait()
+
+	var (
+		valid    []AnalyzeResponse
+		sources  []sample
+		firstErr error
+	)
+	for _, s := range results {
+		if s.err != nil {
+			if firstErr == nil {
+				firstErr = s.err
+			}
+			continue
+		}
+		valid = append(valid, s.resp)
+		sources = append(sources, s)
+	}
+	if len(valid) == 0 {
+		return AnalyzeResponse{}, ModelConfig{}, false, firstErr
+	}
+	if len(valid) < samples {
+		log.Warn("some samples failed", zap.Int("samples", samples), zap.Int("valid", len(valid)), zap.Error(firstErr))
+	}
+	representative := sources[representativeSample(valid)]
+	return mergeAnalysisSamples(valid), representative.producer, representative.fallback, nil
+}
+
+// mergeAnalysisSamples combines independent analyses of the same upgrade. The risk score is the
+// median of the sample scores, breakers and the findings of each rollback section are clustered
+// by title similarity and kept when at least half of the samples report them, and the confidence
+// reflects how much the samples agree. The remaining sections, including the rollback steps,
+// come from the sample whose score is closest to the median.
+func mergeAnalysisSamples(samples []AnalyzeResponse) AnalyzeResponse {
+	scores := make([]int, len(samples))
+	for i, s := range samples {
+		scores[i] = s.Risk.Score
+	}
+	median := medianScore(scores)
+
+	merged := samples[representativeSample(samples)]
+	merged.Risk.Score = median
+	merged.Risk.Level = riskLevelForScore(median)
+
+	minSupport := (len(samples) + 1) / 2
+	breakers := make([][]Breaker, len(samples))
+	for i, s := range samples {
+		breakers[i] = s.Breakers
+	}
+	clusters := clusterBreakers(breakers)
+	merged.Breakers = supportedBreakers(clusters, minSupport)
+
+	if merged.Rollback != nil {
+		rollback := *merged.Rollback
+		var sectionClusters []breakerCluster
+		rollback.RemovedFeatures, sectionClusters = mergeRollbackChanges(samples, minSupport, func(r *RollbackInfo) []RollbackChange { return r.RemovedFeatures })
+		clusters = append(clusters, sectionClusters...)
+		rollback.IrreversibleMigrations, sectionClusters = mergeRollbackChanges(samples, minSupport, func(r *RollbackInfo) []RollbackChange { return r.IrreversibleMigrations })
+		clusters = append(clusters, sectionClusters...)
+		rollback.DataFormatChanges, sectionClusters = mergeRollbackChanges(samples, minSupport, func(r *RollbackInfo) []RollbackChange { return r.DataFormatChanges })
+		clusters = append(clusters, sectionClusters...)
+		merged.Rollback = &rollback
+	}
+
+	merged.Risk.Confidence = sampleAgreement(samples, scores, median, clusters)
+	merged.Meta.SampleScores = scores
+	return merged
+}
+
+// representativeSample returns the index of the first sample whose score is closest to the
+// median of all scores.
+func representativeSample(samples []AnalyzeResponse) int {
+	scores := make([]int, len(samples))
+	for i, s := range samples {
+		scores[i] = s.Risk.Score
+	}
+	median := medianScore(scores)
+
+	representative := 0
+	for i, score := range scores {
+		if absInt(score-median) < absInt(scores[representative]-median) {
+			representative = i
+		}
+	}
+	return representative
+}
+
+// mergeRollbackChanges clusters one section of the samples' rollback analyses the way breakers
+// are clustered and returns the changes reported by at least minSupport samples, together with
+// the clusters for sampleAgreement.
+func mergeRollbackChanges(samples []AnalyzeResponse, minSupport int, section func(*RollbackInfo) []RollbackChange) ([]RollbackChange, []breakerCluster) {
+	lists := make([][]Breaker, len(samples))
+	for i, s := range samples {
+		if s.Rollback == nil {
+			continue
+		}
+		for _, c := range section(s.Rollback) {
+			lists[i] = append(lists[i], Breaker(c))
+		}
+	}
+	clusters := clusterBreakers(lists)
+	changes := []RollbackChange{}
+	for _, b := range supportedBreakers(clusters, minSupport) {
+		changes = append(changes, RollbackChange(b))
+	}
+	return changes, clusters
+}
+
+// supportedBreakers merges the clusters reported by at least minSupport samples.
+func supportedBreakers(clusters []breakerCluster, minSupport int) []Breaker {
+	breakers := []Breaker{}
+	for _, c := range clusters {
+		if c.support >= minSupport {
+			breakers = append(breakers, c.merged())
+		}
+	}
+	return breakers
+}
+
+// sampleAgreement grades the agreement of the samples as high, medium or low confidence from the
+// spread of their scores, how many share the merged risk level and how consistently breakers and
+// rollback findings were reported.
+func sampleAgreement(samples []AnalyzeResponse, scores []int, median int, clusters []breakerCluster) string {
+	level := riskLevelForScore(median)
+	sameLevel := 0
+	for _, score := range scores {
+		if riskLevelForScore(score) == level {
+			sameLevel++
+		}
+	}
+	levelAgreement := float64(sameLevel) / float64(len(samples))
+	spread := slices.Max(scores) - slices.Min(scores)
+
+	breakerAgreement := 1.0
+	if len(clusters) > 0 {
+		var sum float64
+		for _, c := range clusters {
+			sum += float64(c.support) / float64(len(samples))
+		}
+		breakerAgreement = sum / float64(len(clusters))
+	}
+
+	switch {
+	case levelAgreement == 1 && spread <= 15 && breakerAgreement >= 0.75:
+		return "high"
+	case levelAgreement < 0.6 || spread > 35 || breakerAgreement < 0.5:
+		return "low"
+	default:
+		return "medium"
+	}
+}
+
+// breakerCluster groups the breakers of different samples that describe the same change.
+type breakerCluster struct {
+	breakers []Breaker
+	words    map[string]bool
+	// support is the number of samples that reported the breaker.
+	support int
+}
+
+// clusterBreakers clusters the breakers reported by each sample, one list per sample.
+func clusterBreakers(samples [][]Breaker) []breakerCluster {
+	var clusters []breakerCluster
+	for _, breakers := range samples {
+		seen := make(map[int]bool)
+		for _, b := range breakers {
+			words := titleWords(b.Title)
+			best, bestScore := -1, 0.0
+			for i := range clusters {
+				if score := jaccard(words, clusters[i].words); score > bestScore {
+					best, bestScore = i, score
+				}
+			}
+			if best < 0 || bestScore < breakerSimilarityThreshold {
+				clusters = append(clusters, breakerCluster{words: words})
+				best = len(clusters) - 1
+			}
+			clusters[best].breakers = append(clusters[best].breakers, b)
+			if !seen[best] {
+				seen[best] = true
+				clusters[best].support++
+			}
+		}
+	}
+	// Stable so breakers supported equally keep the order of the first sample reporting them.
+	slices.SortStableFunc(clusters, func(a, b breakerCluster) int { return b.support - a.support })
+	return clusters
+}
+
+// merged returns the first reported breaker of the cluster with the most common severity and the
+// evidence of every sample.
+func (c breakerCluster) merged() Breaker {
+	out := c.breakers[0]
+	counts := make(map[string]int)
+	for _, b := range c.breakers {
+		counts[b.Severity]++
+		if counts[b.Severity] > counts[out.Severity] {
+			out.Severity = b.Severity
+		}
+	}
+
+	out.Evidence = []EvidenceLink{}
+	seen := make(map[string]bool)
+	for _, b := range c.breakers {
+		for _, e := range b.Evidence {
+			key := e.Url
+			if key == "" {
+				key = e.Label
+			}
+			if !seen[key] {
+				seen[key] = true
+				out.Evidence = append(out.Evidence, e)
+			}
+		}
+	}
+	return out
+}
+
+func titleWords(title string) map[string]bool {
+	words := make(map[string]bool)
+	for _, w := range strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '.' && r != '_'
+	}) {
+		words[w] = true
+	}
+	return words
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	intersection := 0
+	for w := range a {
+		if b[w] {
+			intersection++
+		}
+	}
+	return float64(intersection) / float64(len(a)+len(b)-intersection)
+}
+
+func medianScore(scores []int) int {
+	sorted := slices.Clone(scores)
+	slices.Sort(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[mid]
+	}
+	return (sorted[mid-1] + sorted[mid] + 1) / 2
+}
+
+func absInt(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
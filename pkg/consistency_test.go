@@ -0,0 +1,191 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+)
+
+func sampleResponse(score int, breakers ...Breaker) AnalyzeResponse {
+	return AnalyzeResponse{
+		Risk:     RiskInfo{Score: score, Level: riskLevelForScore(score), Confidence: "high", Reasons: []string{fmt.Sprintf("score %d", score)}},
+		Breakers: breakers,
+	}
+}
+
+func TestMergeAnalysisSamples(t *testing.T) {
+	removed := Breaker{Title: "Removed the Client.Do method", Severity: "high", Evidence: []EvidenceLink{{Label: "PR 1", Url: "https://github.com/octo/hello/pull/1"}}}
+	removedAgain := Breaker{Title: "Client.Do method removed", Severity: "medium", Evidence: []EvidenceLink{{Label: "PR 2", Url: "https://github.com/octo/hello/pull/2"}}}
+	removedThird := Breaker{Title: "removed Client.Do", Severity: "high", Evidence: []EvidenceLink{{Label: "PR 1", Url: "https://github.com/octo/hello/pull/1"}}}
+	hallucinated := Breaker{Title: "Dropped support for Windows", Severity: "high"}
+
+	merged := mergeAnalysisSamples([]AnalyzeResponse{
+		sampleResponse(70, removed),
+		sampleResponse(40, removedAgain, hallucinated),
+		sampleResponse(55, removedThird),
+	})
+
+	if merged.Risk.Score != 55 || merged.Risk.Level != riskLevelForScore(55) {
+		t.Fatalf("expected median score 55, got %d %s", merged.Risk.Score, merged.Risk.Level)
+	}
+	if merged.Risk.Reasons[0] != "score 55" {
+		t.Fatalf("expected the sections of the median sample, got %v", merged.Risk.Reasons)
+	}
+	if len(merged.Breakers) != 1 {
+		t.Fatalf("expected the single-sample breaker to be dropped, got %+v", merged.Breakers)
+	}
+	b := merged.Breakers[0]
+	if b.Title != removed.Title || b.Severity != "high" || len(b.Evidence) != 2 {
+		t.Fatalf("unexpected merged breaker %+v", b)
+	}
+	if merged.Risk.Confidence != "medium" {
+		t.Fatalf("expected medium confidence when one sample disagrees on the level, got %s", merged.Risk.Confidence)
+	}
+	if !slices.Equal(merged.Meta.SampleScores, []int{70, 40, 55}) {
+		t.Fatalf("unexpected sample scores %v", merged.Meta.SampleScores)
+	}
+}
+
+func TestMergeAnalysisSamplesConfidence(t *testing.T) {
+	b := Breaker{Title: "Removed the Client.Do method", Severity: "high"}
+	tests := []struct {
+		name    string
+		samples []AnalyzeResponse
+		want    string
+	}{
+		{"agreeing", []AnalyzeResponse{sampleResponse(80, b), sampleResponse(85, b), sampleResponse(78, b)}, "high"},
+		{"same level, breaker disputed", []AnalyzeResponse{sampleResponse(80, b), sampleResponse(85), sampleResponse(78, b)}, "medium"},
+		{"split levels", []AnalyzeResponse{sampleResponse(20), sampleResponse(50), sampleResponse(80)}, "low"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeAnalysisSamples(tt.samples).Risk.Confidence; got != tt.want {
+				t.Fatalf("expected %s confidence, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMergeAnalysisSamplesRollback(t *testing.T) {
+	rollbackSample := func(score int, migrations ...RollbackChange) AnalyzeResponse {
+		resp := sampleResponse(score)
+		resp.Rollback = &RollbackInfo{
+			RemovedFeatures:        []RollbackChange{{Title: "Streaming API removed", Severity: "medium"}},
+			IrreversibleMigrations: migrations,
+			DataFormatChanges:      []RollbackChange{},
+			Steps:                  []UpgradeStep{{Step: fmt.Sprintf("steps of %d", score)}},
+		}
+		return resp
+	}
+	migration := RollbackChange{Title: "Schema migration 42 drops the legacy column", Severity: "high", Evidence: []EvidenceLink{{Label: "PR 1", Url: "https://github.com/octo/hello/pull/1"}}}
+	migrationAgain := RollbackChange{Title: "migration 42 drops legacy column", Severity: "high", Evidence: []EvidenceLink{{Label: "PR 2", Url: "https://github.com/octo/hello/pull/2"}}}
+	hallucinated := RollbackChange{Title: "Cache files are encrypted", Severity: "high"}
+
+	merged := mergeAnalysisSamples([]AnalyzeResponse{
+		rollbackSample(72, migration),
+		rollbackSample(70, hallucinated),
+		rollbackSample(75, migrationAgain),
+	})
+
+	if merged.Rollback == nil {
+		t.Fatalf("expected a merged rollback section")
+	}
+	migrations := merged.Rollback.IrreversibleMigrations
+	if len(migrations) != 1 || migrations[0].Title != migration.Title || len(migrations[0].Evidence) != 2 {
+		t.Fatalf("expected the migration reported twice to be merged, got %+v", migrations)
+	}
+	if len(merged.Rollback.RemovedFeatures) != 1 || len(merged.Rollback.DataFormatChanges) != 0 {
+		t.Fatalf("unexpected merged sections %+v", merged.Rollback)
+	}
+	if merged.Rollback.Steps[0].Step != "steps of 72" {
+		t.Fatalf("expected the steps of the median sample, got %+v", merged.Rollback.Steps)
+	}
+	// Scores and levels agree, but the irreversible migrations do not.
+	if merged.Risk.Confidence != "medium" {
+		t.Fatalf("expected disputed rollback findings to lower the confidence, got %s", merged.Risk.Confidence)
+	}
+}
+
+func TestAnalyzeThoroughSamplesModel(t *testing.T) {
+	ghMux := http.NewServeMux()
+	emptyCompareMux(ghMux, "octo", "hello", "v1.0.0", "v1.1.0")
+
+	var calls atomic.Int32
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		if n == 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		answer := fmt.Sprintf(`{"risk":{"level":"low","score":%d,"confidence":"high","reasons":[]},"summary":{"highlights":[],"grouped":[]},"breakers":[],"behaviorChanges":[],"upgradeSteps":[],"evidence":[],"meta":{}}`, 20+int(n)*10)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"response": answer, "done": true})
+	}))
+	defer ollama.Close()
+
+	cfg := DefaultConfig()
+	cfg.Analysis.ThoroughSamples = 4
+	analyzer := &Analyzer{GitHub: newGitHubTestClient(t, ghMux), OllamaBaseURL: ollama.URL, Config: &cfg}
+
+	resp, err := analyzer.Analyze(context.Background(), AnalyzeRequest{RepoUrl: "https://github.com/octo/hello", FromTag: "v1.0.0", ToTag: "v1.1.0", Mode: "thorough"})
+	if err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	if calls.Load() != 4 {
+		t.Fatalf("expected 4 model calls, got %d", calls.Load())
+	}
+	if len(resp.Meta.SampleScores) != 3 {
+		t.Fatalf("expected the failed sample to be dropped, got scores %v", resp.Meta.SampleScores)
+	}
+	if resp.Meta.Model != cfg.Ollama.Deep.Model {
+		t.Fatalf("expected thorough mode to use the deep model, got %q", resp.Meta.Model)
+	}
+	if resp.Risk.Score != medianScore(resp.Meta.SampleScores) {
+		t.Fatalf("expected median score, got %d for %v", resp.Risk.Score, resp.Meta.SampleScores)
+	}
+}
+
+func TestAnalyzeThoroughReportsRepresentativeModel(t *testing.T) {
+	ghMux := http.NewServeMux()
+	emptyCompareMux(ghMux, "octo", "hello", "v1.0.0", "v1.1.0")
+
+	var deepCalls atomic.Int32
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ollamaRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		score := 90
+		if req.Model != "backup" {
+			// The first deep call fails, so one sample is answered by the fallback model.
+			if deepCalls.Add(1) == 1 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			score = 40
+		}
+		answer := fmt.Sprintf(`{"risk":{"level":"medium","score":%d,"confidence":"high","reasons":[]},"summary":{"highlights":[],"grouped":[]},"breakers":[],"behaviorChanges":[],"upgradeSteps":[],"evidence":[],"meta":{}}`, score)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"response": answer, "done": true})
+	}))
+	defer ollama.Close()
+
+	cfg := DefaultConfig()
+	cfg.Analysis.ThoroughSamples = 3
+	cfg.Ollama.Fallbacks = []ModelFallback{{ModelConfig: ModelConfig{Model: "backup", NumPredict: 100}}}
+	analyzer := &Analyzer{GitHub: newGitHubTestClient(t, ghMux), OllamaBaseURL: ollama.URL, Config: &cfg}
+
+	resp, err := analyzer.Analyze(context.Background(), AnalyzeRequest{RepoUrl: "https://github.com/octo/hello", FromTag: "v1.0.0", ToTag: "v1.1.0", Mode: "thorough"})
+	if err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	if resp.Risk.Score != 40 {
+		t.Fatalf("expected the median of %v, got %d", resp.Meta.SampleScores, resp.Risk.Score)
+	}
+	if resp.Meta.Model != cfg.Ollama.Deep.Model || resp.Meta.Fallback {
+		t.Fatalf("expected the model of the representative deep-model sample, got %q (fallback %t)", resp.Meta.Model, resp.Meta.Fallback)
+	}
+}
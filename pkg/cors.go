@@ -1,18 +1,27 @@
 package pkg
 
-import "net/http"
+import (
+	"net/http"
+	"slices"
+)
 
 const allowedOrigin = "https://diffbreak.fyi"
 
 // WithCORS applies a minimal CORS policy for diffbreak.fyi.
 func WithCORS(handler http.Handler) http.Handler {
+	return WithCORSOrigins([]string{allowedOrigin}, handler)
+}
+
+// WithCORSOrigins applies a minimal CORS policy allowing the given browser origins.
+func WithCORSOrigins(origins []string, handler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		origin := r.Header.Get("Origin")
-		if origin == allowedOrigin {
-			w.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
+		if origin != "" && slices.Contains(origins, origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
 			w.Header().Set("Vary", "Origin")
-			w.Header().Set("Access-Control-Allow-Methods", "GET,POST,OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,PATCH,DELETE,OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+RequestIDHeader+", "+GitHubTokenHeader)
+			w.Header().Set("Access-Control-Expose-Headers", RequestIDHeader)
 			w.Header().Set("Access-Control-Max-Age", "86400")
 		}
 
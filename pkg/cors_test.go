@@ -0,0 +1,31 @@
+package pkg
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWithCORSOriginsPreflightAllowsWatchMethods(t *testing.T) {
+	handler := WithCORSOrigins([]string{"https://app.example.com"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("expected the preflight not to reach the handler")
+	}))
+
+	req := httptest.NewRequest(http.MethodOptions, "/watches/abc", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodDelete)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d", http.StatusNoContent, rec.Code)
+	}
+	methods := strings.Split(rec.Header().Get("Access-Control-Allow-Methods"), ",")
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		if !slices.Contains(methods, method) {
+			t.Fatalf("expected %s in Access-Control-Allow-Methods, got %v", method, methods)
+		}
+	}
+}
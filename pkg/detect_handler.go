@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
-	"time"
 
 	"github.com/google/go-github/v83/github"
 	"go.uber.org/zap"
@@ -13,30 +12,45 @@ import (
 
 // DetectHandler serves /detect and returns tag information for a given GitHub repo.
 func DetectHandler(gh *github.Client, logger *zap.Logger) http.HandlerFunc {
-	if logger == nil {
-		logger = zap.NewNop()
-	}
+	return NewDetectHandler(&Analyzer{GitHub: gh, Logger: logger})
+}
+
+// NewDetectHandler serves /detect using the Analyzer's GitHub client and, for
+// ?package=...&ecosystem=... lookups, its package resolver.
+func NewDetectHandler(analyzer *Analyzer) http.HandlerFunc {
+	logger := analyzer.logger()
 	return func(w http.ResponseWriter, r *http.Request) {
-		log := logger.With(zap.String("handler", "detect"))
+		log := requestLogger(r.Context(), logger).With(zap.String("handler", "detect"))
+
+		ctx, cancel := context.WithTimeout(r.Context(), analyzer.config().Timeouts.Detect)
+		defer cancel()
 
 		repoURL := r.URL.Query().Get("repo")
+		var resolved *ResolvedPackage
+		if packageName := r.URL.Query().Get("package"); repoURL == "" && packageName != "" {
+			ecosystem := r.URL.Query().Get("ecosystem")
+			pkgInfo, err := analyzer.ResolvePackage(ctx, ecosystem, packageName)
+			if err != nil {
+				handleAnalyzeError(w, err, ctx, log.With(zap.String("package", packageName), zap.String("ecosystem", ecosystem)))
+				return
+			}
+			resolved = &pkgInfo
+			repoURL = pkgInfo.RepoUrl
+		}
+
 		if repoURL == "" {
 			log.Warn("missing repo parameter")
 			http.Error(w, "missing repo parameter", http.StatusBadRequest)
 			return
 		}
 
-		owner, repo, err := ParseGitHubRepoURL(repoURL)
-		if err != nil {
+		if _, _, err := ParseGitHubRepoURL(repoURL); err != nil {
 			log.Warn("invalid repoUrl", zap.String("repo_url", repoURL))
 			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid repoUrl"})
 			return
 		}
 
-		ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
-		defer cancel()
-
-		tags, err := GetRepoTags(ctx, gh, repoURL)
+		resp, err := Detect(ctx, analyzer.githubClient(ctx), repoURL)
 		if err != nil {
 			if errors.Is(err, ErrRepoNotFound) {
 				log.Warn("repository not found", zap.String("repo_url", repoURL))
@@ -44,8 +58,12 @@ func DetectHandler(gh *github.Client, logger *zap.Logger) http.HandlerFunc {
 				return
 			}
 			if errors.Is(err, ErrRateLimited) {
-				log.Warn("github rate limit exceeded", zap.String("repo_url", repoURL))
-				http.Error(w, "github rate limit exceeded", http.StatusTooManyRequests)
+				writeGitHubRateLimited(w, err, log.With(zap.String("repo_url", repoURL)))
+				return
+			}
+			if errors.Is(err, ErrForbidden) {
+				log.Warn("github denied access", zap.String("repo_url", repoURL), zap.Error(err))
+				http.Error(w, "github denied access", http.StatusBadGateway)
 				return
 			}
 			log.Error("failed to fetch tags", zap.String("repo_url", repoURL), zap.Error(err))
@@ -53,15 +71,7 @@ func DetectHandler(gh *github.Client, logger *zap.Logger) http.HandlerFunc {
 			return
 		}
 
-		resp := DetectResponse{
-			Repo: RepoInfo{
-				Url:      repoURL,
-				Owner:    owner,
-				Name:     repo,
-				Provider: "github",
-			},
-			Tags: tags,
-		}
+		resp.Package = resolved
 
 		w.Header().Set("Content-Type", "application/json")
 		err = json.NewEncoder(w).Encode(resp)
@@ -71,3 +81,26 @@ func DetectHandler(gh *github.Client, logger *zap.Logger) http.HandlerFunc {
 		}
 	}
 }
+
+// Detect lists the tags of a GitHub repository and describes it as a DetectResponse.
+func Detect(ctx context.Context, gh *github.Client, repoURL string) (DetectResponse, error) {
+	owner, repo, err := ParseGitHubRepoURL(repoURL)
+	if err != nil {
+		return DetectResponse{}, err
+	}
+
+	tags, err := GetRepoTags(ctx, gh, repoURL)
+	if err != nil {
+		return DetectResponse{}, err
+	}
+
+	return DetectResponse{
+		Repo: RepoInfo{
+			Url:      repoURL,
+			Owner:    owner,
+			Name:     repo,
+			Provider: "github",
+		},
+		Tags: tags,
+	}, nil
+}
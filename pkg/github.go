@@ -3,6 +3,8 @@ package pkg
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/http"
 	"net/url"
 	"strings"
 	"time"
@@ -15,24 +17,48 @@ var (
 	ErrRateLimited    = errors.New("github rate limited")
 	ErrTooManyTags    = errors.New("too many tags")
 	ErrInvalidRepoURL = errors.New("invalid github repo url")
+	ErrNotModified    = errors.New("not modified")
 )
 
 func GetRepoTags(ctx context.Context, gh *github.Client, repoURL string) ([]string, error) {
+	tags, _, err := GetRepoTagsWithETag(ctx, gh, repoURL, "")
+	return tags, err
+}
+
+// GetRepoTagsWithETag lists tags like GetRepoTags but sends etag as If-None-Match for the first
+// page and returns the ETag of the current listing. ErrNotModified is returned when the tags did
+// not change, which does not count against the GitHub rate limit. The ETag only covers the
+// first page, so none is returned for listings of more than one page: a new tag on a later
+// page would go unnoticed otherwise.
+func GetRepoTagsWithETag(ctx context.Context, gh *github.Client, repoURL, etag string) ([]string, string, error) {
 	owner, repo, err := ParseGitHubRepoURL(repoURL)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	var tags []string
-	opt := &github.ListOptions{PerPage: 100}
+	newETag := ""
+	page := 1
 
 	for {
+		req, err := gh.NewRequest(http.MethodGet, fmt.Sprintf("repos/%v/%v/tags?per_page=100&page=%d", owner, repo, page), nil)
+		if err != nil {
+			return nil, "", err
+		}
+		if page == 1 && etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+
+		var ghTags []*github.RepositoryTag
 		startList := time.Now()
-		ghTags, resp, err := gh.Repositories.ListTags(ctx, owner, repo, opt)
+		resp, err := gh.Do(ctx, req, &ghTags)
 		mappedErr := mapGitHubError(err)
-		observeGitHubRequest("list_tags", mappedErr, time.Since(startList))
+		observeGitHubRequest(ctx, "list_tags", mappedErr, startList)
 		if mappedErr != nil {
-			return nil, mappedErr
+			return nil, "", mappedErr
+		}
+		if page == 1 && resp != nil {
+			newETag = resp.Header.Get("ETag")
 		}
 
 		for _, t := range ghTags {
@@ -44,10 +70,11 @@ func GetRepoTags(ctx context.Context, gh *github.Client, repoURL string) ([]stri
 		if resp == nil || resp.NextPage == 0 {
 			break
 		}
-		opt.Page = resp.NextPage
+		newETag = ""
+		page = resp.NextPage
 	}
 
-	return tags, nil
+	return tags, newETag, nil
 }
 
 func ParseGitHubRepoURL(repoURL string) (owner string, repo string, err error) {
@@ -0,0 +1,514 @@
+package pkg
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v83/github"
+	"go.uber.org/zap"
+)
+
+const (
+	// appJWTLifetime stays below GitHub's 10 minute maximum for app JWTs.
+	appJWTLifetime = 9 * time.Minute
+	// installationTokenRefresh renews installation tokens this long before they expire.
+	installationTokenRefresh = 5 * time.Minute
+	// installationLookupTTL is how long an owner's installation, or its absence, is cached.
+	installationLookupTTL = 10 * time.Minute
+)
+
+// NewGitHubHTTPClient builds the HTTP client for the GitHub API from cfg: requests are
+// authenticated with a GitHub App installation token for owners that installed the app and
+// with the pooled personal tokens otherwise, wait for close rate limit resets and forward the
+// request ID. Failures to get an installation token are logged to logger, which may be nil.
+func NewGitHubHTTPClient(cfg GitHubConfig, logger *zap.Logger) (*http.Client, error) {
+	auth := &GitHubAuthTransport{Pool: NewGitHubTokenPool(cfg.PoolTokens()), Logger: logger, AnonymousAppAccess: cfg.App.AnonymousAccess}
+	if cfg.App.ID != 0 {
+		key, err := cfg.App.privateKey()
+		if err != nil {
+			return nil, err
+		}
+		app, err := NewGitHubApp(cfg.App.ID, key)
+		if err != nil {
+			return nil, err
+		}
+		auth.App = app
+	}
+	transport := &RequestIDTransport{Base: &GitHubRateLimitTransport{Base: auth, MaxWait: cfg.MaxRateLimitWait}}
+	return &http.Client{Transport: transport}, nil
+}
+
+// GitHubAuthTransport authenticates GitHub API requests. Requests for repositories of an owner
+// that installed the GitHub App use the installation's token when the caller may use the App
+// (see withGitHubAppAccess); all others use the pooled token
+// with the most remaining quota, or go out unauthenticated when the pool is empty. Requests
+// that already carry an Authorization header are left alone.
+type GitHubAuthTransport struct {
+	// Base is the underlying transport; http.DefaultTransport when nil.
+	Base http.RoundTripper
+	Pool *GitHubTokenPool
+	App  *GitHubApp
+	// Logger reports installation token failures, after which the request falls back to the
+	// pool; nil discards them.
+	Logger *zap.Logger
+	// AnonymousAppAccess uses installation tokens for requests without withGitHubAppAccess too.
+	AnonymousAppAccess bool
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *GitHubAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if req.Header.Get("Authorization") != "" {
+		return base.RoundTrip(req)
+	}
+
+	if t.App != nil && (t.AnonymousAppAccess || hasGitHubAppAccess(req.Context())) {
+		owner := repoOwnerFromPath(req.URL.Path)
+		if owner == "" {
+			owner = githubRepoOwner(req.Context())
+		}
+		if owner != "" {
+			token, err := t.App.installationToken(req.Context(), base, apiBaseURL(req.URL), owner)
+			if err != nil {
+				// The pool still covers public repositories, so a GitHub App outage does not
+				// fail every request.
+				t.logger(req.Context()).Warn("github app installation token failed; using the token pool",
+					zap.String("owner", owner), zap.Error(err))
+			}
+			if token != "" {
+				return base.RoundTrip(withAuthorization(req, token))
+			}
+		}
+	}
+	if t.Pool.Len() == 0 {
+		return base.RoundTrip(req)
+	}
+
+	// Move on to the next token right away when one runs out of quota. Secondary limits are
+	// waited out instead; GitHub treats switching credentials to dodge them as abuse.
+	for attempt := 0; ; attempt++ {
+		token := t.Pool.pick()
+		resp, err := base.RoundTrip(withAuthorization(req, token.value))
+		if err != nil {
+			return nil, err
+		}
+		t.Pool.update(token, resp.Header)
+		_, secondary, limited := rateLimitWait(resp)
+		if !limited || secondary || attempt >= t.Pool.Len()-1 || !t.Pool.hasQuota() {
+			t.Pool.rewriteRateHeaders(resp.Header)
+			return resp, nil
+		}
+		if _, ok := replayableRequest(req); !ok {
+			t.Pool.rewriteRateHeaders(resp.Header)
+			return resp, nil
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+}
+
+func (t *GitHubAuthTransport) logger(ctx context.Context) *zap.Logger {
+	if t.Logger == nil {
+		return zap.NewNop()
+	}
+	return requestLogger(ctx, t.Logger)
+}
+
+// withAuthorization returns a copy of req using token, rewinding the body for retries.
+func withAuthorization(req *http.Request, token string) *http.Request {
+	authed, ok := replayableRequest(req)
+	if !ok {
+		authed = req.Clone(req.Context())
+	}
+	authed.Header.Set("Authorization", "Bearer "+token)
+	return authed
+}
+
+// githubAppAccessKey marks contexts of trusted callers, which may use GitHub App installation
+// tokens and thereby the private repositories of installed owners.
+type githubAppAccessKey struct{}
+
+// withGitHubAppAccess lets requests made with ctx use GitHub App installation tokens. It is set
+// for API key callers and signed webhooks; anonymous callers must not see private repositories.
+func withGitHubAppAccess(ctx context.Context) context.Context {
+	return context.WithValue(ctx, githubAppAccessKey{}, true)
+}
+
+func hasGitHubAppAccess(ctx context.Context) bool {
+	ok, _ := ctx.Value(githubAppAccessKey{}).(bool)
+	return ok
+}
+
+// githubRepoOwnerKey is the context key of the repository owner a request is made for.
+type githubRepoOwnerKey struct{}
+
+// withGitHubRepoOwner tells GitHubAuthTransport which owner's App installation to use for
+// requests whose path does not name the repository, such as GraphQL queries.
+func withGitHubRepoOwner(ctx context.Context, owner string) context.Context {
+	return context.WithValue(ctx, githubRepoOwnerKey{}, strings.ToLower(owner))
+}
+
+func githubRepoOwner(ctx context.Context) string {
+	owner, _ := ctx.Value(githubRepoOwnerKey{}).(string)
+	return owner
+}
+
+// repoOwnerFromPath returns the owner of /repos/{owner}/{repo}/... API paths.
+func repoOwnerFromPath(path string) string {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(parts) < 3 || parts[0] != "repos" {
+		return ""
+	}
+	return strings.ToLower(parts[1])
+}
+
+func apiBaseURL(u *url.URL) *url.URL {
+	return &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/"}
+}
+
+// GitHubTokenPool rotates personal access tokens by remaining quota. Each token's quota is
+// tracked from the rate limit headers of its responses.
+type GitHubTokenPool struct {
+	mu     sync.Mutex
+	tokens []*pooledToken
+	next   int
+}
+
+type pooledToken struct {
+	value string
+	// remaining is -1 until the first response reports the quota.
+	remaining int
+	reset     time.Time
+}
+
+// NewGitHubTokenPool creates a pool of the given tokens; empty and duplicate tokens are dropped.
+func NewGitHubTokenPool(tokens []string) *GitHubTokenPool {
+	pool := &GitHubTokenPool{}
+	seen := make(map[string]bool)
+	for _, token := range tokens {
+		token = strings.TrimSpace(token)
+		if token == "" || seen[token] {
+			continue
+		}
+		seen[token] = true
+		pool.tokens = append(pool.tokens, &pooledToken{value: token, remaining: -1})
+	}
+	return pool
+}
+
+// Len returns the number of tokens in the pool.
+func (p *GitHubTokenPool) Len() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.tokens)
+}
+
+// pick returns the token with the most remaining quota. Tokens whose quota is unknown or has
+// reset count as full; ties are broken round-robin.
+func (p *GitHubTokenPool) pick() *pooledToken {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	var best *pooledToken
+	bestRemaining := 0
+	for i := range p.tokens {
+		token := p.tokens[(p.next+i)%len(p.tokens)]
+		remaining := token.effectiveRemaining(now)
+		if best == nil || remaining > bestRemaining {
+			best, bestRemaining = token, remaining
+		}
+	}
+	p.next = (p.next + 1) % len(p.tokens)
+	return best
+}
+
+func (t *pooledToken) effectiveRemaining(now time.Time) int {
+	if t.remaining < 0 || (!t.reset.IsZero() && now.After(t.reset)) {
+		return int(^uint(0) >> 1)
+	}
+	return t.remaining
+}
+
+// update records the quota reported for token. Only the core limit is tracked; search and
+// GraphQL have separate quotas.
+func (p *GitHubTokenPool) update(token *pooledToken, h http.Header) {
+	remaining, err := strconv.Atoi(h.Get(github.HeaderRateRemaining))
+	if err != nil || !coreRateLimit(h) {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	token.remaining = remaining
+	if reset, err := strconv.ParseInt(h.Get(github.HeaderRateReset), 10, 64); err == nil {
+		token.reset = time.Unix(reset, 0)
+	}
+}
+
+// hasQuota reports whether any token has quota left.
+func (p *GitHubTokenPool) hasQuota() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	return slices.ContainsFunc(p.tokens, func(t *pooledToken) bool { return t.effectiveRemaining(now) > 0 })
+}
+
+// rewriteRateHeaders reports the quota of the whole pool instead of the answering token's, so
+// the GitHub client does not stop sending requests while other tokens have quota left. Tokens
+// with an unknown or reset quota count with the full limit. Once the pool is exhausted the
+// earliest reset is reported.
+func (p *GitHubTokenPool) rewriteRateHeaders(h http.Header) {
+	if len(p.tokens) < 2 || h.Get(github.HeaderRateRemaining) == "" || !coreRateLimit(h) {
+		return
+	}
+	limit, err := strconv.Atoi(h.Get(github.HeaderRateLimit))
+	if err != nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	total := 0
+	var reset time.Time
+	for _, t := range p.tokens {
+		remaining := t.effectiveRemaining(now)
+		if remaining > t.remaining {
+			total += limit
+			continue
+		}
+		total += remaining
+		if reset.IsZero() || t.reset.Before(reset) {
+			reset = t.reset
+		}
+	}
+	h.Set(github.HeaderRateRemaining, strconv.Itoa(total))
+	if total == 0 && !reset.IsZero() {
+		h.Set(github.HeaderRateReset, strconv.FormatInt(reset.Unix(), 10))
+	}
+}
+
+func coreRateLimit(h http.Header) bool {
+	resource := h.Get(github.HeaderRateResource)
+	return resource == "" || resource == "core"
+}
+
+// GitHubApp authenticates as a GitHub App and hands out installation tokens for the accounts
+// that installed it. Installations and tokens are cached and tokens are renewed before they
+// expire.
+type GitHubApp struct {
+	id  int64
+	key *rsa.PrivateKey
+
+	mu            sync.Mutex
+	installations map[string]appInstallation
+	tokens        map[int64]installationToken
+}
+
+type appInstallation struct {
+	id      int64 // 0 when the owner did not install the app
+	checked time.Time
+}
+
+type installationToken struct {
+	value     string
+	expiresAt time.Time
+}
+
+// NewGitHubApp creates a GitHub App authenticator from the app ID and its PEM encoded private
+// key (PKCS #1 as downloaded from GitHub, or PKCS #8).
+func NewGitHubApp(id int64, pemKey []byte) (*GitHubApp, error) {
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return nil, errors.New("github app private key is not PEM encoded")
+	}
+	var key *rsa.PrivateKey
+	if k, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		key = k
+	} else {
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse github app private key: %w", err)
+		}
+		rsaKey, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("github app private key must be an RSA key")
+		}
+		key = rsaKey
+	}
+	return &GitHubApp{
+		id:            id,
+		key:           key,
+		installations: make(map[string]appInstallation),
+		tokens:        make(map[int64]installationToken),
+	}, nil
+}
+
+// jwt returns a JWT authenticating as the app itself.
+func (a *GitHubApp) jwt(now time.Time) (string, error) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]any{
+		// Backdated to allow for clock drift, as GitHub recommends.
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(appJWTLifetime).Unix(),
+		"iss": strconv.FormatInt(a.id, 10),
+	})
+	if err != nil {
+		return "", err
+	}
+	signingInput := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(nil, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// installationToken returns a token of owner's installation, or "" when owner did not install
+// the app.
+func (a *GitHubApp) installationToken(ctx context.Context, base http.RoundTripper, apiBase *url.URL, owner string) (string, error) {
+	now := time.Now()
+	a.mu.Lock()
+	inst, known := a.installations[owner]
+	if known && now.Sub(inst.checked) > installationLookupTTL {
+		known = false
+	}
+	token, cached := a.tokens[inst.id]
+	a.mu.Unlock()
+
+	if !known {
+		id, err := a.lookupInstallation(ctx, base, apiBase, owner)
+		if err != nil {
+			return "", err
+		}
+		inst = appInstallation{id: id, checked: now}
+		a.mu.Lock()
+		a.installations[owner] = inst
+		token, cached = a.tokens[id]
+		a.mu.Unlock()
+	}
+	if inst.id == 0 {
+		return "", nil
+	}
+	if cached && now.Add(installationTokenRefresh).Before(token.expiresAt) {
+		return token.value, nil
+	}
+
+	token, err := a.createInstallationToken(ctx, base, apiBase, inst.id)
+	if err != nil {
+		return "", err
+	}
+	a.mu.Lock()
+	a.tokens[inst.id] = token
+	a.mu.Unlock()
+	return token.value, nil
+}
+
+// lookupInstallation returns the ID of owner's installation, or 0 when there is none.
+func (a *GitHubApp) lookupInstallation(ctx context.Context, base http.RoundTripper, apiBase *url.URL, owner string) (int64, error) {
+	var inst struct {
+		ID int64 `json:"id"`
+	}
+	for _, path := range []string{"orgs/" + url.PathEscape(owner) + "/installation", "users/" + url.PathEscape(owner) + "/installation"} {
+		status, err := a.appRequest(ctx, base, apiBase, "get_app_installation", http.MethodGet, path, &inst)
+		if err != nil {
+			return 0, err
+		}
+		if status == http.StatusOK {
+			return inst.ID, nil
+		}
+	}
+	return 0, nil
+}
+
+func (a *GitHubApp) createInstallationToken(ctx context.Context, base http.RoundTripper, apiBase *url.URL, id int64) (installationToken, error) {
+	var created struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	path := "app/installations/" + strconv.FormatInt(id, 10) + "/access_tokens"
+	status, err := a.appRequest(ctx, base, apiBase, "create_installation_token", http.MethodPost, path, &created)
+	if err != nil {
+		return installationToken{}, err
+	}
+	if status != http.StatusCreated {
+		return installationToken{}, fmt.Errorf("create github app installation token: status %d", status)
+	}
+	return installationToken{value: created.Token, expiresAt: created.ExpiresAt}, nil
+}
+
+// appRequest calls the GitHub API as the app and decodes a successful answer into out. It
+// returns 404s as a status rather than an error.
+func (a *GitHubApp) appRequest(ctx context.Context, base http.RoundTripper, apiBase *url.URL, operation, method, path string, out any) (int, error) {
+	jwt, err := a.jwt(time.Now())
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, apiBase.ResolveReference(&url.URL{Path: path}).String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		observeGitHubRequest(ctx, operation, err, start)
+		return 0, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		observeGitHubRequest(ctx, operation, nil, start)
+		return resp.StatusCode, nil
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		err := fmt.Errorf("github app request %s: status %d", path, resp.StatusCode)
+		observeGitHubRequest(ctx, operation, err, start)
+		return resp.StatusCode, err
+	}
+	observeGitHubRequest(ctx, operation, nil, start)
+	return resp.StatusCode, json.NewDecoder(resp.Body).Decode(out)
+}
+
+// PoolTokens returns the personal access tokens to rotate: Token followed by Tokens.
+func (c GitHubConfig) PoolTokens() []string {
+	return append([]string{c.Token}, c.Tokens...)
+}
+
+// useGraphQL reports whether comparisons are fetched over GraphQL, which rejects
+// unauthenticated requests: as configured, or else when a token, token pool or App is set up
+// or the caller brought their own token.
+func (c GitHubConfig) useGraphQL(userToken bool) bool {
+	if c.GraphQL != nil {
+		return *c.GraphQL
+	}
+	return userToken || c.App.ID != 0 || NewGitHubTokenPool(c.PoolTokens()).Len() > 0
+}
+
+func (c GitHubAppConfig) privateKey() ([]byte, error) {
+	if c.PrivateKey != "" {
+		return []byte(c.PrivateKey), nil
+	}
+	return os.ReadFile(c.PrivateKeyFile)
+}
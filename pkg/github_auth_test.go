@@ -0,0 +1,246 @@
+package pkg
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v83/github"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// newAuthTestClient returns a GitHub client talking to mux through a GitHubAuthTransport.
+func newAuthTestClient(t *testing.T, mux http.Handler, auth *GitHubAuthTransport) *github.Client {
+	t.Helper()
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	auth.Base = ts.Client().Transport
+	client := github.NewClient(&http.Client{Transport: auth})
+	client.BaseURL, _ = url.Parse(ts.URL + "/")
+	return client
+}
+
+func TestGitHubTokenPoolRotatesOnExhaustedToken(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Unix()
+	var used []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octo/hello/tags", func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		used = append(used, token)
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+		if token == "exhausted" {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("X-RateLimit-Remaining", "100")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"name":"v1.0.0"}]`))
+	})
+
+	pool := NewGitHubTokenPool([]string{"exhausted", "fresh", "fresh", ""})
+	if pool.Len() != 2 {
+		t.Fatalf("expected empty and duplicate tokens to be dropped, got %d tokens", pool.Len())
+	}
+	client := newAuthTestClient(t, mux, &GitHubAuthTransport{Pool: pool})
+
+	for i := 0; i < 3; i++ {
+		if _, err := GetRepoTags(context.Background(), client, "https://github.com/octo/hello"); err != nil {
+			t.Fatalf("request %d: unexpected error: %v", i, err)
+		}
+	}
+	// The exhausted token is used at most once, then the pool prefers the one with quota.
+	if got := strings.Count(strings.Join(used, ","), "exhausted"); got != 1 {
+		t.Fatalf("expected the exhausted token to be tried once, got calls %v", used)
+	}
+}
+
+func TestGitHubTokenPoolReportsPoolQuota(t *testing.T) {
+	pool := NewGitHubTokenPool([]string{"a", "b"})
+	reset := time.Now().Add(time.Hour)
+	header := func(remaining string) http.Header {
+		h := http.Header{}
+		h.Set("X-RateLimit-Limit", "5000")
+		h.Set("X-RateLimit-Remaining", remaining)
+		h.Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		return h
+	}
+	pool.update(pool.tokens[0], header("0"))
+	pool.update(pool.tokens[1], header("7"))
+
+	h := header("0")
+	pool.rewriteRateHeaders(h)
+	if got := h.Get("X-RateLimit-Remaining"); got != "7" {
+		t.Fatalf("expected the pool's remaining quota of 7, got %s", got)
+	}
+}
+
+func TestGitHubAppInstallationToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	app, err := NewGitHubApp(42, pemKey)
+	if err != nil {
+		t.Fatalf("NewGitHubApp: %v", err)
+	}
+
+	var created atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/orgs/octo/installation", func(w http.ResponseWriter, r *http.Request) {
+		verifyAppJWT(t, r, &key.PublicKey)
+		_, _ = w.Write([]byte(`{"id":7}`))
+	})
+	mux.HandleFunc("/orgs/solo/installation", http.NotFound)
+	mux.HandleFunc("/users/solo/installation", http.NotFound)
+	mux.HandleFunc("/app/installations/7/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		verifyAppJWT(t, r, &key.PublicKey)
+		created.Add(1)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{"token": "installation-token", "expires_at": time.Now().Add(time.Hour)})
+	})
+	tagsHandler := func(want string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if got := r.Header.Get("Authorization"); got != want {
+				t.Errorf("expected Authorization %q, got %q", want, got)
+			}
+			_, _ = w.Write([]byte(`[]`))
+		}
+	}
+	mux.HandleFunc("/repos/octo/private/tags", tagsHandler("Bearer installation-token"))
+	mux.HandleFunc("/repos/solo/hello/tags", tagsHandler("Bearer personal"))
+	mux.HandleFunc("/repos/octo/public/tags", tagsHandler("Bearer personal"))
+
+	client := newAuthTestClient(t, mux, &GitHubAuthTransport{Pool: NewGitHubTokenPool([]string{"personal"}), App: app})
+	for i := 0; i < 2; i++ {
+		if _, err := GetRepoTags(withGitHubAppAccess(context.Background()), client, "https://github.com/octo/private"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if _, err := GetRepoTags(withGitHubAppAccess(context.Background()), client, "https://github.com/solo/hello"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if created.Load() != 1 {
+		t.Fatalf("expected the installation token to be created once and cached, got %d", created.Load())
+	}
+	// Callers without GitHub App access never get an installation token, even for installed owners.
+	if _, err := GetRepoTags(context.Background(), client, "https://github.com/octo/public"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestGitHubAppFailureFallsBackToPool(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	app, err := NewGitHubApp(42, pemKey)
+	if err != nil {
+		t.Fatalf("NewGitHubApp: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/orgs/octo/installation", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/repos/octo/hello/tags", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer personal" {
+			t.Errorf("expected the pooled token, got Authorization %q", got)
+		}
+		_, _ = w.Write([]byte(`[{"name":"v1.0.0"}]`))
+	})
+
+	core, logs := observer.New(zap.WarnLevel)
+	client := newAuthTestClient(t, mux, &GitHubAuthTransport{Pool: NewGitHubTokenPool([]string{"personal"}), App: app, Logger: zap.New(core)})
+	tags, err := GetRepoTags(withGitHubAppAccess(context.Background()), client, "https://github.com/octo/hello")
+	if err != nil {
+		t.Fatalf("expected the request to fall back to the pool, got %v", err)
+	}
+	if len(tags) != 1 {
+		t.Fatalf("unexpected tags %v", tags)
+	}
+	if logs.FilterMessageSnippet("installation token failed").Len() != 1 {
+		t.Fatalf("expected the app failure to be logged, got %v", logs.All())
+	}
+}
+
+func TestGitHubAppInstallationTokenForGraphQL(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	app, err := NewGitHubApp(42, pemKey)
+	if err != nil {
+		t.Fatalf("NewGitHubApp: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/orgs/octo/installation", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":7}`))
+	})
+	mux.HandleFunc("/app/installations/7/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{"token": "installation-token", "expires_at": time.Now().Add(time.Hour)})
+	})
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer installation-token" {
+			t.Errorf("expected the installation token, got Authorization %q", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":{"repository":{
+			"fromRef":{"target":{"oid":"aaa"},"compare":{"commits":{"pageInfo":{"hasNextPage":false},"nodes":[]}}},
+			"toRef":{"target":{"oid":"bbb"}},
+			"releases":{"pageInfo":{"hasNextPage":false},"nodes":[]}
+		}}}`))
+	})
+
+	client := newAuthTestClient(t, mux, &GitHubAuthTransport{Pool: NewGitHubTokenPool([]string{"personal"}), App: app})
+	if _, err := fetchComparisonDataGraphQL(withGitHubAppAccess(context.Background()), client, "Octo", "private", "v1.0.0", "v1.1.0", 10, "fast", TruncationConfig{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func verifyAppJWT(t *testing.T, r *http.Request, pub *rsa.PublicKey) {
+	t.Helper()
+	parts := strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), ".")
+	if len(parts) != 3 {
+		t.Errorf("expected a JWT, got %q", r.Header.Get("Authorization"))
+		return
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Errorf("decode signature: %v", err)
+		return
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature); err != nil {
+		t.Errorf("invalid JWT signature: %v", err)
+	}
+	claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	var payload struct {
+		Iss string `json:"iss"`
+		Exp int64  `json:"exp"`
+	}
+	if err := json.Unmarshal(claims, &payload); err != nil || payload.Iss != "42" || payload.Exp <= time.Now().Unix() {
+		t.Errorf("unexpected JWT claims %s", claims)
+	}
+}
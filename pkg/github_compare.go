@@ -4,18 +4,36 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/google/go-github/v83/github"
 )
 
-// fetchComparisonData collects release notes, commit titles, and changed files between two tags.
-func fetchComparisonData(ctx context.Context, gh *github.Client, owner, repo, fromTag, toTag string, maxReleases int, mode string) (comparisonData, error) {
+// fetchComparisonData collects release notes, commit titles, and changed files between two tags,
+// truncated to limits. With useGraphQL the releases, commits and their pull requests come from
+// one GraphQL query, falling back to the REST API when GraphQL is unavailable; changed files
+// always come from REST.
+func fetchComparisonData(ctx context.Context, gh *github.Client, owner, repo, fromTag, toTag string, maxReleases int, mode string, limits TruncationConfig, useGraphQL bool) (comparisonData, error) {
+	if useGraphQL {
+		data, err := fetchComparisonDataGraphQL(ctx, gh, owner, repo, fromTag, toTag, maxReleases, mode, limits)
+		if err == nil {
+			return data, nil
+		}
+		if ctx.Err() != nil {
+			return comparisonData{}, err
+		}
+		observeGraphQLFallback(graphQLFallbackReason(err))
+	}
+	return fetchComparisonDataREST(ctx, gh, owner, repo, fromTag, toTag, maxReleases, mode, limits)
+}
+
+func fetchComparisonDataREST(ctx context.Context, gh *github.Client, owner, repo, fromTag, toTag string, maxReleases int, mode string, limits TruncationConfig) (comparisonData, error) {
 	startCompare := time.Now()
 	compare, _, err := gh.Repositories.CompareCommits(ctx, owner, repo, fromTag, toTag, nil)
 	compareErr := mapGitHubError(err)
-	observeGitHubRequest("compare_commits", compareErr, time.Since(startCompare))
+	observeGitHubRequest(ctx, "compare_commits", compareErr, startCompare)
 	if compareErr != nil {
 		return comparisonData{}, compareErr
 	}
@@ -25,119 +43,208 @@ func fetchComparisonData(ctx context.Context, gh *github.Client, owner, repo, fr
 		if c == nil || c.Commit == nil {
 			continue
 		}
-		message := strings.TrimSpace(c.Commit.GetMessage())
-		if message == "" {
-			continue
+		if title := commitTitle(c.GetSHA(), c.Commit.GetMessage(), mode); title != "" {
+			commitTitles = append(commitTitles, title)
 		}
-		title := strings.SplitN(message, "\n", 2)[0]
-		if mode == "deep" {
-			sha := c.GetSHA()
-			if len(sha) > 7 {
-				sha = sha[:7]
-			}
-			if sha != "" {
-				title = sha + ": " + title
-			}
-		}
-		commitTitles = append(commitTitles, title)
 	}
 
-	if mode == "fast" {
-		if len(commitTitles) > 150 {
-			commitTitles = commitTitles[:150]
+	releaseNotes, err := fetchReleaseNotes(ctx, gh, owner, repo, fromTag, toTag, maxReleases, limits.MaxReleaseNoteLength)
+	if err != nil {
+		return comparisonData{}, err
+	}
+
+	var toCommit string
+	if n := len(compare.Commits); n > 0 {
+		toCommit = compare.Commits[n-1].GetSHA()
+	}
+	return comparisonData{
+		ReleaseNotes: releaseNotes,
+		CommitTitles: truncateCommitTitles(commitTitles, limits),
+		ChangedFiles: changedFiles(compare, mode),
+		FromCommit:   compare.GetBaseCommit().GetSHA(),
+		ToCommit:     toCommit,
+	}, nil
+}
+
+// commitTitle returns the first line of a commit message, prefixed with the short SHA outside
+// fast mode, or "" for an empty message.
+func commitTitle(sha, message, mode string) string {
+	message = strings.TrimSpace(message)
+	if message == "" {
+		return ""
+	}
+	title := strings.SplitN(message, "\n", 2)[0]
+	if mode != "fast" {
+		if len(sha) > 7 {
+			sha = sha[:7]
+		}
+		if sha != "" {
+			title = sha + ": " + title
 		}
+	}
+	return title
+}
+
+func truncateCommitTitles(commitTitles []string, limits TruncationConfig) []string {
+	if limits.MaxCommits > 0 && len(commitTitles) > limits.MaxCommits {
+		commitTitles = commitTitles[:limits.MaxCommits]
+		observeTruncation("commits")
+	}
+	if limits.MaxCommitTitleLength > 0 {
 		for i, title := range commitTitles {
-			if len(title) > 120 {
-				commitTitles[i] = title[:120]
+			if len(title) > limits.MaxCommitTitleLength {
+				commitTitles[i] = title[:limits.MaxCommitTitleLength]
+				observeTruncation("commit_title")
 			}
 		}
 	}
+	return commitTitles
+}
 
-	var changedFiles []string
-	if mode == "deep" {
-		seen := make(map[string]struct{})
-		for _, f := range compare.Files {
-			if f == nil {
-				continue
-			}
-			name := f.GetFilename()
-			if name == "" {
-				continue
-			}
-			if _, ok := seen[name]; ok {
-				continue
-			}
-			seen[name] = struct{}{}
-			changedFiles = append(changedFiles, name)
+// changedFiles lists the distinct files of a comparison; fast mode skips them.
+func changedFiles(compare *github.CommitsComparison, mode string) []string {
+	if mode == "fast" || compare == nil {
+		return nil
+	}
+	var files []string
+	seen := make(map[string]struct{})
+	for _, f := range compare.Files {
+		if f == nil {
+			continue
+		}
+		name := f.GetFilename()
+		if name == "" {
+			continue
 		}
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		files = append(files, name)
 	}
+	return files
+}
 
-	releaseNotes, err := fetchReleaseNotes(ctx, gh, owner, repo, fromTag, toTag, maxReleases, mode)
-	if err != nil {
-		return comparisonData{}, err
+// releaseCollector gathers the release notes between two tags. When both tags are semantic
+// versions with the same prefix it selects the releases with that prefix by version range,
+// newest version first, regardless of when they were published. Otherwise it relies on the
+// listing order (newest first): collecting starts at whichever tag comes first and stops at the
+// other one or after maxReleases notes.
+type releaseCollector struct {
+	fromTag, toTag string
+	maxReleases    int
+	maxNoteLength  int
+
+	// low and high bound the version range of tags with prefix when bySemver is set.
+	bySemver  bool
+	prefix    string
+	low, high semver
+
+	notes      []releaseNote
+	collecting bool
+	endTag     string
+}
+
+func newReleaseCollector(fromTag, toTag string, maxReleases, maxNoteLength int) *releaseCollector {
+	c := &releaseCollector{fromTag: fromTag, toTag: toTag, maxReleases: maxReleases, maxNoteLength: maxNoteLength}
+	from, fromOK := parseSemver(fromTag)
+	to, toOK := parseSemver(toTag)
+	if fromOK && toOK && versionTagPrefix(fromTag) == versionTagPrefix(toTag) {
+		c.bySemver = true
+		c.prefix = versionTagPrefix(fromTag)
+		c.low, c.high = from, to
+		if compareSemver(from, to) > 0 {
+			c.low, c.high = to, from
+		}
 	}
+	return c
+}
 
-	return comparisonData{
-		ReleaseNotes: releaseNotes,
-		CommitTitles: commitTitles,
-		ChangedFiles: changedFiles,
-	}, nil
+// add records a listed release and reports whether collection is complete.
+func (c *releaseCollector) add(tag, body string) bool {
+	tag = strings.TrimSpace(tag)
+	if tag == "" {
+		return false
+	}
+	if c.bySemver {
+		return c.addInRange(tag, body)
+	}
+	if !c.collecting {
+		if tag != c.fromTag && tag != c.toTag {
+			return false
+		}
+		c.collecting = true
+		c.endTag = c.fromTag
+		if tag == c.fromTag {
+			c.endTag = c.toTag
+		}
+	}
+
+	c.append(tag, body)
+
+	if tag == c.endTag {
+		return true
+	}
+	if len(c.notes) >= c.maxReleases {
+		observeTruncation("releases")
+		return true
+	}
+	return false
 }
 
-func fetchReleaseNotes(ctx context.Context, gh *github.Client, owner, repo, fromTag, toTag string, maxReleases int, mode string) ([]releaseNote, error) {
-	notes := []releaseNote{}
+// addInRange keeps releases whose version lies between the two tags. Publication order says
+// nothing about versions, so collection is never complete before the listing ends.
+func (c *releaseCollector) addInRange(tag, body string) bool {
+	if versionTagPrefix(tag) != c.prefix {
+		return false
+	}
+	if v, ok := parseSemver(tag); ok && compareSemver(c.low, v) <= 0 && compareSemver(v, c.high) <= 0 {
+		c.append(tag, body)
+	}
+	return false
+}
+
+func (c *releaseCollector) append(tag, body string) {
+	if c.maxNoteLength > 0 && len(body) > c.maxNoteLength {
+		body = body[:c.maxNoteLength]
+		observeTruncation("release_note")
+	}
+	c.notes = append(c.notes, releaseNote{Tag: tag, Body: body})
+}
+
+func (c *releaseCollector) result() []releaseNote {
+	if c.notes == nil {
+		return []releaseNote{}
+	}
+	if !c.bySemver {
+		return clampReleaseNotes(c.notes, c.maxReleases)
+	}
+	slices.SortStableFunc(c.notes, func(a, b releaseNote) int {
+		cmp, _ := compareVersionTags(b.Tag, a.Tag)
+		return cmp
+	})
+	if c.maxReleases > 0 && len(c.notes) > c.maxReleases {
+		observeTruncation("releases")
+	}
+	return clampReleaseNotes(c.notes, c.maxReleases)
+}
+
+func fetchReleaseNotes(ctx context.Context, gh *github.Client, owner, repo, fromTag, toTag string, maxReleases int, maxNoteLength int) ([]releaseNote, error) {
+	collector := newReleaseCollector(fromTag, toTag, maxReleases, maxNoteLength)
 	opt := &github.ListOptions{PerPage: 100}
-	collecting := false
-	endTag := ""
 
 	for {
 		startList := time.Now()
 		releases, resp, err := gh.Repositories.ListReleases(ctx, owner, repo, opt)
 		listErr := mapGitHubError(err)
-		observeGitHubRequest("list_releases", listErr, time.Since(startList))
+		observeGitHubRequest(ctx, "list_releases", listErr, startList)
 		if listErr != nil {
 			return nil, listErr
 		}
 
 		for _, rel := range releases {
-			if rel == nil {
-				continue
-			}
-			tag := strings.TrimSpace(rel.GetTagName())
-			if tag == "" {
-				continue
-			}
-
-			if !collecting {
-				if tag == fromTag || tag == toTag {
-					collecting = true
-					if tag == fromTag {
-						endTag = toTag
-					} else {
-						endTag = fromTag
-					}
-				} else {
-					continue
-				}
-			}
-
-			if collecting {
-				body := rel.GetBody()
-				limit := 5000
-				if mode == "fast" {
-					limit = 1200
-				}
-				if len(body) > limit {
-					body = body[:limit]
-				}
-				notes = append(notes, releaseNote{Tag: tag, Body: body})
-
-				if tag == endTag {
-					return clampReleaseNotes(notes, maxReleases), nil
-				}
-				if len(notes) >= maxReleases {
-					return clampReleaseNotes(notes, maxReleases), nil
-				}
+			if rel != nil && collector.add(rel.GetTagName(), rel.GetBody()) {
+				return collector.result(), nil
 			}
 		}
 
@@ -147,7 +254,7 @@ func fetchReleaseNotes(ctx context.Context, gh *github.Client, owner, repo, from
 		opt.Page = resp.NextPage
 	}
 
-	return clampReleaseNotes(notes, maxReleases), nil
+	return collector.result(), nil
 }
 
 func clampReleaseNotes(notes []releaseNote, maxReleases int) []releaseNote {
@@ -161,13 +268,16 @@ func clampReleaseNotes(notes []releaseNote, maxReleases int) []releaseNote {
 }
 
 func mapGitHubError(err error) error {
+	if rateErr := mapRateLimitError(err); rateErr != nil {
+		return rateErr
+	}
 	var ghErr *github.ErrorResponse
 	if errors.As(err, &ghErr) && ghErr.Response != nil {
 		switch ghErr.Response.StatusCode {
+		case http.StatusNotModified:
+			return ErrNotModified
 		case http.StatusNotFound:
 			return ErrRepoNotFound
-		case http.StatusForbidden:
-			return ErrRateLimited
 		}
 	}
 	return err
@@ -0,0 +1,319 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v83/github"
+)
+
+// maxComparisonCommits matches the REST compare endpoint, which lists at most 250 commits.
+const maxComparisonCommits = 250
+
+// comparisonQuery fetches both tag targets, the commits between them with the pull request each
+// was merged with, and a page of releases. Follow-up queries page commits and releases
+// separately via the include flags.
+const comparisonQuery = `query($owner: String!, $repo: String!, $fromRef: String!, $toRef: String!, $withCommits: Boolean!, $commitsAfter: String, $withReleases: Boolean!, $releasesAfter: String) {
+  repository(owner: $owner, name: $repo) {
+    fromRef: ref(qualifiedName: $fromRef) {
+      target { ...tagTarget }
+      compare(headRef: $toRef) @include(if: $withCommits) {
+        commits(first: 100, after: $commitsAfter) {
+          pageInfo { hasNextPage endCursor }
+          nodes {
+            oid
+            message
+            associatedPullRequests(first: 1) {
+              nodes { number title labels(first: 10) { nodes { name } } }
+            }
+          }
+        }
+      }
+    }
+    toRef: ref(qualifiedName: $toRef) { target { ...tagTarget } }
+    releases(first: 100, after: $releasesAfter, orderBy: {field: CREATED_AT, direction: DESC}) @include(if: $withReleases) {
+      pageInfo { hasNextPage endCursor }
+      nodes { tagName description }
+    }
+  }
+}
+
+fragment tagTarget on GitObject {
+  oid
+  ... on Tag { target { oid } }
+}`
+
+// errGraphQLRefNotFound is returned when a tag is not a ref under refs/tags, e.g. a branch or a
+// commit SHA, which only the REST compare endpoint resolves.
+var errGraphQLRefNotFound = errors.New("github graphql: tag ref not found")
+
+// graphQLErrors reports errors GitHub returned in a GraphQL response body.
+type graphQLErrors []graphQLError
+
+type graphQLError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+func (e graphQLErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Message)
+	}
+	return "github graphql: " + strings.Join(messages, "; ")
+}
+
+type graphQLRequest struct {
+	Query     string         `json:"query"`
+	Variables map[string]any `json:"variables"`
+}
+
+type graphQLPageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+type graphQLTarget struct {
+	OID string `json:"oid"`
+	// Target is set for annotated tags and holds the tagged commit.
+	Target *struct {
+		OID string `json:"oid"`
+	} `json:"target"`
+}
+
+// commit returns the commit a tag points to, peeling annotated tags.
+func (t graphQLTarget) commit() string {
+	if t.Target != nil && t.Target.OID != "" {
+		return t.Target.OID
+	}
+	return t.OID
+}
+
+type graphQLCommit struct {
+	OID                    string `json:"oid"`
+	Message                string `json:"message"`
+	AssociatedPullRequests struct {
+		Nodes []struct {
+			Number int    `json:"number"`
+			Title  string `json:"title"`
+			Labels struct {
+				Nodes []struct {
+					Name string `json:"name"`
+				} `json:"nodes"`
+			} `json:"labels"`
+		} `json:"nodes"`
+	} `json:"associatedPullRequests"`
+}
+
+type comparisonQueryResult struct {
+	Data struct {
+		Repository *struct {
+			FromRef *struct {
+				Target  graphQLTarget `json:"target"`
+				Compare *struct {
+					Commits struct {
+						PageInfo graphQLPageInfo `json:"pageInfo"`
+						Nodes    []graphQLCommit `json:"nodes"`
+					} `json:"commits"`
+				} `json:"compare"`
+			} `json:"fromRef"`
+			ToRef *struct {
+				Target graphQLTarget `json:"target"`
+			} `json:"toRef"`
+			Releases *struct {
+				PageInfo graphQLPageInfo `json:"pageInfo"`
+				Nodes    []struct {
+					TagName     string `json:"tagName"`
+					Description string `json:"description"`
+				} `json:"nodes"`
+			} `json:"releases"`
+		} `json:"repository"`
+	} `json:"data"`
+	Errors graphQLErrors `json:"errors"`
+}
+
+// graphQLResult is a decoded GraphQL response body.
+type graphQLResult interface {
+	queryErrors() graphQLErrors
+}
+
+func (r *comparisonQueryResult) queryErrors() graphQLErrors {
+	return r.Errors
+}
+
+// fetchComparisonDataGraphQL is fetchComparisonData over GitHub's GraphQL API: the first query
+// usually returns everything, where REST needs a call per page of releases. Outside fast mode
+// the changed files still come from the REST compare endpoint, which GraphQL does not expose.
+func fetchComparisonDataGraphQL(ctx context.Context, gh *github.Client, owner, repo, fromTag, toTag string, maxReleases int, mode string, limits TruncationConfig) (comparisonData, error) {
+	commitLimit := maxComparisonCommits
+	if limits.MaxCommits > 0 && limits.MaxCommits < commitLimit {
+		// One commit past the limit is enough to tell that the list was truncated.
+		commitLimit = limits.MaxCommits + 1
+	}
+	collector := newReleaseCollector(fromTag, toTag, maxReleases, limits.MaxReleaseNoteLength)
+	// /graphql does not name the repository, so the App installation comes from the context.
+	ctx = withGitHubRepoOwner(ctx, owner)
+
+	var (
+		data          comparisonData
+		commits       []graphQLCommit
+		commitsAfter  string
+		releasesAfter string
+		withCommits   = true
+		withReleases  = true
+		first         = true
+	)
+	for withCommits || withReleases {
+		vars := map[string]any{
+			"owner":         owner,
+			"repo":          repo,
+			"fromRef":       "refs/tags/" + fromTag,
+			"toRef":         "refs/tags/" + toTag,
+			"withCommits":   withCommits,
+			"commitsAfter":  nullableCursor(commitsAfter),
+			"withReleases":  withReleases,
+			"releasesAfter": nullableCursor(releasesAfter),
+		}
+		var result comparisonQueryResult
+		if err := graphQL(ctx, gh, comparisonQuery, vars, &result); err != nil {
+			return comparisonData{}, err
+		}
+		repository := result.Data.Repository
+		if repository == nil {
+			return comparisonData{}, ErrRepoNotFound
+		}
+		if repository.FromRef == nil || repository.ToRef == nil {
+			return comparisonData{}, errGraphQLRefNotFound
+		}
+		if first {
+			data.FromCommit = repository.FromRef.Target.commit()
+			data.ToCommit = repository.ToRef.Target.commit()
+			first = false
+		}
+
+		if withCommits {
+			compare := repository.FromRef.Compare
+			if compare == nil {
+				return comparisonData{}, errGraphQLRefNotFound
+			}
+			commits = append(commits, compare.Commits.Nodes...)
+			page := compare.Commits.PageInfo
+			withCommits = page.HasNextPage && page.EndCursor != "" && len(commits) < commitLimit
+			commitsAfter = page.EndCursor
+		}
+		if withReleases {
+			releases := repository.Releases
+			if releases == nil {
+				withReleases = false
+				continue
+			}
+			done := false
+			for _, rel := range releases.Nodes {
+				if collector.add(rel.TagName, rel.Description) {
+					done = true
+					break
+				}
+			}
+			withReleases = !done && releases.PageInfo.HasNextPage && releases.PageInfo.EndCursor != ""
+			releasesAfter = releases.PageInfo.EndCursor
+		}
+	}
+
+	commitTitles := make([]string, 0, len(commits))
+	seen := make(map[int]struct{})
+	for _, c := range commits {
+		if title := commitTitle(c.OID, c.Message, mode); title != "" {
+			commitTitles = append(commitTitles, title)
+		}
+		for _, pr := range c.AssociatedPullRequests.Nodes {
+			if _, ok := seen[pr.Number]; ok || pr.Number == 0 {
+				continue
+			}
+			seen[pr.Number] = struct{}{}
+			title := pr.Title
+			if limits.MaxCommitTitleLength > 0 && len(title) > limits.MaxCommitTitleLength {
+				title = title[:limits.MaxCommitTitleLength]
+			}
+			var labels []string
+			for _, label := range pr.Labels.Nodes {
+				labels = append(labels, label.Name)
+			}
+			data.PullRequests = append(data.PullRequests, pullRequest{Number: pr.Number, Title: title, Labels: labels})
+		}
+	}
+	data.CommitTitles = truncateCommitTitles(commitTitles, limits)
+	if limits.MaxCommits > 0 && len(data.PullRequests) > limits.MaxCommits {
+		data.PullRequests = data.PullRequests[:limits.MaxCommits]
+	}
+	data.ReleaseNotes = collector.result()
+
+	if mode != "fast" {
+		startCompare := time.Now()
+		compare, _, err := gh.Repositories.CompareCommits(ctx, owner, repo, fromTag, toTag, nil)
+		compareErr := mapGitHubError(err)
+		observeGitHubRequest(ctx, "compare_commits", compareErr, startCompare)
+		if compareErr != nil {
+			return comparisonData{}, compareErr
+		}
+		data.ChangedFiles = changedFiles(compare, mode)
+	}
+	return data, nil
+}
+
+// graphQL runs a query through gh, so it shares the client's authentication and transports,
+// and decodes the response into out.
+func graphQL(ctx context.Context, gh *github.Client, query string, vars map[string]any, out graphQLResult) error {
+	req, err := gh.NewRequest(http.MethodPost, graphQLPath(gh), graphQLRequest{Query: query, Variables: vars})
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	_, err = gh.Do(ctx, req, out)
+	err = mapGitHubError(err)
+	if errs := out.queryErrors(); err == nil && len(errs) > 0 {
+		err = errs
+	}
+	observeGitHubRequest(ctx, "graphql", err, start)
+	return err
+}
+
+// graphQLPath returns the GraphQL endpoint relative to the client's REST base URL: /graphql on
+// api.github.com, /api/graphql next to GitHub Enterprise Server's /api/v3.
+func graphQLPath(gh *github.Client) string {
+	if gh.BaseURL != nil && strings.HasSuffix(gh.BaseURL.Path, "/api/v3/") {
+		return "../graphql"
+	}
+	return "graphql"
+}
+
+func nullableCursor(cursor string) any {
+	if cursor == "" {
+		return nil
+	}
+	return cursor
+}
+
+// graphQLFallbackReason labels why a GraphQL fetch fell back to REST.
+func graphQLFallbackReason(err error) string {
+	var ghErr *github.ErrorResponse
+	var queryErrs graphQLErrors
+	switch {
+	case errors.Is(err, errGraphQLRefNotFound):
+		return "ref_not_found"
+	case errors.Is(err, ErrRateLimited):
+		return "rate_limited"
+	case errors.Is(err, ErrForbidden):
+		return "forbidden"
+	case errors.Is(err, ErrRepoNotFound):
+		return "not_found"
+	case errors.As(err, &queryErrs):
+		return "query_error"
+	case errors.As(err, &ghErr) && ghErr.Response != nil && ghErr.Response.StatusCode == http.StatusUnauthorized:
+		return "unauthorized"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,136 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestFetchComparisonDataGraphQL(t *testing.T) {
+	var queries []map[string]any
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		var req graphQLRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode graphql request: %v", err)
+		}
+		queries = append(queries, req.Variables)
+		w.Header().Set("Content-Type", "application/json")
+		if req.Variables["releasesAfter"] == nil {
+			_, _ = w.Write([]byte(`{"data":{"repository":{
+				"fromRef":{"target":{"oid":"tag0","target":{"oid":"aaa0000000"}},"compare":{"commits":{
+					"pageInfo":{"hasNextPage":false,"endCursor":"c1"},
+					"nodes":[
+						{"oid":"bbb1111111","message":"Add feature\n\nDetails","associatedPullRequests":{"nodes":[{"number":7,"title":"Feature","labels":{"nodes":[{"name":"breaking"}]}}]}},
+						{"oid":"ccc2222222","message":"Fix feature","associatedPullRequests":{"nodes":[{"number":7,"title":"Feature","labels":{"nodes":[{"name":"breaking"}]}}]}},
+						{"oid":"ddd3333333","message":"Direct push","associatedPullRequests":{"nodes":[]}}
+					]}}},
+				"toRef":{"target":{"oid":"ddd3333333"}},
+				"releases":{"pageInfo":{"hasNextPage":true,"endCursor":"r1"},"nodes":[{"tagName":"v2.0.0","description":"newer"},{"tagName":"v1.1.0","description":"notes"}]}
+			}}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"repository":{
+			"fromRef":{"target":{"oid":"tag0","target":{"oid":"aaa0000000"}}},
+			"toRef":{"target":{"oid":"ddd3333333"}},
+			"releases":{"pageInfo":{"hasNextPage":false,"endCursor":"r2"},"nodes":[{"tagName":"v1.0.0","description":"first"}]}
+		}}}`))
+	})
+	client := newGitHubTestClient(t, mux)
+
+	data, err := fetchComparisonData(context.Background(), client, "octo", "hello", "v1.0.0", "v1.1.0", 10, "fast", TruncationConfig{}, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(queries) != 2 {
+		t.Fatalf("expected 2 graphql queries, got %d", len(queries))
+	}
+	if queries[1]["withCommits"] != false || queries[1]["releasesAfter"] != "r1" {
+		t.Fatalf("expected the second query to page releases only, got %v", queries[1])
+	}
+	if queries[0]["fromRef"] != "refs/tags/v1.0.0" || queries[0]["toRef"] != "refs/tags/v1.1.0" {
+		t.Fatalf("unexpected refs: %v", queries[0])
+	}
+
+	if want := []string{"Add feature", "Fix feature", "Direct push"}; !reflect.DeepEqual(data.CommitTitles, want) {
+		t.Fatalf("expected commit titles %v, got %v", want, data.CommitTitles)
+	}
+	if want := []pullRequest{{Number: 7, Title: "Feature", Labels: []string{"breaking"}}}; !reflect.DeepEqual(data.PullRequests, want) {
+		t.Fatalf("expected pull requests %v, got %v", want, data.PullRequests)
+	}
+	if want := []releaseNote{{Tag: "v1.1.0", Body: "notes"}, {Tag: "v1.0.0", Body: "first"}}; !reflect.DeepEqual(data.ReleaseNotes, want) {
+		t.Fatalf("expected release notes %v, got %v", want, data.ReleaseNotes)
+	}
+	if data.FromCommit != "aaa0000000" || data.ToCommit != "ddd3333333" {
+		t.Fatalf("expected peeled tag targets, got %q and %q", data.FromCommit, data.ToCommit)
+	}
+}
+
+func TestFetchComparisonDataGraphQLFallback(t *testing.T) {
+	tests := []struct {
+		name   string
+		reason string
+		handle func(w http.ResponseWriter)
+	}{
+		{
+			name:   "unauthenticated",
+			reason: "unauthorized",
+			handle: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = w.Write([]byte(`{"message":"This endpoint requires you to be authenticated."}`))
+			},
+		},
+		{
+			name:   "query errors",
+			reason: "query_error",
+			handle: func(w http.ResponseWriter) {
+				_, _ = w.Write([]byte(`{"data":null,"errors":[{"type":"INTERNAL","message":"boom"}]}`))
+			},
+		},
+		{
+			name:   "tag is not a ref",
+			reason: "ref_not_found",
+			handle: func(w http.ResponseWriter) {
+				_, _ = w.Write([]byte(`{"data":{"repository":{"fromRef":null,"toRef":{"target":{"oid":"abc"}},"releases":{"nodes":[]}}}}`))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				tt.handle(w)
+			})
+			mux.HandleFunc("/repos/octo/hello/compare/v1.0.0...v1.1.0", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"base_commit":{"sha":"aaa"},"commits":[{"sha":"bbb","commit":{"message":"From REST"}}],"files":[]}`))
+			})
+			mux.HandleFunc("/repos/octo/hello/releases", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`[]`))
+			})
+			client := newGitHubTestClient(t, mux)
+
+			before := testutil.ToFloat64(GitHubGraphQLFallbackCounter.WithLabelValues(tt.reason))
+			data, err := fetchComparisonData(context.Background(), client, "octo", "hello", "v1.0.0", "v1.1.0", 10, "fast", TruncationConfig{}, true)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(data.CommitTitles) != 1 || data.CommitTitles[0] != "From REST" {
+				t.Fatalf("expected REST commit titles, got %v", data.CommitTitles)
+			}
+			if data.FromCommit != "aaa" || data.ToCommit != "bbb" {
+				t.Fatalf("expected REST tag targets, got %q and %q", data.FromCommit, data.ToCommit)
+			}
+			if got := testutil.ToFloat64(GitHubGraphQLFallbackCounter.WithLabelValues(tt.reason)) - before; got != 1 {
+				t.Fatalf("expected 1 %s fallback, got %v", tt.reason, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,340 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v83/github"
+	"go.uber.org/zap"
+)
+
+// pullRequestCommentMarker identifies the DiffBreak comment so it can be updated in place.
+const pullRequestCommentMarker = "<!-- diffbreak -->"
+
+// pullRequestBotAuthors are the dependency-update bots whose pull requests are analyzed even when
+// the title does not name a single dependency (e.g. grouped updates).
+var pullRequestBotAuthors = map[string]bool{
+	"dependabot[bot]": true,
+	"renovate[bot]":   true,
+}
+
+var (
+	// Dependabot: "Bump golang.org/x/net from 0.17.0 to 0.23.0", optionally with a
+	// "build(deps): " prefix and an " in /dir" suffix.
+	dependabotTitlePattern = regexp.MustCompile(`(?i)\bbump\s+(\S+)\s+from\s+(\S+)\s+to\s+(\S+)`)
+	// Renovate: "Update module github.com/spf13/cobra to v1.8.0" or "Update dependency lodash to v4.17.21".
+	renovateTitlePattern = regexp.MustCompile(`(?i)\bupdate\s+(?:module|dependency)\s+(\S+)\s+to\s+(\S+)`)
+)
+
+// pullRequestManifests maps manifest file names to the bulk-analysis formats they are parsed
+// with, in order of preference: go.sum is only used when go.mod yields no change.
+var pullRequestManifests = []struct {
+	File   string
+	Format string
+}{
+	{"go.mod", FormatGoMod},
+	{"package-lock.json", FormatPackageLock},
+	{"go.sum", FormatGoSum},
+}
+
+// isDependencyBumpPullRequest reports whether a pull request looks like a dependency update.
+func isDependencyBumpPullRequest(title, author string) bool {
+	return pullRequestBotAuthors[strings.ToLower(author)] ||
+		dependabotTitlePattern.MatchString(title) ||
+		renovateTitlePattern.MatchString(title)
+}
+
+// parseBumpTitle extracts the dependency and versions from a Dependabot-style title. from is
+// empty for Renovate titles, which only name the target version.
+func parseBumpTitle(title string) (name, from, to string, ok bool) {
+	if m := dependabotTitlePattern.FindStringSubmatch(title); m != nil {
+		return m[1], m[2], m[3], true
+	}
+	if m := renovateTitlePattern.FindStringSubmatch(title); m != nil {
+		return m[1], "", m[2], true
+	}
+	return "", "", "", false
+}
+
+// ecosystemForFiles guesses the ecosystem of a dependency bump from the files it touches.
+func ecosystemForFiles(files []string) string {
+	for _, f := range files {
+		switch base := path.Base(f); {
+		case base == "go.mod" || base == "go.sum":
+			return EcosystemGo
+		case base == "package.json" || base == "package-lock.json" || base == "yarn.lock" || base == "pnpm-lock.yaml":
+			return EcosystemNPM
+		case base == "Cargo.toml" || base == "Cargo.lock":
+			return EcosystemCrates
+		case base == "pyproject.toml" || base == "poetry.lock" || base == "Pipfile" || base == "Pipfile.lock" ||
+			(strings.HasPrefix(base, "requirements") && strings.HasSuffix(base, ".txt")):
+			return EcosystemPyPI
+		}
+	}
+	return ""
+}
+
+func (rcv *GitHubWebhookReceiver) handlePullRequest(ctx context.Context, w http.ResponseWriter, event *github.PullRequestEvent, eventType string, log *zap.Logger) {
+	ignore := func(reason string) {
+		observeWebhookEvent(eventType, "ignored")
+		writeJSON(w, http.StatusOK, WebhookResponse{Status: WebhookStatusIgnored, Reason: reason})
+	}
+
+	if !rcv.CommentOnPullRequests {
+		ignore("pull request comments are disabled")
+		return
+	}
+	switch event.GetAction() {
+	case "opened", "reopened", "synchronize", "edited":
+	default:
+		ignore("pull request action " + event.GetAction())
+		return
+	}
+	pr := event.GetPullRequest()
+	if pr.GetState() != "open" {
+		ignore("pull request is not open")
+		return
+	}
+	if !isDependencyBumpPullRequest(pr.GetTitle(), pr.GetUser().GetLogin()) {
+		ignore("not a dependency update")
+		return
+	}
+	repoURL := event.GetRepo().GetHTMLURL()
+	owner, repo, err := ParseGitHubRepoURL(repoURL)
+	if err != nil {
+		ignore("unsupported repository")
+		return
+	}
+
+	number := pr.GetNumber()
+	title := pr.GetTitle()
+	resp := WebhookResponse{Status: WebhookStatusQueued, RepoUrl: repoURL, PullRequest: number}
+	key := fmt.Sprintf("%s/%s#%d", owner, repo, number)
+	if !rcv.schedule(ctx, key, func(ctx context.Context) { rcv.commentOnPullRequest(ctx, owner, repo, number, title) }) {
+		observeWebhookEvent(eventType, "duplicate")
+		resp.Status = WebhookStatusDuplicate
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+	observeWebhookEvent(eventType, "queued")
+	log.Info("pull request analysis queued", zap.String("repo_url", repoURL), zap.Int("pull_request", number))
+	writeJSON(w, http.StatusAccepted, resp)
+}
+
+// commentOnPullRequest analyzes the dependency changes of a pull request and creates or updates
+// the DiffBreak comment on it.
+func (rcv *GitHubWebhookReceiver) commentOnPullRequest(ctx context.Context, owner, repo string, number int, title string) {
+	log := requestLogger(ctx, rcv.logger()).With(zap.String("repo", owner+"/"+repo), zap.Int("pull_request", number))
+
+	ctx, cancel := context.WithTimeout(ctx, rcv.Analyzer.config().Timeouts.Bulk)
+	defer cancel()
+
+	result, err := rcv.analyzePullRequest(ctx, owner, repo, number, title)
+	if err != nil {
+		observePullRequestComment("error")
+		log.Warn("pull request analysis failed", zap.Error(err))
+		return
+	}
+	if len(result.Results) == 0 {
+		observePullRequestComment("no_changes")
+		log.Info("no dependency changes found in pull request")
+		return
+	}
+
+	if err := upsertPullRequestComment(ctx, rcv.Analyzer.GitHub, owner, repo, number, RenderPullRequestComment(result)); err != nil {
+		observePullRequestComment("error")
+		log.Warn("posting pull request comment failed", zap.Error(err))
+		return
+	}
+	observePullRequestComment("ok")
+	log.Info("pull request comment posted", zap.String("highest_risk", result.Summary.HighestRisk))
+}
+
+// analyzePullRequest finds the dependency changes of a pull request in its manifest diffs and
+// analyzes them. When no manifest diff is usable (e.g. the patch of a large lockfile is omitted
+// by GitHub) the change named in a Dependabot title is analyzed instead.
+func (rcv *GitHubWebhookReceiver) analyzePullRequest(ctx context.Context, owner, repo string, number int, title string) (BulkAnalyzeResponse, error) {
+	files, err := listPullRequestFiles(ctx, rcv.Analyzer.GitHub, owner, repo, number)
+	if err != nil {
+		return BulkAnalyzeResponse{}, err
+	}
+
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		names = append(names, f.GetFilename())
+	}
+
+	for _, manifest := range pullRequestManifests {
+		for _, f := range files {
+			if path.Base(f.GetFilename()) != manifest.File || f.GetPatch() == "" {
+				continue
+			}
+			result, err := rcv.Analyzer.BulkAnalyze(ctx, BulkAnalyzeRequest{Format: manifest.Format, Diff: f.GetPatch(), Mode: rcv.mode()})
+			if err != nil {
+				return BulkAnalyzeResponse{}, err
+			}
+			if len(result.Results) > 0 {
+				return result, nil
+			}
+		}
+	}
+
+	name, from, to, ok := parseBumpTitle(title)
+	if !ok || from == "" {
+		return BulkAnalyzeResponse{}, nil
+	}
+	change := DependencyChange{Ecosystem: ecosystemForFiles(names), Name: name, From: from, To: to}
+	if change.Ecosystem == "" {
+		return BulkAnalyzeResponse{}, nil
+	}
+	if change.Ecosystem == EcosystemGo {
+		// Dependabot drops the "v" of Go module versions in titles.
+		change.From, change.To = goModuleVersion(change.From), goModuleVersion(change.To)
+	}
+	results := []BulkAnalyzeResult{rcv.Analyzer.analyzeDependency(ctx, change, rcv.mode(), 0)}
+	return BulkAnalyzeResponse{Results: results, Summary: summarizeBulkResults(results)}, nil
+}
+
+func goModuleVersion(version string) string {
+	if strings.HasPrefix(version, "v") {
+		return version
+	}
+	return "v" + version
+}
+
+func listPullRequestFiles(ctx context.Context, gh *github.Client, owner, repo string, number int) ([]*github.CommitFile, error) {
+	var files []*github.CommitFile
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		start := time.Now()
+		page, resp, err := gh.PullRequests.ListFiles(ctx, owner, repo, number, opt)
+		listErr := mapGitHubError(err)
+		observeGitHubRequest(ctx, "list_pull_request_files", listErr, start)
+		if listErr != nil {
+			return nil, listErr
+		}
+		files = append(files, page...)
+		if resp == nil || resp.NextPage == 0 {
+			return files, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// viewerQuery asks for the user the request is authenticated as. Unlike REST's /user it also
+// answers for GitHub App installation tokens, with the App's bot user.
+const viewerQuery = `query { viewer { databaseId login } }`
+
+type viewerQueryResult struct {
+	Data struct {
+		Viewer struct {
+			DatabaseID int64  `json:"databaseId"`
+			Login      string `json:"login"`
+		} `json:"viewer"`
+	} `json:"data"`
+	Errors graphQLErrors `json:"errors"`
+}
+
+func (r *viewerQueryResult) queryErrors() graphQLErrors {
+	return r.Errors
+}
+
+// pullRequestCommentAuthor returns the ID of the user comments on owner's repositories are
+// posted as: the App's bot user where the GitHub App is installed, the token's user otherwise.
+func pullRequestCommentAuthor(ctx context.Context, gh *github.Client, owner string) (int64, error) {
+	var result viewerQueryResult
+	if err := graphQL(withGitHubRepoOwner(ctx, owner), gh, viewerQuery, nil, &result); err != nil {
+		return 0, fmt.Errorf("look up comment author: %w", err)
+	}
+	if result.Data.Viewer.DatabaseID == 0 {
+		return 0, errors.New("look up comment author: github returned no viewer")
+	}
+	return result.Data.Viewer.DatabaseID, nil
+}
+
+// upsertPullRequestComment edits the existing DiffBreak comment on the pull request or creates
+// one when there is none yet. Only comments posted by the authenticated user count as existing,
+// so a comment that merely quotes the marker is never overwritten.
+func upsertPullRequestComment(ctx context.Context, gh *github.Client, owner, repo string, number int, body string) error {
+	var author int64
+	opt := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		start := time.Now()
+		comments, resp, err := gh.Issues.ListComments(ctx, owner, repo, number, opt)
+		listErr := mapGitHubError(err)
+		observeGitHubRequest(ctx, "list_issue_comments", listErr, start)
+		if listErr != nil {
+			return listErr
+		}
+		for _, c := range comments {
+			if !strings.Contains(c.GetBody(), pullRequestCommentMarker) {
+				continue
+			}
+			if author == 0 {
+				if author, err = pullRequestCommentAuthor(ctx, gh, owner); err != nil {
+					return err
+				}
+			}
+			if c.GetUser().GetID() != author {
+				continue
+			}
+			if c.GetBody() == body {
+				return nil
+			}
+			start := time.Now()
+			_, _, err := gh.Issues.EditComment(ctx, owner, repo, c.GetID(), &github.IssueComment{Body: github.Ptr(body)})
+			editErr := mapGitHubError(err)
+			observeGitHubRequest(ctx, "edit_issue_comment", editErr, start)
+			return editErr
+		}
+		if resp == nil || resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	start := time.Now()
+	_, _, err := gh.Issues.CreateComment(ctx, owner, repo, number, &github.IssueComment{Body: github.Ptr(body)})
+	createErr := mapGitHubError(err)
+	observeGitHubRequest(ctx, "create_issue_comment", createErr, start)
+	return createErr
+}
+
+// RenderPullRequestComment renders the analyses of a pull request's dependency changes as a
+// Markdown comment carrying the DiffBreak marker.
+func RenderPullRequestComment(result BulkAnalyzeResponse) string {
+	var b strings.Builder
+	b.WriteString(pullRequestCommentMarker + "\n")
+
+	if len(result.Results) > 1 {
+		risk := result.Summary.HighestRisk
+		if risk == "" {
+			risk = "unknown"
+		}
+		fmt.Fprintf(&b, "**DiffBreak:** %d dependency updates, highest risk **%s**\n\n", len(result.Results), strings.ToUpper(risk))
+	}
+
+	for i, r := range result.Results {
+		if i > 0 {
+			b.WriteString("\n---\n\n")
+		}
+		if r.Analysis != nil {
+			b.WriteString(RenderMarkdown(*r.Analysis))
+			continue
+		}
+		fmt.Fprintf(&b, "#### `%s` `%s` → `%s`\n\n", markdownInline(r.Dependency.Name), r.Dependency.From, r.Dependency.To)
+		switch r.Status {
+		case BulkStatusUnresolved:
+			b.WriteString("_Could not resolve the dependency to a GitHub repository._\n")
+		default:
+			fmt.Fprintf(&b, "_Analysis failed: %s_\n", markdownInline(r.Error))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,210 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakePullRequestBotID is the user ID the fake GitHub API authenticates requests as.
+const fakePullRequestBotID = 42
+
+// fakePullRequestComments serves the issue comment endpoints of octo/app#7 and records writes.
+type fakePullRequestComments struct {
+	mu       sync.Mutex
+	comments []map[string]any
+	created  int
+	edited   int
+}
+
+func (f *fakePullRequestComments) register(mux *http.ServeMux) {
+	mux.HandleFunc("/repos/octo/app/issues/7/comments", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			var c map[string]any
+			_ = json.NewDecoder(r.Body).Decode(&c)
+			c["id"] = 100 + len(f.comments)
+			c["user"] = map[string]any{"id": fakePullRequestBotID}
+			f.comments = append(f.comments, c)
+			f.created++
+			_ = json.NewEncoder(w).Encode(c)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(append([]map[string]any{{"id": 1, "body": "LGTM"}}, f.comments...))
+	})
+	mux.HandleFunc("/repos/octo/app/issues/comments/", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		var c map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&c)
+		for _, existing := range f.comments {
+			if fmt.Sprint(existing["id"]) == path.Base(r.URL.Path) {
+				existing["body"] = c["body"]
+			}
+		}
+		f.edited++
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(c)
+	})
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"viewer": map[string]any{"databaseId": fakePullRequestBotID, "login": "diffbreak[bot]"}}})
+	})
+}
+
+func pullRequestEventBody(title string) string {
+	payload, _ := json.Marshal(map[string]any{
+		"action": "opened",
+		"number": 7,
+		"pull_request": map[string]any{
+			"number": 7,
+			"state":  "open",
+			"title":  title,
+			"user":   map[string]any{"login": "dependabot[bot]"},
+		},
+		"repository": map[string]any{"html_url": "https://github.com/octo/app"},
+	})
+	return string(payload)
+}
+
+func TestGitHubWebhookCommentsOnDependencyPullRequest(t *testing.T) {
+	ghMux := http.NewServeMux()
+	ghMux.HandleFunc("/repos/octo/app/pulls/7/files", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode([]map[string]any{
+			{"filename": "go.mod", "patch": "@@ -3,6 +3,6 @@ go 1.22\n \n require (\n-\tgithub.com/octo/hello v1.0.0\n+\tgithub.com/octo/hello v1.1.0\n \tgolang.org/x/net v0.23.0\n )"},
+			{"filename": "go.sum", "patch": "@@ -1,2 +1,2 @@\n-github.com/octo/hello v1.0.0 h1:abc=\n+github.com/octo/hello v1.1.0 h1:def="},
+		})
+	})
+	emptyCompareMux(ghMux, "octo", "hello", "v1.0.0", "v1.1.0")
+	comments := &fakePullRequestComments{}
+	comments.register(ghMux)
+	ghClient := newGitHubTestClient(t, ghMux)
+	ollama, _ := newOllamaTestServer(t, validModelResponse)
+
+	receiver := &GitHubWebhookReceiver{
+		Analyzer:              &Analyzer{GitHub: ghClient, OllamaBaseURL: ollama.URL},
+		Secret:                []byte(testWebhookSecret),
+		CommentOnPullRequests: true,
+	}
+
+	body := pullRequestEventBody("Bump github.com/octo/hello from 1.0.0 to 1.1.0")
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		receiver.Handler().ServeHTTP(rec, newWebhookRequest(t, "pull_request", body, testWebhookSecret))
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusAccepted, rec.Code, rec.Body.String())
+		}
+		receiver.Wait()
+	}
+
+	// The second delivery finds the marker and updates the first comment instead of adding one.
+	if comments.created != 1 {
+		t.Fatalf("expected 1 created comment, got %d", comments.created)
+	}
+	posted, _ := comments.comments[0]["body"].(string)
+	if !strings.HasPrefix(posted, pullRequestCommentMarker) || !strings.Contains(posted, "`v1.0.0` → `v1.1.0`") {
+		t.Fatalf("unexpected comment body:\n%s", posted)
+	}
+
+	comments.comments[0]["body"] = pullRequestCommentMarker + "\nstale"
+	edits := comments.edited
+	rec := httptest.NewRecorder()
+	receiver.Handler().ServeHTTP(rec, newWebhookRequest(t, "pull_request", body, testWebhookSecret))
+	receiver.Wait()
+	if comments.created != 1 || comments.edited != edits+1 {
+		t.Fatalf("expected stale comment to be edited in place, got %d created / %d edited", comments.created, comments.edited-edits)
+	}
+}
+
+func TestUpsertPullRequestCommentIgnoresOtherAuthors(t *testing.T) {
+	ghMux := http.NewServeMux()
+	comments := &fakePullRequestComments{}
+	comments.register(ghMux)
+	ghClient := newGitHubTestClient(t, ghMux)
+
+	// Someone else quoting the marker must not get their comment overwritten.
+	comments.comments = append(comments.comments, map[string]any{"id": 50, "body": pullRequestCommentMarker + "\nquoted", "user": map[string]any{"id": 7}})
+	if err := upsertPullRequestComment(context.Background(), ghClient, "octo", "app", 7, pullRequestCommentMarker+"\nfirst"); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if comments.created != 1 || comments.edited != 0 {
+		t.Fatalf("expected a new comment, got %d created / %d edited", comments.created, comments.edited)
+	}
+
+	if err := upsertPullRequestComment(context.Background(), ghClient, "octo", "app", 7, pullRequestCommentMarker+"\nsecond"); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if comments.created != 1 || comments.edited != 1 {
+		t.Fatalf("expected the bot's comment to be edited, got %d created / %d edited", comments.created, comments.edited)
+	}
+	if comments.comments[0]["body"] != pullRequestCommentMarker+"\nquoted" || comments.comments[1]["body"] != pullRequestCommentMarker+"\nsecond" {
+		t.Fatalf("unexpected comments %v", comments.comments)
+	}
+}
+
+func TestGitHubWebhookPullRequestFallsBackToTitle(t *testing.T) {
+	ghMux := http.NewServeMux()
+	ghMux.HandleFunc("/repos/octo/app/pulls/7/files", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// GitHub omits the patch of large lockfiles.
+		_, _ = w.Write([]byte(`[{"filename":"go.mod"}]`))
+	})
+	emptyCompareMux(ghMux, "octo", "hello", "v1.0.0", "v1.1.0")
+	comments := &fakePullRequestComments{}
+	comments.register(ghMux)
+	ghClient := newGitHubTestClient(t, ghMux)
+	ollama, _ := newOllamaTestServer(t, validModelResponse)
+
+	receiver := &GitHubWebhookReceiver{
+		Analyzer:              &Analyzer{GitHub: ghClient, OllamaBaseURL: ollama.URL},
+		Secret:                []byte(testWebhookSecret),
+		CommentOnPullRequests: true,
+	}
+	rec := httptest.NewRecorder()
+	receiver.Handler().ServeHTTP(rec, newWebhookRequest(t, "pull_request", pullRequestEventBody("build(deps): bump github.com/octo/hello from 1.0.0 to 1.1.0"), testWebhookSecret))
+	receiver.Wait()
+
+	if comments.created != 1 {
+		t.Fatalf("expected 1 created comment, got %d", comments.created)
+	}
+}
+
+func TestGitHubWebhookIgnoresPullRequestsWhenDisabled(t *testing.T) {
+	receiver := &GitHubWebhookReceiver{Analyzer: &Analyzer{}, Secret: []byte(testWebhookSecret)}
+
+	rec := httptest.NewRecorder()
+	receiver.Handler().ServeHTTP(rec, newWebhookRequest(t, "pull_request", pullRequestEventBody("Bump x from 1.0.0 to 1.1.0"), testWebhookSecret))
+	body, _ := io.ReadAll(rec.Body)
+	if rec.Code != http.StatusOK || !strings.Contains(string(body), WebhookStatusIgnored) {
+		t.Fatalf("expected ignored delivery, got %d: %s", rec.Code, body)
+	}
+}
+
+func TestParseBumpTitle(t *testing.T) {
+	cases := []struct {
+		title          string
+		name, from, to string
+		ok             bool
+	}{
+		{"Bump golang.org/x/net from 0.17.0 to 0.23.0", "golang.org/x/net", "0.17.0", "0.23.0", true},
+		{"chore(deps): bump lodash from 4.17.20 to 4.17.21 in /web", "lodash", "4.17.20", "4.17.21", true},
+		{"Update module github.com/spf13/cobra to v1.8.0", "github.com/spf13/cobra", "", "v1.8.0", true},
+		{"Fix typo in README", "", "", "", false},
+	}
+	for _, tc := range cases {
+		name, from, to, ok := parseBumpTitle(tc.title)
+		if name != tc.name || from != tc.from || to != tc.to || ok != tc.ok {
+			t.Fatalf("%q: got (%q, %q, %q, %v)", tc.title, name, from, to, ok)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package pkg
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/v83/github"
+)
+
+// ErrForbidden is returned when GitHub denies access for a reason other than a rate limit, e.g.
+// missing token permissions or a blocked repository.
+var ErrForbidden = errors.New("github access forbidden")
+
+// secondaryRateLimitWait is how long GitHub asks clients to back off after a secondary rate
+// limit without Retry-After.
+const secondaryRateLimitWait = time.Minute
+
+// GitHubRateLimitError reports an exhausted GitHub rate limit and when it resets. It matches
+// ErrRateLimited.
+type GitHubRateLimitError struct {
+	// Secondary is set for GitHub's secondary (abuse) limits, which are not reflected in the
+	// remaining quota.
+	Secondary bool
+	ResetAt   time.Time
+}
+
+func (e *GitHubRateLimitError) Error() string {
+	if e.Secondary {
+		return "github secondary rate limit exceeded"
+	}
+	return ErrRateLimited.Error()
+}
+
+func (e *GitHubRateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// rateLimitReset returns when the rate limit behind err resets, if err is a rate limit error.
+func rateLimitReset(err error) (time.Time, bool) {
+	var rateErr *GitHubRateLimitError
+	if errors.As(err, &rateErr) && !rateErr.ResetAt.IsZero() {
+		return rateErr.ResetAt, true
+	}
+	return time.Time{}, false
+}
+
+// mapRateLimitError turns go-github's rate limit errors and bare 403/429 responses into
+// GitHubRateLimitError or ErrForbidden. It returns nil for other errors.
+func mapRateLimitError(err error) error {
+	var primary *github.RateLimitError
+	if errors.As(err, &primary) {
+		return &GitHubRateLimitError{ResetAt: primary.Rate.Reset.Time}
+	}
+	var secondary *github.AbuseRateLimitError
+	if errors.As(err, &secondary) {
+		wait := secondaryRateLimitWait
+		if secondary.RetryAfter != nil {
+			wait = *secondary.RetryAfter
+		}
+		return &GitHubRateLimitError{Secondary: true, ResetAt: time.Now().Add(wait)}
+	}
+	var ghErr *github.ErrorResponse
+	if errors.As(err, &ghErr) && ghErr.Response != nil {
+		switch ghErr.Response.StatusCode {
+		case http.StatusForbidden:
+			return ErrForbidden
+		case http.StatusTooManyRequests:
+			wait, ok := retryAfterHeader(ghErr.Response.Header)
+			if !ok {
+				wait = secondaryRateLimitWait
+			}
+			return &GitHubRateLimitError{Secondary: true, ResetAt: time.Now().Add(wait)}
+		}
+	}
+	return nil
+}
+
+// GitHubRateLimitTransport exports the remaining GitHub quota and retries a request once when it
+// hit a rate limit that resets within MaxWait and before the request's deadline. Other rate
+// limit responses are passed through for mapGitHubError.
+type GitHubRateLimitTransport struct {
+	// Base is the underlying transport; http.DefaultTransport when nil.
+	Base    http.RoundTripper
+	MaxWait time.Duration
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *GitHubRateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	// Requests authorized before reaching this transport use a caller's own token, whose quota
+	// says nothing about the server's.
+	serverQuota := req.Header.Get("Authorization") == ""
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if serverQuota {
+		observeGitHubRateLimitHeaders(resp.Header)
+	}
+
+	wait, secondary, limited := rateLimitWait(resp)
+	if !limited || !t.canWait(req, wait) {
+		return resp, nil
+	}
+	retry, ok := replayableRequest(req)
+	if !ok {
+		return resp, nil
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	limit := "primary"
+	if secondary {
+		limit = "secondary"
+	}
+	observeGitHubRateLimitWait(limit, wait)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	case <-timer.C:
+	}
+
+	resp, err = base.RoundTrip(retry)
+	if err == nil && serverQuota {
+		observeGitHubRateLimitHeaders(resp.Header)
+	}
+	return resp, err
+}
+
+// canWait reports whether waiting fits both MaxWait and the request's deadline.
+func (t *GitHubRateLimitTransport) canWait(req *http.Request, wait time.Duration) bool {
+	if wait > t.MaxWait {
+		return false
+	}
+	if deadline, ok := req.Context().Deadline(); ok && time.Until(deadline) <= wait {
+		return false
+	}
+	return true
+}
+
+// rateLimitWait returns how long to wait before retrying a rate limited response and whether
+// the secondary limit was hit. Forbidden responses without rate limit headers are not limited.
+func rateLimitWait(resp *http.Response) (time.Duration, bool, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false, false
+	}
+	if wait, ok := retryAfterHeader(resp.Header); ok {
+		return wait, true, true
+	}
+	if resp.Header.Get(github.HeaderRateRemaining) != "0" {
+		return 0, false, false
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get(github.HeaderRateReset), 10, 64)
+	if err != nil {
+		return 0, false, false
+	}
+	// GitHub's reset has second precision; a small buffer avoids retrying just before it.
+	wait := max(time.Until(time.Unix(reset, 0)), 0) + time.Second
+	return wait, false, true
+}
+
+func retryAfterHeader(h http.Header) (time.Duration, bool) {
+	seconds, err := strconv.Atoi(h.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// replayableRequest clones req for a retry, rewinding its body when it has one.
+func replayableRequest(req *http.Request) (*http.Request, bool) {
+	retry := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return retry, true
+	}
+	if req.GetBody == nil {
+		return nil, false
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, false
+	}
+	retry.Body = body
+	return retry, true
+}
+
+// observeGitHubRateLimitHeaders exports the remaining quota reported with a GitHub response.
+func observeGitHubRateLimitHeaders(h http.Header) {
+	remaining, err := strconv.Atoi(h.Get(github.HeaderRateRemaining))
+	if err != nil {
+		return
+	}
+	resource := h.Get(github.HeaderRateResource)
+	if resource == "" {
+		resource = "core"
+	}
+	setGitHubRateLimitRemaining(resource, remaining)
+}
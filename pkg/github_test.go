@@ -3,10 +3,18 @@ package pkg
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"reflect"
+	"strconv"
 	"testing"
+	"time"
+
+	"github.com/google/go-github/v83/github"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestParseGitHubRepoURL(t *testing.T) {
@@ -121,6 +129,45 @@ func TestGetRepoTagsPagination(t *testing.T) {
 	}
 }
 
+func TestGetRepoTagsWithETagOnlyForSinglePage(t *testing.T) {
+	pages := 2
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octo/hello/tags", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("page") == "2" {
+			_ = json.NewEncoder(w).Encode([]map[string]string{{"name": "v0.9.0"}})
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"page-1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"page-1"`)
+		if pages > 1 {
+			w.Header().Set("Link", fmt.Sprintf("<http://%s%s?page=2>; rel=\"next\"", r.Host, r.URL.Path))
+		}
+		_ = json.NewEncoder(w).Encode([]map[string]string{{"name": "v1.0.0"}})
+	})
+	client := newGitHubTestClient(t, mux)
+
+	tags, etag, err := GetRepoTagsWithETag(context.Background(), client, "https://github.com/octo/hello", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tags) != 2 || etag != "" {
+		t.Fatalf("expected both pages and no ETag, got %v and %q", tags, etag)
+	}
+
+	pages = 1
+	_, etag, err = GetRepoTagsWithETag(context.Background(), client, "https://github.com/octo/hello", "")
+	if err != nil || etag != `"page-1"` {
+		t.Fatalf("expected the ETag of a single page listing, got %q (%v)", etag, err)
+	}
+	if _, _, err := GetRepoTagsWithETag(context.Background(), client, "https://github.com/octo/hello", etag); !errors.Is(err, ErrNotModified) {
+		t.Fatalf("expected ErrNotModified, got %v", err)
+	}
+}
+
 func TestGetRepoTagsNotFound(t *testing.T) {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/repos/octo/hello/tags", func(w http.ResponseWriter, r *http.Request) {
@@ -136,17 +183,117 @@ func TestGetRepoTagsNotFound(t *testing.T) {
 }
 
 func TestGetRepoTagsRateLimited(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
 	mux := http.NewServeMux()
 	mux.HandleFunc("/repos/octo/hello/tags", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
 		w.WriteHeader(http.StatusForbidden)
 	})
 
 	client := newGitHubTestClient(t, mux)
 
 	_, err := GetRepoTags(context.Background(), client, "https://github.com/octo/hello")
-	if err != ErrRateLimited {
+	if !errors.Is(err, ErrRateLimited) {
 		t.Fatalf("expected ErrRateLimited, got %v", err)
 	}
+	if resetAt, ok := rateLimitReset(err); !ok || !resetAt.Equal(reset) {
+		t.Fatalf("expected reset at %v, got %v", reset, resetAt)
+	}
+}
+
+func TestGetRepoTagsSecondaryRateLimited(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octo/hello/tags", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"message":"You have exceeded a secondary rate limit","documentation_url":"https://docs.github.com/rest/overview/rate-limits-for-the-rest-api#about-secondary-rate-limits"}`))
+	})
+
+	client := newGitHubTestClient(t, mux)
+
+	_, err := GetRepoTags(context.Background(), client, "https://github.com/octo/hello")
+	var rateErr *GitHubRateLimitError
+	if !errors.As(err, &rateErr) || !rateErr.Secondary {
+		t.Fatalf("expected a secondary rate limit error, got %v", err)
+	}
+	if wait := time.Until(rateErr.ResetAt); wait < 110*time.Second || wait > 120*time.Second {
+		t.Fatalf("expected reset in about 120s, got %v", wait)
+	}
+}
+
+func TestGetRepoTagsForbidden(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octo/hello/tags", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"message":"Resource not accessible by personal access token"}`))
+	})
+
+	client := newGitHubTestClient(t, mux)
+
+	_, err := GetRepoTags(context.Background(), client, "https://github.com/octo/hello")
+	if !errors.Is(err, ErrForbidden) || errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected ErrForbidden, got %v", err)
+	}
+}
+
+func TestGitHubRateLimitTransportRetriesAfterReset(t *testing.T) {
+	var calls int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octo/hello/tags", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("X-RateLimit-Resource", "core")
+		if calls == 1 {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Unix(), 10))
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("X-RateLimit-Remaining", "4999")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"name":"v1.0.0"}]`))
+	})
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+
+	client := github.NewClient(&http.Client{Transport: &GitHubRateLimitTransport{Base: ts.Client().Transport, MaxWait: 5 * time.Second}})
+	client.BaseURL, _ = url.Parse(ts.URL + "/")
+
+	tags, err := GetRepoTags(context.Background(), client, "https://github.com/octo/hello")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 2 || len(tags) != 1 {
+		t.Fatalf("expected a retry after the reset, got %d calls and tags %v", calls, tags)
+	}
+	if got := testutil.ToFloat64(GitHubRateLimitRemaining.WithLabelValues("core")); got != 4999 {
+		t.Fatalf("expected remaining quota gauge of 4999, got %v", got)
+	}
+}
+
+func TestGitHubRateLimitTransportRespectsDeadline(t *testing.T) {
+	var calls int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octo/hello/tags", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "3")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+
+	client := github.NewClient(&http.Client{Transport: &GitHubRateLimitTransport{Base: ts.Client().Transport, MaxWait: 5 * time.Second}})
+	client.BaseURL, _ = url.Parse(ts.URL + "/")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := GetRepoTags(ctx, client, "https://github.com/octo/hello")
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited, got %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected no retry past the deadline, got %d calls", calls)
+	}
 }
 
 func TestGetRepoTagsInvalidURL(t *testing.T) {
@@ -232,3 +379,76 @@ func TestGetRepoTagsBailsOnBadResponse(t *testing.T) {
 		t.Fatalf("expected error")
 	}
 }
+
+func TestFetchComparisonDataCountsTruncations(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octo/hello/compare/v1.0.0...v1.2.0", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"commits":[{"commit":{"message":"a very long commit title"}},{"commit":{"message":"b"}},{"commit":{"message":"c"}}],"files":[]}`))
+	})
+	mux.HandleFunc("/repos/octo/hello/releases", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"tag_name":"v1.2.0","body":"long release notes"},{"tag_name":"v1.1.0","body":"short"},{"tag_name":"v1.0.0","body":"x"}]`))
+	})
+	client := newGitHubTestClient(t, mux)
+
+	before := make(map[string]float64)
+	kinds := []string{"commits", "commit_title", "release_note", "releases"}
+	for _, kind := range kinds {
+		before[kind] = testutil.ToFloat64(AnalysisTruncationCounter.WithLabelValues(kind))
+	}
+
+	limits := TruncationConfig{MaxCommits: 2, MaxCommitTitleLength: 10, MaxReleaseNoteLength: 10}
+	data, err := fetchComparisonData(context.Background(), client, "octo", "hello", "v1.0.0", "v1.2.0", 2, "fast", limits, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(data.CommitTitles) != 2 || len(data.ReleaseNotes) != 2 {
+		t.Fatalf("expected truncated input, got %+v", data)
+	}
+
+	for _, kind := range kinds {
+		if got := testutil.ToFloat64(AnalysisTruncationCounter.WithLabelValues(kind)) - before[kind]; got != 1 {
+			t.Errorf("expected 1 %s truncation, got %v", kind, got)
+		}
+	}
+}
+
+func TestFetchReleaseNotesSelectsSemverRange(t *testing.T) {
+	// v1.2.9 is a backport published after v2.0.0, v1.1.5 one below every range; v1.2.1 is
+	// listed after both ends of the range. Monorepo tags of other components must not leak in.
+	releases := `[{"tag_name":"v1.2.9","body":"backport"},{"tag_name":"v1.1.5","body":"old backport"},{"tag_name":"api/v1.2.0","body":"api"},{"tag_name":"web/v1.1.0","body":"web"},{"tag_name":"v2.0.0","body":"major"},{"tag_name":"nightly","body":"n"},{"tag_name":"v1.3.0","body":"minor"},{"tag_name":"sub/dir/v1.5.0","body":"sub"},{"tag_name":"api/v1.1.0","body":"api"},{"tag_name":"v1.2.0","body":"base"},{"tag_name":"api/v1.0.0","body":"api"},{"tag_name":"v1.2.1","body":"listed after both tags"}]`
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octo/hello/releases", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(releases))
+	})
+	client := newGitHubTestClient(t, mux)
+
+	tests := []struct {
+		name     string
+		from, to string
+		want     []string
+	}{
+		{name: "upgrade", from: "v1.2.0", to: "v2.0.0", want: []string{"v2.0.0", "v1.3.0", "v1.2.9", "v1.2.1", "v1.2.0"}},
+		{name: "downgrade", from: "v2.0.0", to: "v1.2.0", want: []string{"v2.0.0", "v1.3.0", "v1.2.9", "v1.2.1", "v1.2.0"}},
+		{name: "backport window", from: "v1.2.0", to: "v1.2.9", want: []string{"v1.2.9", "v1.2.1", "v1.2.0"}},
+		{name: "from a backport", from: "v1.2.9", to: "v2.0.0", want: []string{"v2.0.0", "v1.3.0", "v1.2.9"}},
+		{name: "prefixed tags", from: "api/v1.0.0", to: "api/v1.2.0", want: []string{"api/v1.2.0", "api/v1.1.0", "api/v1.0.0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notes, err := fetchReleaseNotes(context.Background(), client, "octo", "hello", tt.from, tt.to, 10, 0)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []string
+			for _, n := range notes {
+				got = append(got, n.Tag)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected releases %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package pkg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v83/github"
+)
+
+// GitHubTokenHeader carries a caller's own GitHub token, used instead of the server's
+// credentials for that request. It is needed when API keys occupy the Authorization header;
+// otherwise "Authorization: token <token>" works as well.
+const GitHubTokenHeader = "X-GitHub-Token"
+
+type userGitHubTokenKey struct{}
+
+// WithGitHubToken lets callers analyze repositories only they can access by sending their own
+// GitHub token in X-GitHub-Token or as "Authorization: token <token>". The token is moved from
+// the request headers into the context, so it is never logged, and only lives as long as the
+// request.
+func WithGitHubToken(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimSpace(r.Header.Get(GitHubTokenHeader))
+		if scheme, value, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "token") {
+			if token == "" {
+				token = strings.TrimSpace(value)
+			}
+			r.Header.Del("Authorization")
+		}
+		r.Header.Del(GitHubTokenHeader)
+		if token == "" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userGitHubTokenKey{}, token)))
+	})
+}
+
+func userGitHubToken(ctx context.Context) string {
+	token, _ := ctx.Value(userGitHubTokenKey{}).(string)
+	return token
+}
+
+// githubTokenScope identifies the caller's GitHub token for cache and coalescing keys without
+// keeping the token itself. It is empty for requests using the server's credentials.
+func githubTokenScope(ctx context.Context) string {
+	token := userGitHubToken(ctx)
+	if token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:8])
+}
+
+// githubClient returns the GitHub client for ctx: a client authenticated with the caller's
+// token when the request carries one, otherwise the server's client. Per-request clients start
+// with their own rate limit state and are discarded with the request.
+func (a *Analyzer) githubClient(ctx context.Context) *github.Client {
+	token := userGitHubToken(ctx)
+	if token == "" || a.GitHub == nil {
+		return a.GitHub
+	}
+	client := github.NewClient(a.GitHub.Client()).WithAuthToken(token)
+	client.BaseURL = a.GitHub.BaseURL
+	client.UploadURL = a.GitHub.UploadURL
+	return client
+}
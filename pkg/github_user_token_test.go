@@ -0,0 +1,84 @@
+package pkg
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWithGitHubTokenUsesCallerToken(t *testing.T) {
+	var compareAuth atomic.Value
+	ghMux := http.NewServeMux()
+	emptyCompareMux(ghMux, "octo", "private", "v1.0.0", "v1.1.0")
+	gh := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/compare/") {
+			compareAuth.Store(r.Header.Get("Authorization"))
+		}
+		ghMux.ServeHTTP(w, r)
+	})
+	ollama, _ := newOllamaTestServer(t, validModelResponse)
+
+	results, err := NewResultStore("")
+	if err != nil {
+		t.Fatalf("NewResultStore: %v", err)
+	}
+	analyzer := &Analyzer{GitHub: newGitHubTestClient(t, gh), OllamaBaseURL: ollama.URL, Results: results}
+	stored := AnalyzeResponse{Summary: SummaryInfo{Highlights: []string{"stored"}}}
+	route := analyzer.routeScope(context.Background(), "fast", "octo", "private")
+	if err := results.Put("https://github.com/octo/private", "v1.0.0", "v1.1.0", "fast", route, true, stored); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	var innerHeaders http.Header
+	handler := WithGitHubToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		innerHeaders = r.Header.Clone()
+		NewAnalyzeHandler(analyzer)(w, r)
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+	}{
+		{name: "header", header: GitHubTokenHeader, value: "user-token"},
+		{name: "authorization", header: "Authorization", value: "token user-token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compareAuth.Store("")
+			body := `{"repoUrl":"https://github.com/octo/private","fromTag":"v1.0.0","toTag":"v1.1.0","mode":"fast"}`
+			req := httptest.NewRequest(http.MethodPost, "/analyze", strings.NewReader(body))
+			req.Header.Set(tt.header, tt.value)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+			}
+			if strings.Contains(rec.Body.String(), "stored") {
+				t.Fatalf("expected the server's stored analysis not to be served to a caller token")
+			}
+			if got := compareAuth.Load(); got != "Bearer user-token" {
+				t.Fatalf("expected GitHub to be called with the caller's token, got %q", got)
+			}
+			if innerHeaders.Get(GitHubTokenHeader) != "" || innerHeaders.Get("Authorization") != "" {
+				t.Fatalf("expected the token to be removed from the request headers, got %v", innerHeaders)
+			}
+		})
+	}
+}
+
+func TestGitHubTokenScope(t *testing.T) {
+	ctx := context.Background()
+	if scope := githubTokenScope(ctx); scope != "" {
+		t.Fatalf("expected no scope without a caller token, got %q", scope)
+	}
+	a := githubTokenScope(context.WithValue(ctx, userGitHubTokenKey{}, "token-a"))
+	b := githubTokenScope(context.WithValue(ctx, userGitHubTokenKey{}, "token-b"))
+	if a == "" || a == b || strings.Contains(a, "token-a") {
+		t.Fatalf("expected distinct scopes that do not reveal the token, got %q and %q", a, b)
+	}
+}
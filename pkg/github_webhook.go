@@ -0,0 +1,281 @@
+package pkg
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v83/github"
+	"go.uber.org/zap"
+)
+
+// GitHubWebhookReceiver accepts GitHub release and tag webhook deliveries and precomputes the
+// analysis from the previous release to the new one in the background, storing it in Results.
+// With CommentOnPullRequests it also analyzes dependency-bump pull requests and comments on them.
+type GitHubWebhookReceiver struct {
+	Analyzer *Analyzer
+	Results  *ResultStore
+	// Secret is the webhook secret used to verify X-Hub-Signature-256. Deliveries are rejected
+	// when it is empty.
+	Secret []byte
+	// Mode is the analysis mode used for precomputed results; "fast" when empty.
+	Mode string
+	// CommentOnPullRequests enables analysis comments on Dependabot/Renovate pull requests.
+	// The GitHub token of Analyzer must be allowed to write issue comments.
+	CommentOnPullRequests bool
+	Logger                *zap.Logger
+
+	mu       sync.Mutex
+	inflight map[string]bool
+	wg       sync.WaitGroup
+}
+
+// WebhookResponse acknowledges a webhook delivery.
+type WebhookResponse struct {
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	RepoUrl string `json:"repoUrl,omitempty"`
+	Tag     string `json:"tag,omitempty"`
+	// PullRequest is the number of the pull request being commented on.
+	PullRequest int `json:"pullRequest,omitempty"`
+}
+
+// Webhook delivery outcomes reported in WebhookResponse.Status.
+const (
+	WebhookStatusQueued    = "queued"
+	WebhookStatusIgnored   = "ignored"
+	WebhookStatusDuplicate = "duplicate"
+)
+
+func (rcv *GitHubWebhookReceiver) logger() *zap.Logger {
+	if rcv.Logger == nil {
+		return zap.NewNop()
+	}
+	return rcv.Logger
+}
+
+func (rcv *GitHubWebhookReceiver) mode() string {
+	if rcv.Mode == "" {
+		return "fast"
+	}
+	return rcv.Mode
+}
+
+// Handler serves POST /webhooks/github.
+func (rcv *GitHubWebhookReceiver) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		event := github.WebHookType(r)
+		log := requestLogger(r.Context(), rcv.logger()).With(
+			zap.String("handler", "github_webhook"),
+			zap.String("event", event),
+			zap.String("delivery_id", github.DeliveryID(r)),
+		)
+
+		if r.Method != http.MethodPost {
+			log.Warn("method not allowed", zap.String("method", r.Method))
+			writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+			return
+		}
+		if len(rcv.Secret) == 0 {
+			log.Error("webhook secret not configured")
+			writeJSON(w, http.StatusServiceUnavailable, errorResponse{Error: "webhooks are not configured"})
+			return
+		}
+
+		payload, err := github.ValidatePayload(r, rcv.Secret)
+		if err != nil {
+			observeWebhookEvent(event, "invalid_signature")
+			log.Warn("invalid webhook signature", zap.Error(err))
+			writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "invalid signature"})
+			return
+		}
+		parsed, err := github.ParseWebHook(event, payload)
+		if err != nil {
+			observeWebhookEvent(event, "invalid_payload")
+			log.Warn("invalid webhook payload", zap.Error(err))
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid webhook payload"})
+			return
+		}
+
+		// The delivery is signed by GitHub, so its analyses may use the GitHub App.
+		ctx := withGitHubAppAccess(r.Context())
+		if pr, ok := parsed.(*github.PullRequestEvent); ok {
+			rcv.handlePullRequest(ctx, w, pr, event, log)
+			return
+		}
+
+		repoURL, tag, reason := webhookReleaseTag(parsed)
+		if reason != "" {
+			observeWebhookEvent(event, "ignored")
+			writeJSON(w, http.StatusOK, WebhookResponse{Status: WebhookStatusIgnored, Reason: reason})
+			return
+		}
+
+		resp := WebhookResponse{Status: WebhookStatusQueued, RepoUrl: repoURL, Tag: tag}
+		public := webhookRepoPublic(parsed)
+		if !rcv.schedule(ctx, repoURL+"@"+tag, func(ctx context.Context) { rcv.analyzeRelease(ctx, repoURL, tag, public) }) {
+			observeWebhookEvent(event, "duplicate")
+			resp.Status = WebhookStatusDuplicate
+			writeJSON(w, http.StatusOK, resp)
+			return
+		}
+		observeWebhookEvent(event, "queued")
+		log.Info("release analysis queued", zap.String("repo_url", repoURL), zap.String("tag", tag))
+		writeJSON(w, http.StatusAccepted, resp)
+	}
+}
+
+// Wait blocks until all queued analyses have finished.
+func (rcv *GitHubWebhookReceiver) Wait() {
+	rcv.wg.Wait()
+}
+
+// schedule runs fn in the background unless a job with the same key is still running.
+// A published release usually triggers both a create and a release delivery for the same tag.
+// fn gets ctx detached from the delivery's cancellation so it keeps the request ID and trace.
+func (rcv *GitHubWebhookReceiver) schedule(ctx context.Context, key string, fn func(context.Context)) bool {
+	key = strings.ToLower(key)
+	rcv.mu.Lock()
+	if rcv.inflight == nil {
+		rcv.inflight = make(map[string]bool)
+	}
+	if rcv.inflight[key] {
+		rcv.mu.Unlock()
+		return false
+	}
+	rcv.inflight[key] = true
+	rcv.mu.Unlock()
+
+	ctx = context.WithoutCancel(ctx)
+	rcv.wg.Add(1)
+	go func() {
+		defer rcv.wg.Done()
+		defer func() {
+			rcv.mu.Lock()
+			delete(rcv.inflight, key)
+			rcv.mu.Unlock()
+		}()
+		fn(ctx)
+	}()
+	return true
+}
+
+// analyzeRelease analyzes the upgrade to tag from the previous release and stores the result;
+// public tells whether the repository is public, i.e. the analysis may be served to anyone.
+func (rcv *GitHubWebhookReceiver) analyzeRelease(ctx context.Context, repoURL, tag string, public bool) {
+	log := requestLogger(ctx, rcv.logger()).With(zap.String("repo_url", repoURL), zap.String("tag", tag))
+
+	listCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	tags, err := GetRepoTags(listCtx, rcv.Analyzer.GitHub, repoURL)
+	cancel()
+	if err != nil {
+		observeWebhookAnalysis("error")
+		log.Warn("listing tags for webhook failed", zap.Error(err))
+		return
+	}
+	fromTag := previousReleaseTag(tags, tag)
+	if fromTag == "" {
+		observeWebhookAnalysis("no_previous_release")
+		log.Info("no previous release to compare against")
+		return
+	}
+
+	mode := rcv.mode()
+	owner, repo, err := ParseGitHubRepoURL(repoURL)
+	if err != nil {
+		observeWebhookAnalysis("error")
+		log.Warn("invalid repository url in webhook", zap.Error(err))
+		return
+	}
+	route := rcv.Analyzer.routeScope(ctx, mode, owner, repo)
+	if _, ok := rcv.Results.Get(repoURL, fromTag, tag, mode, route, true); ok {
+		observeWebhookAnalysis("already_stored")
+		return
+	}
+
+	analyzeCtx, cancel := context.WithTimeout(ctx, rcv.Analyzer.config().Timeouts.Analyze)
+	resp, err := rcv.Analyzer.Analyze(analyzeCtx, AnalyzeRequest{RepoUrl: repoURL, FromTag: fromTag, ToTag: tag, Mode: mode})
+	cancel()
+	if err != nil {
+		observeWebhookAnalysis("error")
+		log.Warn("webhook analysis failed", zap.String("from_tag", fromTag), zap.Error(err))
+		return
+	}
+	if err := rcv.Results.Put(repoURL, fromTag, tag, mode, route, public, resp); err != nil {
+		observeWebhookAnalysis("error")
+		log.Error("storing webhook analysis failed", zap.Error(err))
+		return
+	}
+	observeWebhookAnalysis("ok")
+	log.Info("webhook analysis stored", zap.String("from_tag", fromTag))
+}
+
+// webhookRepoPublic reports whether the repository of a release or tag creation event is public.
+func webhookRepoPublic(event any) bool {
+	switch e := event.(type) {
+	case *github.ReleaseEvent:
+		return !e.GetRepo().GetPrivate()
+	case *github.CreateEvent:
+		return !e.GetRepo().GetPrivate()
+	}
+	return false
+}
+
+// webhookReleaseTag extracts the repository and new tag from a release or tag creation event.
+// reason is non-empty when the event does not announce a new release.
+func webhookReleaseTag(event any) (repoURL, tag, reason string) {
+	switch e := event.(type) {
+	case *github.PingEvent:
+		return "", "", "ping"
+	case *github.ReleaseEvent:
+		if e.GetAction() != "published" {
+			return "", "", "release action " + e.GetAction()
+		}
+		if e.GetRelease().GetDraft() {
+			return "", "", "draft release"
+		}
+		repoURL, tag = e.GetRepo().GetHTMLURL(), e.GetRelease().GetTagName()
+	case *github.CreateEvent:
+		if e.GetRefType() != "tag" {
+			return "", "", "ref type " + e.GetRefType()
+		}
+		repoURL, tag = e.GetRepo().GetHTMLURL(), e.GetRef()
+	default:
+		return "", "", "unsupported event"
+	}
+
+	if _, _, err := ParseGitHubRepoURL(repoURL); err != nil {
+		return "", "", "unsupported repository"
+	}
+	if _, ok := parseSemver(tag); !ok {
+		return "", "", "tag is not a version"
+	}
+	return repoURL, tag, ""
+}
+
+// previousReleaseTag returns the highest non-prerelease tag below tag that uses the same tag
+// prefix, or "" when there is none.
+func previousReleaseTag(tags []string, tag string) string {
+	target, ok := parseSemver(tag)
+	if !ok {
+		return ""
+	}
+	prefix := versionTagPrefix(tag)
+	best := ""
+	var bestVersion semver
+	for _, t := range tags {
+		if versionTagPrefix(t) != prefix {
+			continue
+		}
+		v, ok := parseSemver(t)
+		if !ok || len(v.Prerelease) > 0 || compareSemver(v, target) >= 0 {
+			continue
+		}
+		if best == "" || compareSemver(v, bestVersion) > 0 {
+			best, bestVersion = t, v
+		}
+	}
+	return best
+}
@@ -0,0 +1,158 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+const testWebhookSecret = "s3cret"
+
+func newWebhookRequest(t *testing.T, event, body, secret string) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/github", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GitHub-Event", event)
+	req.Header.Set("X-GitHub-Delivery", "delivery-1")
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	return req
+}
+
+func TestGitHubWebhookPrecomputesReleaseAnalysis(t *testing.T) {
+	ghMux := http.NewServeMux()
+	ghMux.HandleFunc("/repos/octo/hello/tags", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"name":"v1.2.0"},{"name":"v1.2.0-rc.1"},{"name":"v1.1.0"},{"name":"v1.0.0"}]`))
+	})
+	emptyCompareMux(ghMux, "octo", "hello", "v1.1.0", "v1.2.0")
+	ghClient := newGitHubTestClient(t, ghMux)
+	ollama, ollamaCalls := newOllamaTestServer(t, validModelResponse)
+
+	results, err := NewResultStore(filepath.Join(t.TempDir(), "results.json"))
+	if err != nil {
+		t.Fatalf("new result store: %v", err)
+	}
+	analyzer := &Analyzer{GitHub: ghClient, OllamaBaseURL: ollama.URL, Logger: zap.NewNop(), Results: results}
+	receiver := &GitHubWebhookReceiver{Analyzer: analyzer, Results: results, Secret: []byte(testWebhookSecret)}
+
+	body := `{"action":"published","release":{"tag_name":"v1.2.0","draft":false},"repository":{"html_url":"https://github.com/octo/hello"}}`
+	rec := httptest.NewRecorder()
+	receiver.Handler().ServeHTTP(rec, newWebhookRequest(t, "release", body, testWebhookSecret))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusAccepted, rec.Code, rec.Body.String())
+	}
+	receiver.Wait()
+
+	if _, ok := results.Get("https://github.com/octo/hello", "v1.1.0", "v1.2.0", "fast", analyzer.routeScope(context.Background(), "fast", "octo", "hello"), false); !ok {
+		t.Fatalf("expected analysis v1.1.0...v1.2.0 to be stored")
+	}
+	calls := ollamaCalls.Load()
+
+	// The UI request for the same comparison is answered from the store.
+	reqBody, _ := json.Marshal(map[string]any{"repoUrl": "https://github.com/Octo/hello", "fromTag": "v1.1.0", "toTag": "v1.2.0", "mode": "fast"})
+	rec = httptest.NewRecorder()
+	NewAnalyzeHandler(analyzer).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/analyze", bytes.NewReader(reqBody)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if ollamaCalls.Load() != calls {
+		t.Fatalf("expected stored analysis to be served without calling the model")
+	}
+
+	reloaded, err := NewResultStore(results.path)
+	if err != nil {
+		t.Fatalf("reload result store: %v", err)
+	}
+	if _, ok := reloaded.Get("https://github.com/octo/hello", "v1.1.0", "v1.2.0", "fast", analyzer.routeScope(context.Background(), "fast", "octo", "hello"), false); !ok {
+		t.Fatalf("expected stored analysis to survive a reload")
+	}
+}
+
+func TestGitHubWebhookRejectsInvalidSignature(t *testing.T) {
+	receiver := &GitHubWebhookReceiver{Analyzer: &Analyzer{}, Secret: []byte(testWebhookSecret)}
+
+	body := `{"ref":"v1.0.0","ref_type":"tag","repository":{"html_url":"https://github.com/octo/hello"}}`
+	rec := httptest.NewRecorder()
+	receiver.Handler().ServeHTTP(rec, newWebhookRequest(t, "create", body, "wrong"))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status %d, got %d", http.StatusUnauthorized, rec.Code)
+	}
+	assertErrorJSON(t, rec.Body.Bytes())
+}
+
+func TestGitHubWebhookIgnoresNonReleaseEvents(t *testing.T) {
+	receiver := &GitHubWebhookReceiver{Analyzer: &Analyzer{}, Secret: []byte(testWebhookSecret)}
+
+	cases := map[string]string{
+		"create":  `{"ref":"feature/x","ref_type":"branch","repository":{"html_url":"https://github.com/octo/hello"}}`,
+		"release": `{"action":"created","release":{"tag_name":"v1.0.0","draft":true},"repository":{"html_url":"https://github.com/octo/hello"}}`,
+		"ping":    `{"zen":"Keep it logically awesome."}`,
+	}
+	for event, body := range cases {
+		rec := httptest.NewRecorder()
+		receiver.Handler().ServeHTTP(rec, newWebhookRequest(t, event, body, testWebhookSecret))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected status %d, got %d", event, http.StatusOK, rec.Code)
+		}
+		var resp WebhookResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp.Status != WebhookStatusIgnored {
+			t.Fatalf("%s: expected ignored, got %+v (%v)", event, resp, err)
+		}
+	}
+}
+
+func TestPreviousReleaseTag(t *testing.T) {
+	tags := []string{"v2.0.0", "v1.3.0-rc.1", "v1.2.5", "v1.10.0", "api/v1.9.0", "v0.9.0"}
+	if got := previousReleaseTag(tags, "v2.0.0"); got != "v1.10.0" {
+		t.Fatalf("expected v1.10.0, got %q", got)
+	}
+	if got := previousReleaseTag(tags, "v1.3.0"); got != "v1.2.5" {
+		t.Fatalf("expected v1.2.5, got %q", got)
+	}
+	if got := previousReleaseTag(tags, "v0.9.0"); got != "" {
+		t.Fatalf("expected no previous release, got %q", got)
+	}
+}
+
+func TestAnalyzeServesPrivateStoredAnalysesOnlyWithAppAccess(t *testing.T) {
+	ghMux := http.NewServeMux()
+	emptyCompareMux(ghMux, "octo", "private", "v1.0.0", "v1.1.0")
+	ollama, calls := newOllamaTestServer(t, validModelResponse)
+
+	results, _ := NewResultStore("")
+	analyzer := &Analyzer{GitHub: newGitHubTestClient(t, ghMux), OllamaBaseURL: ollama.URL, Results: results}
+	stored := AnalyzeResponse{Summary: SummaryInfo{Highlights: []string{"stored"}}}
+	route := analyzer.routeScope(context.Background(), "fast", "octo", "private")
+	if err := results.Put("https://github.com/octo/private", "v1.0.0", "v1.1.0", "fast", route, false, stored); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	req := AnalyzeRequest{RepoUrl: "https://github.com/octo/private", FromTag: "v1.0.0", ToTag: "v1.1.0", Mode: "fast"}
+
+	resp, err := analyzer.Analyze(withGitHubAppAccess(context.Background()), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Summary.Highlights) != 1 || resp.Summary.Highlights[0] != "stored" || calls.Load() != 0 {
+		t.Fatalf("expected the stored analysis for a caller with App access, got %+v", resp.Summary)
+	}
+
+	resp, err = analyzer.Analyze(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls.Load() != 1 || (len(resp.Summary.Highlights) > 0 && resp.Summary.Highlights[0] == "stored") {
+		t.Fatalf("expected a fresh analysis for an anonymous caller, got %+v", resp.Summary)
+	}
+}
@@ -0,0 +1,258 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// healthCheckTimeout bounds each dependency check of /readyz.
+const healthCheckTimeout = 5 * time.Second
+
+// Dependency statuses reported by /readyz.
+const (
+	DependencyStatusOK = "ok"
+	// DependencyStatusDegraded means the dependency responds but cannot serve every analysis, e.g.
+	// a model is missing or the GitHub rate limit is used up.
+	DependencyStatusDegraded = "degraded"
+	DependencyStatusDown     = "down"
+)
+
+// ReadinessResponse is the body of /readyz.
+type ReadinessResponse struct {
+	// Status is "ready" when every required dependency is ok, otherwise "not_ready".
+	Status       string             `json:"status"`
+	Dependencies []DependencyStatus `json:"dependencies"`
+}
+
+// DependencyStatus is the result of checking one dependency.
+type DependencyStatus struct {
+	Name string `json:"name"`
+	// Required dependencies make the service unready unless their status is ok.
+	Required      bool     `json:"required"`
+	Status        string   `json:"status"`
+	Url           string   `json:"url,omitempty"`
+	LatencyMs     int64    `json:"latencyMs"`
+	Error         string   `json:"error,omitempty"`
+	Models        []string `json:"models,omitempty"`
+	MissingModels []string `json:"missingModels,omitempty"`
+	// RateLimit is the core GitHub API rate limit.
+	RateLimit *RateLimitStatus `json:"rateLimit,omitempty"`
+}
+
+// RateLimitStatus reports a GitHub rate limit.
+type RateLimitStatus struct {
+	Limit     int    `json:"limit"`
+	Remaining int    `json:"remaining"`
+	ResetAt   string `json:"resetAt"`
+}
+
+type ollamaTagsResponse struct {
+	Models []struct {
+		Name string `json:"name"`
+	} `json:"models"`
+}
+
+// NewLivenessHandler serves /healthz, which only reports that the process is serving HTTP.
+func NewLivenessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
+
+// NewReadinessHandler serves /readyz. The service is ready when the Ollama server responds and
+// has every configured model pulled; fallback servers and the GitHub rate limit are reported but
+// do not affect readiness.
+func NewReadinessHandler(analyzer *Analyzer) http.HandlerFunc {
+	logger := analyzer.logger()
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := analyzer.CheckReadiness(r.Context())
+		status := http.StatusOK
+		if resp.Status != "ready" {
+			status = http.StatusServiceUnavailable
+			logger.Warn("not ready", zap.String("handler", "readyz"), zap.Any("dependencies", resp.Dependencies))
+		}
+		writeJSON(w, status, resp)
+	}
+}
+
+// CheckReadiness checks the Ollama servers and GitHub concurrently.
+func (a *Analyzer) CheckReadiness(ctx context.Context) ReadinessResponse {
+	cfg := a.config()
+	required := requiredModels(cfg.Ollama, a.OllamaBaseURL)
+
+	urls := make([]string, 0, len(required))
+	for u := range required {
+		urls = append(urls, u)
+	}
+	// The primary server first, then the fallback servers in a stable order.
+	slices.SortFunc(urls, func(x, y string) int {
+		switch {
+		case x == y:
+			return 0
+		case x == a.OllamaBaseURL:
+			return -1
+		case y == a.OllamaBaseURL:
+			return 1
+		}
+		return strings.Compare(x, y)
+	})
+
+	deps := make([]DependencyStatus, len(urls)+1)
+	var wg sync.WaitGroup
+	for i, u := range urls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			name := "ollama"
+			if u != a.OllamaBaseURL {
+				name = "ollama_fallback"
+			}
+			deps[i] = checkOllama(ctx, name, u, required[u], u == a.OllamaBaseURL)
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		deps[len(urls)] = a.checkGitHub(ctx)
+	}()
+	wg.Wait()
+
+	resp := ReadinessResponse{Status: "ready", Dependencies: deps}
+	for _, d := range deps {
+		if d.Required && d.Status != DependencyStatusOK {
+			resp.Status = "not_ready"
+		}
+	}
+	return resp
+}
+
+// requiredModels returns the models each Ollama server must provide, keyed by server URL.
+func requiredModels(cfg OllamaConfig, baseURL string) map[string][]string {
+	models := make(map[string][]string)
+	add := func(u, model string) {
+		if model != "" && !slices.Contains(models[u], model) {
+			models[u] = append(models[u], model)
+		}
+	}
+	add(baseURL, cfg.Fast.Model)
+	add(baseURL, cfg.Deep.Model)
+	for _, r := range cfg.Routes {
+		add(baseURL, r.Model)
+	}
+	for _, f := range cfg.Fallbacks {
+		u := f.URL
+		if u == "" {
+			u = baseURL
+		}
+		add(u, f.Model)
+	}
+	return models
+}
+
+// checkOllama lists the models pulled on an Ollama server via /api/tags.
+func checkOllama(ctx context.Context, name, baseURL string, models []string, required bool) DependencyStatus {
+	status := DependencyStatus{Name: name, Required: required, Url: baseURL, Models: models}
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	pulled, err := ollamaTags(ctx, baseURL)
+	status.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		status.Status = DependencyStatusDown
+		status.Error = err.Error()
+		return status
+	}
+
+	for _, m := range models {
+		if !pulled[ollamaModelName(m)] {
+			status.MissingModels = append(status.MissingModels, m)
+		}
+	}
+	status.Status = DependencyStatusOK
+	if len(status.MissingModels) > 0 {
+		status.Status = DependencyStatusDegraded
+		status.Error = "models not pulled: " + strings.Join(status.MissingModels, ", ")
+	}
+	return status
+}
+
+func ollamaTags(ctx context.Context, baseURL string) (map[string]bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(baseURL, "/")+"/api/tags", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("ollama /api/tags returned status " + strconv.Itoa(resp.StatusCode))
+	}
+
+	var tags ollamaTagsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, err
+	}
+	pulled := make(map[string]bool, len(tags.Models))
+	for _, m := range tags.Models {
+		pulled[ollamaModelName(m.Name)] = true
+	}
+	return pulled, nil
+}
+
+// ollamaModelName adds the implicit ":latest" tag so "llama3" and "llama3:latest" compare equal.
+func ollamaModelName(name string) string {
+	if !strings.Contains(name, ":") {
+		return name + ":latest"
+	}
+	return name
+}
+
+// checkGitHub reports the core rate limit of the GitHub client. Querying it does not count
+// against the limit.
+func (a *Analyzer) checkGitHub(ctx context.Context) DependencyStatus {
+	status := DependencyStatus{Name: "github"}
+	if a.GitHub == nil {
+		status.Status = DependencyStatusDown
+		status.Error = "no GitHub client configured"
+		return status
+	}
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	limits, _, err := a.GitHub.RateLimit.Get(ctx)
+	status.LatencyMs = time.Since(start).Milliseconds()
+	observeGitHubRequest(ctx, "get_rate_limit", mapGitHubError(err), start)
+	if err != nil {
+		status.Status = DependencyStatusDown
+		status.Error = err.Error()
+		return status
+	}
+
+	status.Status = DependencyStatusOK
+	if core := limits.GetCore(); core != nil {
+		setGitHubRateLimitRemaining("core", core.Remaining)
+		status.RateLimit = &RateLimitStatus{
+			Limit:     core.Limit,
+			Remaining: core.Remaining,
+			ResetAt:   core.Reset.UTC().Format(time.RFC3339),
+		}
+		if core.Remaining == 0 {
+			status.Status = DependencyStatusDegraded
+			status.Error = "rate limit exhausted"
+		}
+	}
+	return status
+}
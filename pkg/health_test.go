@@ -0,0 +1,104 @@
+package pkg
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func newOllamaTagsServer(t *testing.T, models ...string) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/tags" {
+			http.NotFound(w, r)
+			return
+		}
+		var resp ollamaTagsResponse
+		for _, m := range models {
+			resp.Models = append(resp.Models, struct {
+				Name string `json:"name"`
+			}{Name: m})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func rateLimitMux(remaining int) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rate_limit", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"resources": map[string]any{
+			"core": map[string]any{"limit": 5000, "remaining": remaining, "reset": 1767225600},
+		}})
+	})
+	return mux
+}
+
+func getReadiness(t *testing.T, analyzer *Analyzer) (int, ReadinessResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	NewReadinessHandler(analyzer).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var resp ReadinessResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode readiness: %v", err)
+	}
+	return rec.Code, resp
+}
+
+func TestLivenessHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewLivenessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+}
+
+func TestReadinessHandlerReady(t *testing.T) {
+	ollama := newOllamaTagsServer(t, "qwen2.5:3b", "qwen2.5:7b", "llama3:latest")
+	cfg := DefaultConfig()
+	cfg.Ollama.Routes = []ModelRoute{{Repos: []string{"octo/*"}, Model: "llama3"}}
+	analyzer := &Analyzer{GitHub: newGitHubTestClient(t, rateLimitMux(0)), OllamaBaseURL: ollama.URL, Config: &cfg}
+
+	code, resp := getReadiness(t, analyzer)
+	if code != http.StatusOK || resp.Status != "ready" {
+		t.Fatalf("expected ready, got %d %+v", code, resp)
+	}
+	if len(resp.Dependencies) != 2 {
+		t.Fatalf("expected ollama and github, got %+v", resp.Dependencies)
+	}
+	ollamaStatus, github := resp.Dependencies[0], resp.Dependencies[1]
+	if ollamaStatus.Name != "ollama" || ollamaStatus.Status != DependencyStatusOK || !slices.Equal(ollamaStatus.Models, []string{"qwen2.5:3b", "qwen2.5:7b", "llama3"}) {
+		t.Fatalf("unexpected ollama status %+v", ollamaStatus)
+	}
+	if github.Status != DependencyStatusDegraded || github.Required || github.RateLimit == nil || github.RateLimit.Limit != 5000 || github.RateLimit.ResetAt != "2026-01-01T00:00:00Z" {
+		t.Fatalf("expected exhausted GitHub rate limit to be reported without failing readiness, got %+v", github)
+	}
+}
+
+func TestReadinessHandlerMissingModel(t *testing.T) {
+	ollama := newOllamaTagsServer(t, "qwen2.5:3b")
+	cfg := DefaultConfig()
+	cfg.Ollama.Fallbacks = []ModelFallback{{URL: "http://127.0.0.1:1", ModelConfig: ModelConfig{Model: "backup", NumPredict: 100}}}
+	analyzer := &Analyzer{GitHub: newGitHubTestClient(t, rateLimitMux(4000)), OllamaBaseURL: ollama.URL, Config: &cfg}
+
+	code, resp := getReadiness(t, analyzer)
+	if code != http.StatusServiceUnavailable || resp.Status != "not_ready" {
+		t.Fatalf("expected not ready, got %d %+v", code, resp)
+	}
+	primary := resp.Dependencies[0]
+	if primary.Status != DependencyStatusDegraded || !slices.Equal(primary.MissingModels, []string{"qwen2.5:7b"}) {
+		t.Fatalf("expected missing deep model, got %+v", primary)
+	}
+	fallback := resp.Dependencies[1]
+	if fallback.Name != "ollama_fallback" || fallback.Required || fallback.Status != DependencyStatusDown {
+		t.Fatalf("expected unreachable optional fallback server, got %+v", fallback)
+	}
+	if github := resp.Dependencies[2]; github.Status != DependencyStatusOK || github.RateLimit.Remaining != 4000 {
+		t.Fatalf("unexpected github status %+v", github)
+	}
+}
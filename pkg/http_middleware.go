@@ -1,9 +1,15 @@
 package pkg
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"net/http"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
 	"go.uber.org/zap"
 )
 
@@ -20,22 +26,140 @@ func WrapHandler(handlerName string, handler http.Handler, logger *zap.Logger) h
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		rec := &statusRecorder{ResponseWriter: w}
+		info := &requestInfo{RequestID: r.Header.Get(RequestIDHeader)}
+		if !validRequestID(info.RequestID) {
+			info.RequestID = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, info.RequestID)
+		ctx, span := startServerSpan(r, handlerName)
+		defer span.End()
+		span.SetAttributes(attribute.String("request_id", info.RequestID))
 
-		handler.ServeHTTP(rec, r)
+		handler.ServeHTTP(rec, r.WithContext(context.WithValue(ctx, requestInfoKey{}, info)))
 
 		status := rec.status
 		if status == 0 {
 			status = http.StatusOK
 		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
 		duration := time.Since(start)
 		observeHTTPRequest(handlerName, r.Method, status, duration)
 
-		logger.Info("request completed",
+		fields := []zap.Field{
 			zap.String("handler", handlerName),
+			zap.String("request_id", info.RequestID),
 			zap.String("method", r.Method),
 			zap.String("path", r.URL.Path),
 			zap.Int("status", status),
 			zap.Duration("duration", duration),
-		)
+		}
+		if sc := span.SpanContext(); sc.IsValid() {
+			fields = append(fields, zap.String("trace_id", sc.TraceID().String()))
+		}
+		if info.Client != "" {
+			span.SetAttributes(attribute.String("client", info.Client))
+			observeAPIKeyRequest(info.Client, handlerName, status)
+			fields = append(fields, zap.String("client", info.Client))
+		}
+		logger.Info("request completed", fields...)
 	})
 }
+
+// RequestIDHeader carries the request ID. WrapHandler accepts it from callers, generates one
+// otherwise, echoes it in the response and forwards it to GitHub and Ollama.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds caller-provided request IDs.
+const maxRequestIDLength = 128
+
+// requestInfo collects per-request details set by inner middleware for WrapHandler to report.
+type requestInfo struct {
+	// Client is the ID of the API key that authenticated the request.
+	Client string
+	// RequestID correlates the logs, errors and outgoing calls of the request.
+	RequestID string
+}
+
+type requestInfoKey struct{}
+
+// validRequestID accepts caller-provided IDs of printable ASCII without spaces so they cannot
+// break log lines or headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// requestID returns the request ID of ctx, if any. Background work started by a request keeps
+// the ID as long as its context is derived from the request's.
+func requestID(ctx context.Context) string {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		return info.RequestID
+	}
+	return ""
+}
+
+// requestLogger adds the request ID of ctx to logger.
+func requestLogger(ctx context.Context, logger *zap.Logger) *zap.Logger {
+	if id := requestID(ctx); id != "" {
+		return logger.With(zap.String("request_id", id))
+	}
+	return logger
+}
+
+// setRequestIDHeader forwards the request ID of ctx on an outgoing request.
+func setRequestIDHeader(ctx context.Context, req *http.Request) {
+	if id := requestID(ctx); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+}
+
+// RequestIDTransport forwards the request ID of each outgoing request's context, e.g. for the
+// GitHub client.
+type RequestIDTransport struct {
+	// Base is the underlying transport; http.DefaultTransport when nil.
+	Base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *RequestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if id := requestID(req.Context()); id != "" && req.Header.Get(RequestIDHeader) == "" {
+		// RoundTrippers must not modify the caller's request.
+		req = req.Clone(req.Context())
+		req.Header.Set(RequestIDHeader, id)
+	}
+	return base.RoundTrip(req)
+}
+
+// requestClient returns the API key ID recorded for the request of ctx, if any.
+func requestClient(ctx context.Context) string {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		return info.Client
+	}
+	return ""
+}
+
+func setRequestClient(ctx context.Context, client string) {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		info.Client = client
+	}
+}
@@ -0,0 +1,117 @@
+package pkg
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-github/v83/github"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestWrapHandlerRequestID(t *testing.T) {
+	handler := WrapHandler("analyze", AnalyzeHandler(nil, "http://localhost:11434", zap.NewNop()), nil)
+
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{name: "generated", incoming: "", keep: false},
+		{name: "accepted", incoming: "abc-123", keep: true},
+		{name: "invalid replaced", incoming: "has space", keep: false},
+		{name: "too long replaced", incoming: strings.Repeat("a", maxRequestIDLength+1), keep: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/analyze", strings.NewReader("{"))
+			if tt.incoming != "" {
+				req.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			id := rec.Header().Get(RequestIDHeader)
+			if id == "" {
+				t.Fatalf("expected a request ID header")
+			}
+			if tt.keep && id != tt.incoming {
+				t.Fatalf("expected caller's request ID %q, got %q", tt.incoming, id)
+			}
+			if !tt.keep && (id == tt.incoming || len(id) != 32) {
+				t.Fatalf("expected a generated request ID, got %q", id)
+			}
+
+			var body errorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatalf("decode error response: %v", err)
+			}
+			if body.RequestID != id {
+				t.Fatalf("expected request ID %q in error body, got %q", id, body.RequestID)
+			}
+		})
+	}
+}
+
+func TestRequestIDPropagation(t *testing.T) {
+	const id = "req-42"
+
+	var githubIDs []string
+	ghMux := http.NewServeMux()
+	emptyCompareMux(ghMux, "octo", "hello", "v1.0.0", "v1.1.0")
+	gh := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		githubIDs = append(githubIDs, r.Header.Get(RequestIDHeader))
+		ghMux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(gh.Close)
+	client := github.NewClient(&http.Client{Transport: &RequestIDTransport{Base: gh.Client().Transport}})
+	client.BaseURL, _ = url.Parse(gh.URL + "/")
+
+	var ollamaCalls atomic.Int32
+	var ollamaID atomic.Value
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ollamaCalls.Add(1)
+		ollamaID.Store(r.Header.Get(RequestIDHeader))
+		_ = json.NewEncoder(w).Encode(map[string]any{"response": validModelResponse, "done": true})
+	}))
+	t.Cleanup(ollama.Close)
+
+	core, logs := observer.New(zap.InfoLevel)
+	analyzer := &Analyzer{GitHub: client, OllamaBaseURL: ollama.URL, Logger: zap.New(core)}
+	handler := WrapHandler("analyze", NewAnalyzeHandler(analyzer), zap.New(core))
+
+	body := `{"repoUrl":"https://github.com/octo/hello","fromTag":"v1.0.0","toTag":"v1.1.0","mode":"fast"}`
+	req := httptest.NewRequest(http.MethodPost, "/analyze", strings.NewReader(body))
+	req.Header.Set(RequestIDHeader, id)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	if len(githubIDs) == 0 {
+		t.Fatalf("expected GitHub requests")
+	}
+	for _, got := range githubIDs {
+		if got != id {
+			t.Fatalf("expected request ID %q on GitHub requests, got %q", id, got)
+		}
+	}
+	if ollamaCalls.Load() == 0 || ollamaID.Load() != id {
+		t.Fatalf("expected request ID %q on the Ollama request, got %v", id, ollamaID.Load())
+	}
+
+	if logs.Len() == 0 {
+		t.Fatalf("expected log lines")
+	}
+	for _, entry := range logs.All() {
+		if entry.ContextMap()["request_id"] != id {
+			t.Fatalf("expected request_id on log line %q, got %v", entry.Message, entry.ContextMap())
+		}
+	}
+}
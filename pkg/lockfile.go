@@ -0,0 +1,240 @@
+package pkg
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Supported dependency manifest formats for bulk analysis.
+const (
+	FormatGoMod       = "gomod"
+	FormatGoSum       = "gosum"
+	FormatPackageLock = "package-lock"
+)
+
+// Ecosystems a dependency can belong to.
+const (
+	EcosystemGo     = "go"
+	EcosystemNPM    = "npm"
+	EcosystemPyPI   = "pypi"
+	EcosystemCrates = "crates"
+)
+
+// ErrUnsupportedFormat is returned for manifest formats bulk analysis cannot parse.
+var ErrUnsupportedFormat = errors.New("unsupported manifest format")
+
+// DependencyChange is a dependency whose version differs between two manifests.
+type DependencyChange struct {
+	Ecosystem string `json:"ecosystem"`
+	Name      string `json:"name"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+}
+
+// ecosystemForFormat returns the package ecosystem a manifest format belongs to.
+func ecosystemForFormat(format string) (string, error) {
+	switch format {
+	case FormatGoMod, FormatGoSum:
+		return EcosystemGo, nil
+	case FormatPackageLock:
+		return EcosystemNPM, nil
+	default:
+		return "", ErrUnsupportedFormat
+	}
+}
+
+// ParseDependencies returns the dependency name → version map of a manifest.
+func ParseDependencies(format, content string) (map[string]string, error) {
+	switch format {
+	case FormatGoMod:
+		return parseGoMod(content), nil
+	case FormatGoSum:
+		return parseGoSum(content), nil
+	case FormatPackageLock:
+		return parsePackageLock(content)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+}
+
+// DiffDependencies parses both manifests and returns the dependencies that were present in
+// both with a different version, sorted by name. Added and removed dependencies are ignored
+// since there is nothing to upgrade from or to.
+func DiffDependencies(format, before, after string) ([]DependencyChange, error) {
+	ecosystem, err := ecosystemForFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	oldDeps, err := ParseDependencies(format, before)
+	if err != nil {
+		return nil, fmt.Errorf("parse before: %w", err)
+	}
+	newDeps, err := ParseDependencies(format, after)
+	if err != nil {
+		return nil, fmt.Errorf("parse after: %w", err)
+	}
+
+	changes := []DependencyChange{}
+	for name, to := range newDeps {
+		from, ok := oldDeps[name]
+		if !ok || from == to {
+			continue
+		}
+		changes = append(changes, DependencyChange{Ecosystem: ecosystem, Name: name, From: from, To: to})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes, nil
+}
+
+// SplitUnifiedDiff splits a unified diff into the removed ("before") and added ("after") sides,
+// keeping context lines on both. File headers and hunk markers are dropped.
+func SplitUnifiedDiff(diff string) (before, after string) {
+	var b, a strings.Builder
+	scanner := bufio.NewScanner(strings.NewReader(diff))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "---"), strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "@@"),
+			strings.HasPrefix(line, "diff "), strings.HasPrefix(line, "index "):
+			continue
+		case strings.HasPrefix(line, "-"):
+			b.WriteString(line[1:] + "\n")
+		case strings.HasPrefix(line, "+"):
+			a.WriteString(line[1:] + "\n")
+		case strings.HasPrefix(line, " "):
+			b.WriteString(line[1:] + "\n")
+			a.WriteString(line[1:] + "\n")
+		default:
+			b.WriteString(line + "\n")
+			a.WriteString(line + "\n")
+		}
+	}
+	return b.String(), a.String()
+}
+
+// parseGoMod reads the requirements of a go.mod file. It also accepts fragments, such as the
+// sides of a diff hunk inside a require block that lack the "require (" line: bare
+// "module version" lines outside any block are read as requirements as well.
+func parseGoMod(content string) map[string]string {
+	deps := make(map[string]string)
+	// block is the directive of the enclosing "directive (" block, if any.
+	block := ""
+	for _, raw := range strings.Split(content, "\n") {
+		line := raw
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if line == ")" {
+			block = ""
+			continue
+		}
+		if strings.HasSuffix(line, "(") {
+			block = strings.TrimSpace(strings.TrimSuffix(line, "("))
+			continue
+		}
+
+		switch {
+		case block == "require":
+			addGoRequirement(deps, line)
+		case block != "":
+			// exclude, replace, retract and tool blocks list no requirements.
+		case strings.HasPrefix(line, "require "):
+			addGoRequirement(deps, strings.TrimPrefix(line, "require "))
+		case isBareGoRequirement(line):
+			addGoRequirement(deps, line)
+		}
+	}
+	return deps
+}
+
+// isBareGoRequirement reports whether line is a "module version" pair without a directive.
+// Complete go.mod files have none outside blocks; diff hunks inside a require block do.
+func isBareGoRequirement(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) != 2 || !strings.HasPrefix(fields[1], "v") {
+		return false
+	}
+	_, ok := parseSemver(fields[1])
+	return ok
+}
+
+// parseGoSum keeps the highest version listed for each module; go.sum usually lists several.
+func parseGoSum(content string) map[string]string {
+	deps := make(map[string]string)
+	for _, raw := range strings.Split(content, "\n") {
+		fields := strings.Fields(raw)
+		if len(fields) < 2 {
+			continue
+		}
+		name := fields[0]
+		version := strings.TrimSuffix(fields[1], "/go.mod")
+		current, ok := deps[name]
+		if !ok {
+			deps[name] = version
+			continue
+		}
+		if cmp, ok := compareVersionTags(version, current); ok && cmp > 0 {
+			deps[name] = version
+		}
+	}
+	return deps
+}
+
+func addGoRequirement(deps map[string]string, line string) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return
+	}
+	deps[fields[0]] = fields[1]
+}
+
+type packageLockFile struct {
+	Packages map[string]struct {
+		Version string `json:"version"`
+		Link    bool   `json:"link"`
+	} `json:"packages"`
+	Dependencies map[string]struct {
+		Version string `json:"version"`
+	} `json:"dependencies"`
+}
+
+// parsePackageLock reads top-level packages from lockfileVersion 2/3 ("packages") or,
+// for older lockfiles, lockfileVersion 1 ("dependencies").
+func parsePackageLock(content string) (map[string]string, error) {
+	var lock packageLockFile
+	if err := json.Unmarshal([]byte(content), &lock); err != nil {
+		return nil, fmt.Errorf("invalid package-lock.json: %w", err)
+	}
+
+	deps := make(map[string]string)
+	if len(lock.Packages) > 0 {
+		for path, pkg := range lock.Packages {
+			if pkg.Link || pkg.Version == "" {
+				continue
+			}
+			name, ok := strings.CutPrefix(path, "node_modules/")
+			if !ok || strings.Contains(name, "/node_modules/") {
+				continue
+			}
+			deps[name] = pkg.Version
+		}
+		return deps, nil
+	}
+
+	for name, dep := range lock.Dependencies {
+		if dep.Version != "" {
+			deps[name] = dep.Version
+		}
+	}
+	return deps, nil
+}
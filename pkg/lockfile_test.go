@@ -0,0 +1,155 @@
+package pkg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGoMod(t *testing.T) {
+	content := `module example.com/app
+
+go 1.22
+
+require github.com/single/dep v1.0.0
+
+require (
+	github.com/spf13/cobra v1.8.0
+	golang.org/x/sys v0.20.0 // indirect
+)
+
+replace github.com/spf13/cobra => ../cobra
+`
+	got := parseGoMod(content)
+	want := map[string]string{
+		"github.com/single/dep":  "v1.0.0",
+		"github.com/spf13/cobra": "v1.8.0",
+		"golang.org/x/sys":       "v0.20.0",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestParseGoSumKeepsHighestVersion(t *testing.T) {
+	content := `github.com/spf13/cobra v1.7.0 h1:abc=
+github.com/spf13/cobra v1.7.0/go.mod h1:def=
+github.com/spf13/cobra v1.8.0/go.mod h1:ghi=
+github.com/spf13/cobra v1.8.0 h1:jkl=
+`
+	got := parseGoSum(content)
+	if got["github.com/spf13/cobra"] != "v1.8.0" {
+		t.Fatalf("expected v1.8.0, got %q", got["github.com/spf13/cobra"])
+	}
+}
+
+func TestParsePackageLock(t *testing.T) {
+	content := `{
+		"lockfileVersion": 3,
+		"packages": {
+			"": {"name": "app"},
+			"node_modules/express": {"version": "4.18.2"},
+			"node_modules/@types/node": {"version": "20.1.0"},
+			"node_modules/express/node_modules/debug": {"version": "2.6.9"},
+			"node_modules/local": {"link": true}
+		}
+	}`
+	got, err := parsePackageLock(content)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{"express": "4.18.2", "@types/node": "20.1.0"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestParsePackageLockV1(t *testing.T) {
+	got, err := parsePackageLock(`{"lockfileVersion":1,"dependencies":{"lodash":{"version":"4.17.21"}}}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got["lodash"] != "4.17.21" {
+		t.Fatalf("unexpected deps %v", got)
+	}
+}
+
+func TestDiffDependenciesFromUnifiedDiff(t *testing.T) {
+	diff := `diff --git a/go.mod b/go.mod
+--- a/go.mod
++++ b/go.mod
+@@ -3,6 +3,6 @@ go 1.22
+ require (
+-	github.com/spf13/cobra v1.7.0
++	github.com/spf13/cobra v1.8.0
+ 	github.com/stretchr/testify v1.9.0
+-	github.com/removed/dep v1.0.0
++	github.com/added/dep v1.0.0
+ )
+`
+	before, after := SplitUnifiedDiff(diff)
+	changes, err := DiffDependencies(FormatGoMod, before, after)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []DependencyChange{{Ecosystem: EcosystemGo, Name: "github.com/spf13/cobra", From: "v1.7.0", To: "v1.8.0"}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Fatalf("expected %v, got %v", want, changes)
+	}
+}
+
+func TestDiffDependenciesFromHunkInsideRequireBlock(t *testing.T) {
+	// Hunks deep inside a require block carry neither "require (" nor ")".
+	diff := `diff --git a/go.mod b/go.mod
+index 3b1f0c2..9d8e7a1 100644
+--- a/go.mod
++++ b/go.mod
+@@ -12,7 +12,7 @@ require (
+ 	github.com/prometheus/client_golang v1.19.0
+ 	go.opentelemetry.io/otel v1.24.0
+-	go.uber.org/zap v1.26.0
++	go.uber.org/zap v1.27.0
+ 	golang.org/x/mod v0.17.0 // indirect
+-	golang.org/x/sys v0.18.0 // indirect
++	golang.org/x/sys v0.19.0 // indirect
+ 	gopkg.in/yaml.v3 v3.0.1
+`
+	before, after := SplitUnifiedDiff(diff)
+	changes, err := DiffDependencies(FormatGoMod, before, after)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []DependencyChange{
+		{Ecosystem: EcosystemGo, Name: "go.uber.org/zap", From: "v1.26.0", To: "v1.27.0"},
+		{Ecosystem: EcosystemGo, Name: "golang.org/x/sys", From: "v0.18.0", To: "v0.19.0"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Fatalf("expected %v, got %v", want, changes)
+	}
+}
+
+func TestParseGoModSkipsOtherBlocks(t *testing.T) {
+	got := parseGoMod(`module example.com/app
+
+go 1.22
+
+require example.com/single v1.0.0
+
+exclude (
+	example.com/bad v1.1.0
+)
+
+replace (
+	example.com/old v1.0.0 => example.com/new v1.2.0
+)
+`)
+	want := map[string]string{"example.com/single": "v1.0.0"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestDiffDependenciesUnsupportedFormat(t *testing.T) {
+	if _, err := DiffDependencies("yarn", "", ""); err != ErrUnsupportedFormat {
+		t.Fatalf("expected ErrUnsupportedFormat, got %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RenderMarkdown renders an analysis result as a Markdown report suitable for CI logs and PR comments.
+func RenderMarkdown(resp AnalyzeResponse) string {
+	var b strings.Builder
+
+	title := resp.Meta.Repo.Url
+	if resp.Meta.FromTag != "" || resp.Meta.ToTag != "" {
+		title = fmt.Sprintf("%s `%s` → `%s`", title, resp.Meta.FromTag, resp.Meta.ToTag)
+	}
+	if resp.Rollback != nil {
+		title += " (rollback)"
+	}
+	fmt.Fprintf(&b, "## DiffBreak: %s\n\n", strings.TrimSpace(title))
+	fmt.Fprintf(&b, "**Risk:** %s (%d/100, confidence %s)\n\n", strings.ToUpper(resp.Risk.Level), resp.Risk.Score, resp.Risk.Confidence)
+
+	if len(resp.Risk.Reasons) > 0 {
+		for _, reason := range resp.Risk.Reasons {
+			fmt.Fprintf(&b, "- %s\n", markdownInline(reason))
+		}
+		b.WriteString("\n")
+	}
+
+	if len(resp.Summary.Highlights) > 0 {
+		b.WriteString("### Highlights\n\n")
+		for _, h := range resp.Summary.Highlights {
+			fmt.Fprintf(&b, "- %s\n", markdownInline(h))
+		}
+		b.WriteString("\n")
+	}
+
+	if resp.Rollback != nil {
+		renderRollbackMarkdown(&b, *resp.Rollback)
+		renderMarkdownFooter(&b, resp.Meta)
+		return b.String()
+	}
+
+	b.WriteString("### Breaking changes\n\n")
+	if len(resp.Breakers) == 0 {
+		b.WriteString("_None detected._\n\n")
+	} else {
+		b.WriteString("| Severity | Change | Reason | Evidence |\n")
+		b.WriteString("| --- | --- | --- | --- |\n")
+		for _, br := range resp.Breakers {
+			fmt.Fprintf(&b, "| %s | %s | %s | %s |\n",
+				markdownCell(br.Severity),
+				markdownCell(br.Title),
+				markdownCell(br.Reason),
+				markdownEvidence(br.Evidence),
+			)
+		}
+		b.WriteString("\n")
+	}
+
+	if len(resp.BehaviorChanges) > 0 {
+		b.WriteString("### Behavior changes\n\n")
+		for _, c := range resp.BehaviorChanges {
+			fmt.Fprintf(&b, "- **%s** — %s%s\n", markdownInline(c.Title), markdownInline(c.Reason), markdownEvidenceSuffix(c.Evidence))
+		}
+		b.WriteString("\n")
+	}
+
+	if len(resp.UpgradeSteps) > 0 {
+		b.WriteString("### Upgrade steps\n\n")
+		for i, s := range resp.UpgradeSteps {
+			fmt.Fprintf(&b, "%d. %s — %s%s\n", i+1, markdownInline(s.Step), markdownInline(s.Why), markdownEvidenceSuffix(s.Evidence))
+		}
+		b.WriteString("\n")
+	}
+
+	renderMarkdownFooter(&b, resp.Meta)
+	return b.String()
+}
+
+// renderRollbackMarkdown renders what a rollback loses in place of the upgrade sections.
+func renderRollbackMarkdown(b *strings.Builder, rb RollbackInfo) {
+	sections := []struct {
+		title   string
+		changes []RollbackChange
+	}{
+		{"Irreversible migrations", rb.IrreversibleMigrations},
+		{"Data format changes", rb.DataFormatChanges},
+		{"Removed features", rb.RemovedFeatures},
+	}
+	for _, section := range sections {
+		fmt.Fprintf(b, "### %s\n\n", section.title)
+		if len(section.changes) == 0 {
+			b.WriteString("_None detected._\n\n")
+			continue
+		}
+		b.WriteString("| Severity | Change | Reason | Evidence |\n")
+		b.WriteString("| --- | --- | --- | --- |\n")
+		for _, c := range section.changes {
+			fmt.Fprintf(b, "| %s | %s | %s | %s |\n",
+				markdownCell(c.Severity),
+				markdownCell(c.Title),
+				markdownCell(c.Reason),
+				markdownEvidence(c.Evidence),
+			)
+		}
+		b.WriteString("\n")
+	}
+
+	if len(rb.Steps) > 0 {
+		b.WriteString("### Rollback steps\n\n")
+		for i, s := range rb.Steps {
+			fmt.Fprintf(b, "%d. %s — %s%s\n", i+1, markdownInline(s.Step), markdownInline(s.Why), markdownEvidenceSuffix(s.Evidence))
+		}
+		b.WriteString("\n")
+	}
+}
+
+func renderMarkdownFooter(b *strings.Builder, meta MetaInfo) {
+	switch {
+	case meta.GeneratedAt != "" && meta.Model != "":
+		fmt.Fprintf(b, "_Generated at %s by `%s`._\n", meta.GeneratedAt, meta.Model)
+	case meta.GeneratedAt != "":
+		fmt.Fprintf(b, "_Generated at %s._\n", meta.GeneratedAt)
+	}
+}
+
+func markdownInline(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+func markdownCell(text string) string {
+	return strings.ReplaceAll(markdownInline(text), "|", "\\|")
+}
+
+func markdownEvidence(evidence []EvidenceLink) string {
+	links := make([]string, 0, len(evidence))
+	for _, e := range evidence {
+		if e.Url == "" {
+			continue
+		}
+		label := markdownCell(e.Label)
+		if label == "" {
+			label = "link"
+		}
+		links = append(links, fmt.Sprintf("[%s](%s)", label, e.Url))
+	}
+	return strings.Join(links, ", ")
+}
+
+func markdownEvidenceSuffix(evidence []EvidenceLink) string {
+	links := markdownEvidence(evidence)
+	if links == "" {
+		return ""
+	}
+	return " (" + links + ")"
+}
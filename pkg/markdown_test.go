@@ -0,0 +1,88 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	resp := AnalyzeResponse{
+		Risk:    RiskInfo{Level: "high", Score: 72, Confidence: "medium", Reasons: []string{"API removed"}},
+		Summary: SummaryInfo{Highlights: []string{"New major version"}},
+		Breakers: []Breaker{{
+			Title:    "Removed Foo | Bar",
+			Severity: "high",
+			Reason:   "Foo was\ndeleted",
+			Evidence: []EvidenceLink{{Label: "PR #1", Url: "https://github.com/octo/hello/pull/1"}},
+		}},
+		UpgradeSteps: []UpgradeStep{{Step: "Replace Foo", Why: "it is gone"}},
+		Meta: MetaInfo{
+			Repo:    RepoMeta{Url: "https://github.com/octo/hello"},
+			FromTag: "v1.0.0",
+			ToTag:   "v2.0.0",
+		},
+	}
+
+	out := RenderMarkdown(resp)
+
+	wants := []string{
+		"## DiffBreak: https://github.com/octo/hello `v1.0.0` → `v2.0.0`",
+		"**Risk:** HIGH (72/100, confidence medium)",
+		"- API removed",
+		"| high | Removed Foo \\| Bar | Foo was deleted | [PR #1](https://github.com/octo/hello/pull/1) |",
+		"1. Replace Foo — it is gone",
+	}
+	for _, want := range wants {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected markdown to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestRenderMarkdownNoBreakers(t *testing.T) {
+	out := RenderMarkdown(AnalyzeResponse{Risk: RiskInfo{Level: "low"}})
+	if !strings.Contains(out, "_None detected._") {
+		t.Fatalf("expected empty breakers note, got:\n%s", out)
+	}
+}
+
+func TestRiskLevelRank(t *testing.T) {
+	if !(RiskLevelRank("high") > RiskLevelRank("medium") && RiskLevelRank("medium") > RiskLevelRank("low")) {
+		t.Fatalf("unexpected risk level ordering")
+	}
+	if RiskLevelRank("HIGH") != RiskLevelRank("high") {
+		t.Fatalf("expected case-insensitive ranking")
+	}
+	if RiskLevelRank("critical") != 0 {
+		t.Fatalf("expected unknown level to rank 0")
+	}
+}
+
+func TestRenderMarkdownRollback(t *testing.T) {
+	resp := AnalyzeResponse{
+		Risk: RiskInfo{Level: "high", Score: 80, Confidence: "medium"},
+		Rollback: &RollbackInfo{
+			IrreversibleMigrations: []RollbackChange{{Title: "Schema v5", Severity: "high", Reason: "drops column"}},
+			Steps:                  []UpgradeStep{{Step: "Restore backup", Why: "schema cannot be downgraded"}},
+		},
+		Meta: MetaInfo{Repo: RepoMeta{Url: "https://github.com/octo/hello"}, FromTag: "v2.0.0", ToTag: "v1.0.0"},
+	}
+
+	out := RenderMarkdown(resp)
+
+	wants := []string{
+		"`v2.0.0` → `v1.0.0` (rollback)",
+		"### Irreversible migrations",
+		"| high | Schema v5 | drops column |  |",
+		"### Data format changes\n\n_None detected._",
+		"1. Restore backup — schema cannot be downgraded",
+	}
+	for _, want := range wants {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected markdown to contain %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "Breaking changes") {
+		t.Fatalf("expected no upgrade sections in a rollback, got:\n%s", out)
+	}
+}
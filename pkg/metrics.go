@@ -1,6 +1,7 @@
 package pkg
 
 import (
+	"context"
 	"errors"
 	"strconv"
 	"time"
@@ -47,6 +48,186 @@ var OllamaRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
 	Buckets: prometheus.DefBuckets,
 }, []string{"status"})
 
+// RegistryRequestCounter tracks package registry lookups by status.
+var RegistryRequestCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "registry_requests_total",
+	Help: "Total number of package registry requests",
+}, []string{"status"})
+
+// RegistryRequestDuration tracks package registry latency by status.
+var RegistryRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "registry_request_duration_seconds",
+	Help:    "Package registry request latency in seconds",
+	Buckets: prometheus.DefBuckets,
+}, []string{"status"})
+
+// WatchPollCounter tracks watch polls by result.
+var WatchPollCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "watch_polls_total",
+	Help: "Total number of watch polls by result",
+}, []string{"result"})
+
+// WatchNotificationCounter tracks outgoing watch notifications by status.
+var WatchNotificationCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "watch_notifications_total",
+	Help: "Total number of new-release notifications sent",
+}, []string{"status"})
+
+// WebhookEventCounter tracks incoming GitHub webhook deliveries by event and result.
+var WebhookEventCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "webhook_events_total",
+	Help: "Total number of GitHub webhook deliveries received",
+}, []string{"event", "result"})
+
+// WebhookAnalysisCounter tracks background analyses triggered by webhooks by result.
+var WebhookAnalysisCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "webhook_analyses_total",
+	Help: "Total number of analyses precomputed from webhook deliveries",
+}, []string{"result"})
+
+// PullRequestCommentCounter tracks pull request analysis comments by result.
+var PullRequestCommentCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "pull_request_comments_total",
+	Help: "Total number of pull request analysis comments by result",
+}, []string{"result"})
+
+// APIKeyRequestCounter tracks authenticated requests by API key ID, handler, and status code.
+var APIKeyRequestCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "api_key_requests_total",
+	Help: "Total number of authenticated HTTP requests by API key",
+}, []string{"key", "handler", "status"})
+
+// RateLimitedCounter tracks requests rejected by the per-client rate limiter.
+var RateLimitedCounter = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "rate_limited_requests_total",
+	Help: "Total number of requests rejected by the per-client rate limiter",
+})
+
+// ModelQueueDepth reports the number of model calls waiting for a slot.
+var ModelQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "model_queue_depth",
+	Help: "Number of model calls waiting for a free slot",
+})
+
+// ModelQueueInFlight reports the number of model calls holding a slot.
+var ModelQueueInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "model_queue_in_flight",
+	Help: "Number of model calls currently running",
+})
+
+// ModelQueueWaitDuration tracks how long model calls waited for a slot by result.
+var ModelQueueWaitDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "model_queue_wait_seconds",
+	Help:    "Time model calls waited for a free slot in seconds",
+	Buckets: []float64{0.1, 0.5, 1, 2.5, 5, 10, 20, 30, 60, 120},
+}, []string{"result"})
+
+// AnalysisCoalescedCounter tracks analyses that joined an identical in-flight analysis.
+var AnalysisCoalescedCounter = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "analysis_coalesced_total",
+	Help: "Total number of analysis requests served by an identical in-flight analysis",
+})
+
+// ModelFallbackCounter tracks model attempts that failed and were handed to the next model of
+// the fallback chain, by failed model and reason.
+var ModelFallbackCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "model_fallbacks_total",
+	Help: "Total number of failed model attempts handed to a fallback model",
+}, []string{"model", "reason"})
+
+// ModelAnalysisCounter tracks completed analyses by the model that produced them.
+var ModelAnalysisCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "model_analyses_total",
+	Help: "Total number of analyses produced, by model and whether it was a fallback",
+}, []string{"model", "fallback"})
+
+// PromptSizeBytes tracks the size of analysis prompts by mode.
+var PromptSizeBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "analysis_prompt_bytes",
+	Help:    "Size of analysis prompts in bytes",
+	Buckets: prometheus.ExponentialBuckets(1024, 2, 10),
+}, []string{"mode"})
+
+// PromptTokensEstimated tracks the estimated token count of analysis prompts by mode.
+var PromptTokensEstimated = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "analysis_prompt_tokens_estimated",
+	Help:    "Estimated number of tokens in analysis prompts",
+	Buckets: prometheus.ExponentialBuckets(256, 2, 10),
+}, []string{"mode"})
+
+// OllamaPromptEvalTokens tracks the prompt tokens Ollama evaluated per call by model.
+var OllamaPromptEvalTokens = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "ollama_prompt_eval_tokens",
+	Help:    "Prompt tokens evaluated per Ollama call (prompt_eval_count)",
+	Buckets: prometheus.ExponentialBuckets(256, 2, 10),
+}, []string{"model"})
+
+// OllamaEvalTokens tracks the tokens Ollama generated per call by model.
+var OllamaEvalTokens = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "ollama_eval_tokens",
+	Help:    "Tokens generated per Ollama call (eval_count)",
+	Buckets: prometheus.ExponentialBuckets(64, 2, 10),
+}, []string{"model"})
+
+// OllamaTokensPerSecond tracks the generation speed of Ollama calls by model.
+var OllamaTokensPerSecond = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "ollama_eval_tokens_per_second",
+	Help:    "Tokens generated per second by Ollama (eval_count / eval_duration)",
+	Buckets: []float64{1, 2.5, 5, 10, 20, 40, 80, 160},
+}, []string{"model"})
+
+// ModelRepairAttemptCounter tracks repair prompts sent after an answer of the wrong shape.
+var ModelRepairAttemptCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "model_repair_attempts_total",
+	Help: "Total number of repair prompts sent for model answers of the wrong shape",
+}, []string{"model"})
+
+// ModelRepairSuccessCounter tracks repair prompts that produced a valid analysis.
+var ModelRepairSuccessCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "model_repair_successes_total",
+	Help: "Total number of repair prompts that produced a valid analysis",
+}, []string{"model"})
+
+// ModelValidationFailureCounter tracks model answers rejected by validation, by phase and
+// reason.
+var ModelValidationFailureCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "model_validation_failures_total",
+	Help: "Total number of model answers that failed validation",
+}, []string{"phase", "reason"})
+
+// AnalysisRiskLevelCounter tracks completed analyses by mode and risk level.
+var AnalysisRiskLevelCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "analysis_risk_levels_total",
+	Help: "Total number of completed analyses by risk level",
+}, []string{"mode", "level"})
+
+// AnalysisTruncationCounter tracks input cut to fit the truncation limits, by what was cut.
+var AnalysisTruncationCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "analysis_truncations_total",
+	Help: "Total number of analysis inputs truncated to the configured limits",
+}, []string{"kind"})
+
+// GitHubRateLimitRemaining reports the remaining GitHub quota by rate limit resource, as of the
+// last response.
+var GitHubRateLimitRemaining = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "github_rate_limit_remaining",
+	Help: "Remaining GitHub API requests in the current rate limit window",
+}, []string{"resource"})
+
+// GitHubRateLimitWaitDuration tracks waits for a GitHub rate limit to reset by limit.
+var GitHubRateLimitWaitDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "github_rate_limit_wait_seconds",
+	Help:    "Time spent waiting for a GitHub rate limit to reset before retrying",
+	Buckets: []float64{1, 2.5, 5, 10, 20, 30, 60},
+}, []string{"limit"})
+
+// GitHubGraphQLFallbackCounter tracks comparisons fetched over REST because the GraphQL query
+// failed, by reason.
+var GitHubGraphQLFallbackCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "github_graphql_fallbacks_total",
+	Help: "Total number of GitHub GraphQL fetches that fell back to the REST API",
+}, []string{"reason"})
+
 // RegisterMetrics registers all application metrics with the provided registry.
 func RegisterMetrics(reg *prometheus.Registry) {
 	reg.MustRegister(
@@ -56,6 +237,34 @@ func RegisterMetrics(reg *prometheus.Registry) {
 		GitHubRequestDuration,
 		OllamaRequestCounter,
 		OllamaRequestDuration,
+		RegistryRequestCounter,
+		RegistryRequestDuration,
+		WatchPollCounter,
+		WatchNotificationCounter,
+		WebhookEventCounter,
+		WebhookAnalysisCounter,
+		PullRequestCommentCounter,
+		APIKeyRequestCounter,
+		RateLimitedCounter,
+		ModelQueueDepth,
+		ModelQueueInFlight,
+		ModelQueueWaitDuration,
+		AnalysisCoalescedCounter,
+		ModelFallbackCounter,
+		ModelAnalysisCounter,
+		PromptSizeBytes,
+		PromptTokensEstimated,
+		OllamaPromptEvalTokens,
+		OllamaEvalTokens,
+		OllamaTokensPerSecond,
+		ModelRepairAttemptCounter,
+		ModelRepairSuccessCounter,
+		ModelValidationFailureCounter,
+		AnalysisRiskLevelCounter,
+		AnalysisTruncationCounter,
+		GitHubRateLimitRemaining,
+		GitHubRateLimitWaitDuration,
+		GitHubGraphQLFallbackCounter,
 	)
 }
 
@@ -65,14 +274,30 @@ func observeHTTPRequest(handler, method string, status int, duration time.Durati
 	HttpRequestDuration.WithLabelValues(handler, method, statusLabel).Observe(duration.Seconds())
 }
 
-func observeGitHubRequest(operation string, err error, duration time.Duration) {
+func observeAPIKeyRequest(key, handler string, status int) {
+	APIKeyRequestCounter.WithLabelValues(key, handler, strconv.Itoa(status)).Inc()
+}
+
+// observeGitHubRequest records a GitHub API call that began at start in the metrics and as a
+// trace span.
+func observeGitHubRequest(ctx context.Context, operation string, err error, start time.Time) {
+	duration := time.Since(start)
+	traceGitHubRequest(ctx, operation, start, err)
 	status := "ok"
 	if err != nil {
 		switch {
+		case errors.Is(err, ErrNotModified):
+			status = "not_modified"
 		case errors.Is(err, ErrRepoNotFound):
 			status = "not_found"
 		case errors.Is(err, ErrRateLimited):
 			status = "rate_limited"
+			var rateErr *GitHubRateLimitError
+			if errors.As(err, &rateErr) && rateErr.Secondary {
+				status = "secondary_rate_limited"
+			}
+		case errors.Is(err, ErrForbidden):
+			status = "forbidden"
 		default:
 			status = "error"
 		}
@@ -85,3 +310,107 @@ func observeOllamaRequest(status string, duration time.Duration) {
 	OllamaRequestCounter.WithLabelValues(status).Inc()
 	OllamaRequestDuration.WithLabelValues(status).Observe(duration.Seconds())
 }
+
+func observeRegistryRequest(status string, duration time.Duration) {
+	RegistryRequestCounter.WithLabelValues(status).Inc()
+	RegistryRequestDuration.WithLabelValues(status).Observe(duration.Seconds())
+}
+
+func observeWatchPoll(result string) {
+	WatchPollCounter.WithLabelValues(result).Inc()
+}
+
+func observeWatchNotification(status string) {
+	WatchNotificationCounter.WithLabelValues(status).Inc()
+}
+
+func observeWebhookEvent(event, result string) {
+	WebhookEventCounter.WithLabelValues(event, result).Inc()
+}
+
+func observeWebhookAnalysis(result string) {
+	WebhookAnalysisCounter.WithLabelValues(result).Inc()
+}
+
+func observePullRequestComment(result string) {
+	PullRequestCommentCounter.WithLabelValues(result).Inc()
+}
+
+func observeRateLimited() {
+	RateLimitedCounter.Inc()
+}
+
+func observeModelQueueWait(result string, wait time.Duration) {
+	ModelQueueWaitDuration.WithLabelValues(result).Observe(wait.Seconds())
+}
+
+func setModelQueueDepth(n int) {
+	ModelQueueDepth.Set(float64(n))
+}
+
+func setModelQueueInFlight(n int) {
+	ModelQueueInFlight.Set(float64(n))
+}
+
+func observeAnalysisCoalesced() {
+	AnalysisCoalescedCounter.Inc()
+}
+
+func observeModelFallback(model, reason string) {
+	ModelFallbackCounter.WithLabelValues(model, reason).Inc()
+}
+
+func observeModelAnalysis(model string, fallback bool) {
+	ModelAnalysisCounter.WithLabelValues(model, strconv.FormatBool(fallback)).Inc()
+}
+
+func observePromptSize(mode string, bytes, tokens int) {
+	PromptSizeBytes.WithLabelValues(mode).Observe(float64(bytes))
+	PromptTokensEstimated.WithLabelValues(mode).Observe(float64(tokens))
+}
+
+// observeOllamaTokens records the token counts Ollama reports for a finished call. Older
+// servers omit them, so zero values are skipped.
+func observeOllamaTokens(model string, resp ollamaGenerateResponse) {
+	if resp.PromptEvalCount > 0 {
+		OllamaPromptEvalTokens.WithLabelValues(model).Observe(float64(resp.PromptEvalCount))
+	}
+	if resp.EvalCount > 0 {
+		OllamaEvalTokens.WithLabelValues(model).Observe(float64(resp.EvalCount))
+		if resp.EvalDuration > 0 {
+			OllamaTokensPerSecond.WithLabelValues(model).Observe(float64(resp.EvalCount) / time.Duration(resp.EvalDuration).Seconds())
+		}
+	}
+}
+
+func observeModelRepairAttempt(model string) {
+	ModelRepairAttemptCounter.WithLabelValues(model).Inc()
+}
+
+func observeModelRepairSuccess(model string) {
+	ModelRepairSuccessCounter.WithLabelValues(model).Inc()
+}
+
+func observeModelValidationFailure(phase, reason string) {
+	ModelValidationFailureCounter.WithLabelValues(phase, reason).Inc()
+}
+
+func observeAnalysisRiskLevel(mode, level string) {
+	AnalysisRiskLevelCounter.WithLabelValues(mode, level).Inc()
+}
+
+func observeTruncation(kind string) {
+	AnalysisTruncationCounter.WithLabelValues(kind).Inc()
+}
+
+func setGitHubRateLimitRemaining(resource string, remaining int) {
+	GitHubRateLimitRemaining.WithLabelValues(resource).Set(float64(remaining))
+}
+
+func observeGitHubRateLimitWait(limit string, wait time.Duration) {
+	GitHubRateLimitWaitDuration.WithLabelValues(limit).Observe(wait.Seconds())
+}
+
+func observeGraphQLFallback(reason string) {
+	GitHubGraphQLFallbackCounter.WithLabelValues(reason).Inc()
+}
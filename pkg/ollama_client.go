@@ -12,23 +12,23 @@ import (
 )
 
 // callOllama sends the analysis prompt to Ollama and returns the model response as raw JSON.
-func callOllama(ctx context.Context, baseURL, prompt, mode string) ([]byte, error) {
+func callOllama(ctx context.Context, baseURL string, model ModelConfig, prompt string) ([]byte, error) {
 	start := time.Now()
 	status := "ok"
 	defer func() {
 		observeOllamaRequest(status, time.Since(start))
 	}()
 
-	model, numPredict := ollamaConfig(mode)
 	url := strings.TrimRight(baseURL, "/") + "/api/generate"
 
 	payload := ollamaGenerateRequest{
-		Model:  model,
+		Model:  model.Model,
 		Prompt: prompt,
 		Stream: false,
 		Options: ollamaOptions{
-			Temperature: 0.2,
-			NumPredict:  numPredict,
+			Temperature: model.Temperature,
+			NumPredict:  model.NumPredict,
+			NumCtx:      model.NumCtx,
 		},
 	}
 
@@ -42,6 +42,7 @@ func callOllama(ctx context.Context, baseURL, prompt, mode string) ([]byte, erro
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
+	setRequestIDHeader(ctx, req)
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
@@ -68,13 +69,7 @@ func callOllama(ctx context.Context, baseURL, prompt, mode string) ([]byte, erro
 		status = "error"
 		return nil, errors.New(parsed.Error)
 	}
+	observeOllamaTokens(model.Model, parsed)
 
 	return []byte(strings.TrimSpace(parsed.Response)), nil
 }
-
-func ollamaConfig(mode string) (string, int) {
-	if mode == "fast" {
-		return "qwen2.5:3b", 600
-	}
-	return "qwen2.5:7b", 1200
-}
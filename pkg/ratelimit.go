@@ -0,0 +1,294 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimiterIdleTTL is how long an untouched bucket is kept before it is swept.
+const rateLimiterIdleTTL = 10 * time.Minute
+
+// RateLimiter is a token-bucket limiter keyed by client: the API key ID when the request was
+// authenticated, otherwise the client IP.
+type RateLimiter struct {
+	// PerMinute is the sustained request rate per client.
+	PerMinute float64
+	// Burst is the bucket size, i.e. how many requests a client may make at once.
+	Burst int
+	// TrustForwardedFor takes the client IP from the last X-Forwarded-For entry, the one appended
+	// by the proxy in front of the server; enable it only behind a proxy that sets the header.
+	TrustForwardedFor bool
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter allows each client perMinute requests per minute with bursts of up to burst.
+func NewRateLimiter(perMinute float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{PerMinute: perMinute, Burst: burst, buckets: make(map[string]*tokenBucket), now: time.Now}
+}
+
+// Allow takes a token from the client's bucket. When the bucket is empty it returns the time
+// until the next token is available.
+func (l *RateLimiter) Allow(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweepLocked(now)
+	rate := l.PerMinute / 60
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &tokenBucket{tokens: float64(l.Burst), last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(float64(l.Burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if rate <= 0 {
+		return false, time.Minute
+	}
+	return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+// Charge takes n more tokens from the client's bucket for work the request already admitted by
+// Allow goes on to do. The bucket may go negative; the client is then rejected until it has
+// refilled.
+func (l *RateLimiter) Charge(client string, n int) {
+	if n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &tokenBucket{tokens: float64(l.Burst), last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(float64(l.Burst), b.tokens+now.Sub(b.last).Seconds()*l.PerMinute/60)
+	b.last = now
+	b.tokens -= float64(n)
+}
+
+func (l *RateLimiter) sweepLocked(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for client, b := range l.buckets {
+		if now.Sub(b.last) > rateLimiterIdleTTL {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// clientID identifies the caller of r for rate limiting.
+func (l *RateLimiter) clientID(r *http.Request) string {
+	if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok && info.Client != "" {
+		return "key:" + info.Client
+	}
+	if l.TrustForwardedFor {
+		// Earlier entries come from the client and can be forged.
+		if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+			forwarded := values[len(values)-1]
+			if i := strings.LastIndex(forwarded, ","); i >= 0 {
+				forwarded = forwarded[i+1:]
+			}
+			if forwarded = strings.TrimSpace(forwarded); forwarded != "" {
+				return "ip:" + forwarded
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+type rateLimitClientKey struct{}
+
+type rateLimitClient struct {
+	limiter *RateLimiter
+	id      string
+}
+
+// WithRateLimit answers 429 with Retry-After once a client has used up its token bucket. It
+// must be wrapped by WithAPIKey to limit by key instead of IP. A nil limiter disables limiting.
+func WithRateLimit(limiter *RateLimiter, handler http.Handler) http.Handler {
+	if limiter == nil {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := limiter.clientID(r)
+		if allowed, retryAfter := limiter.Allow(client); !allowed {
+			observeRateLimited()
+			writeRetryAfter(w, retryAfter)
+			writeJSON(w, http.StatusTooManyRequests, errorResponse{Error: "rate limit exceeded"})
+			return
+		}
+		ctx := context.WithValue(r.Context(), rateLimitClientKey{}, rateLimitClient{limiter: limiter, id: client})
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// chargeAnalyses charges n analyses beyond the one the request was admitted for against the
+// caller's rate limit and API key quota, so that a request running several analyses costs as
+// much as the single requests it replaces.
+func chargeAnalyses(ctx context.Context, n int) {
+	if client, ok := ctx.Value(rateLimitClientKey{}).(rateLimitClient); ok {
+		client.limiter.Charge(client.id, n)
+	}
+	if state, ok := ctx.Value(apiKeyContextKey{}).(*apiKeyState); ok {
+		state.chargeRequests(n)
+	}
+}
+
+// ErrModelBusy is returned when the model queue cannot take another request.
+var ErrModelBusy = errors.New("model is busy")
+
+// ModelBusyError reports a rejected model call and when a retry is likely to succeed.
+type ModelBusyError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ModelBusyError) Error() string {
+	return ErrModelBusy.Error()
+}
+
+func (e *ModelBusyError) Unwrap() error {
+	return ErrModelBusy
+}
+
+// ModelQueue bounds the number of concurrent model calls across all clients. Callers beyond
+// MaxConcurrent wait in a queue of at most MaxQueued entries for up to MaxWait; everything
+// beyond that is rejected with a ModelBusyError instead of timing out later.
+type ModelQueue struct {
+	slots     chan struct{}
+	maxQueued int
+	maxWait   time.Duration
+
+	mu      sync.Mutex
+	waiting int
+	// avgHold is a moving average of how long a slot is held, used to estimate Retry-After.
+	avgHold time.Duration
+}
+
+// NewModelQueue creates a queue running at most maxConcurrent model calls at once.
+func NewModelQueue(maxConcurrent, maxQueued int, maxWait time.Duration) *ModelQueue {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+	if maxQueued < 0 {
+		maxQueued = 0
+	}
+	return &ModelQueue{
+		slots:     make(chan struct{}, maxConcurrent),
+		maxQueued: maxQueued,
+		maxWait:   maxWait,
+		avgHold:   30 * time.Second,
+	}
+}
+
+// Acquire waits for a model slot. The returned release func must be called when the model call
+// finished.
+func (q *ModelQueue) Acquire(ctx context.Context) (func(), error) {
+	if q == nil {
+		return func() {}, nil
+	}
+
+	start := time.Now()
+	select {
+	case q.slots <- struct{}{}:
+		observeModelQueueWait("immediate", 0)
+		return q.releaseFunc(), nil
+	default:
+	}
+
+	q.mu.Lock()
+	if q.waiting >= q.maxQueued {
+		retryAfter := q.retryAfterLocked()
+		q.mu.Unlock()
+		observeModelQueueWait("rejected", 0)
+		return nil, &ModelBusyError{RetryAfter: retryAfter}
+	}
+	q.waiting++
+	setModelQueueDepth(q.waiting)
+	q.mu.Unlock()
+
+	defer func() {
+		q.mu.Lock()
+		q.waiting--
+		setModelQueueDepth(q.waiting)
+		q.mu.Unlock()
+	}()
+
+	var timeout <-chan time.Time
+	if q.maxWait > 0 {
+		timer := time.NewTimer(q.maxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case q.slots <- struct{}{}:
+		observeModelQueueWait("queued", time.Since(start))
+		return q.releaseFunc(), nil
+	case <-timeout:
+		observeModelQueueWait("timeout", time.Since(start))
+		q.mu.Lock()
+		retryAfter := q.retryAfterLocked()
+		q.mu.Unlock()
+		return nil, &ModelBusyError{RetryAfter: retryAfter}
+	case <-ctx.Done():
+		observeModelQueueWait("cancelled", time.Since(start))
+		return nil, ctx.Err()
+	}
+}
+
+func (q *ModelQueue) releaseFunc() func() {
+	acquired := time.Now()
+	setModelQueueInFlight(len(q.slots))
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			held := time.Since(acquired)
+			q.mu.Lock()
+			q.avgHold = (q.avgHold*4 + held) / 5
+			q.mu.Unlock()
+			<-q.slots
+			setModelQueueInFlight(len(q.slots))
+		})
+	}
+}
+
+// retryAfterLocked estimates when the queue will have drained enough to accept a request.
+func (q *ModelQueue) retryAfterLocked() time.Duration {
+	estimate := q.avgHold * time.Duration(q.waiting+1) / time.Duration(cap(q.slots))
+	if estimate < time.Second {
+		estimate = time.Second
+	}
+	return estimate
+}
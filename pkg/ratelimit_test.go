@@ -0,0 +1,140 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestRateLimiterTokenBucket(t *testing.T) {
+	limiter := NewRateLimiter(60, 2)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := limiter.Allow("ip:1.2.3.4"); !ok {
+			t.Fatalf("request %d: expected burst to be allowed", i)
+		}
+	}
+	ok, retryAfter := limiter.Allow("ip:1.2.3.4")
+	if ok || retryAfter != time.Second {
+		t.Fatalf("expected rejection with 1s retry, got %v %v", ok, retryAfter)
+	}
+	if ok, _ := limiter.Allow("ip:5.6.7.8"); !ok {
+		t.Fatalf("expected other clients to have their own bucket")
+	}
+
+	now = now.Add(time.Second)
+	if ok, _ := limiter.Allow("ip:1.2.3.4"); !ok {
+		t.Fatalf("expected a token to refill after a second")
+	}
+}
+
+func TestWithRateLimitByKeyAndIP(t *testing.T) {
+	limiter := NewRateLimiter(1, 1)
+	auth := newTestAPIKeyAuth(t, APIKey{ID: "ci", Key: "0123456789abcdef"})
+	handler := WrapHandler("analyze", WithAPIKey(auth, WithRateLimit(limiter, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))), zap.NewNop())
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, authRequest("0123456789abcdef"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, authRequest("0123456789abcdef"))
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 429 with Retry-After, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	assertErrorJSON(t, rec.Body.Bytes())
+
+	if got := limiter.clientID(httptest.NewRequest(http.MethodGet, "/", nil)); got != "ip:192.0.2.1" {
+		t.Fatalf("unexpected client id %q", got)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Forwarded-For", "10.0.0.1, 203.0.113.7")
+	if got := limiter.clientID(req); got != "ip:192.0.2.1" {
+		t.Fatalf("expected X-Forwarded-For to be ignored by default, got %q", got)
+	}
+	limiter.TrustForwardedFor = true
+	if got := limiter.clientID(req); got != "ip:203.0.113.7" {
+		t.Fatalf("expected the entry appended by the proxy, got %q", got)
+	}
+	req.Header.Add("X-Forwarded-For", "198.51.100.9")
+	if got := limiter.clientID(req); got != "ip:198.51.100.9" {
+		t.Fatalf("expected the last X-Forwarded-For header to win, got %q", got)
+	}
+}
+
+func TestModelQueueRejectsWhenFull(t *testing.T) {
+	queue := NewModelQueue(1, 1, 50*time.Millisecond)
+
+	release, err := queue.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	// The single waiting spot times out while the slot is held.
+	_, err = queue.Acquire(context.Background())
+	var busy *ModelBusyError
+	if !errors.As(err, &busy) || busy.RetryAfter < time.Second {
+		t.Fatalf("expected ModelBusyError after waiting, got %v", err)
+	}
+
+	waiting := make(chan error)
+	go func() {
+		release, err := queue.Acquire(context.Background())
+		if err == nil {
+			release()
+		}
+		waiting <- err
+	}()
+	for {
+		queue.mu.Lock()
+		n := queue.waiting
+		queue.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// The queue is full now, so further callers are rejected immediately.
+	if _, err := queue.Acquire(context.Background()); !errors.Is(err, ErrModelBusy) {
+		t.Fatalf("expected ErrModelBusy, got %v", err)
+	}
+
+	release()
+	if err := <-waiting; err != nil {
+		t.Fatalf("expected waiting caller to get the slot, got %v", err)
+	}
+}
+
+func TestAnalyzeHandlerModelBusy(t *testing.T) {
+	mux := http.NewServeMux()
+	emptyCompareMux(mux, "octo", "hello", "v1.0.0", "v1.1.0")
+	client := newGitHubTestClient(t, mux)
+	ollama, calls := newOllamaTestServer(t, validModelResponse)
+
+	queue := NewModelQueue(1, 0, 0)
+	release, _ := queue.Acquire(context.Background())
+	defer release()
+
+	handler := NewAnalyzeHandler(&Analyzer{GitHub: client, OllamaBaseURL: ollama.URL, Queue: queue})
+	body := []byte(`{"repoUrl":"https://github.com/octo/hello","fromTag":"v1.0.0","toTag":"v1.1.0","mode":"fast"}`)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/analyze", bytes.NewReader(body)))
+
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 503 with Retry-After, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	assertErrorJSON(t, rec.Body.Bytes())
+	if calls.Load() != 0 {
+		t.Fatalf("expected the model not to be called")
+	}
+}
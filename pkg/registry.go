@@ -0,0 +1,467 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v83/github"
+)
+
+var (
+	ErrPackageNotFound      = errors.New("package not found")
+	ErrPackageRepoUnknown   = errors.New("package has no GitHub source repository")
+	ErrUnsupportedEcosystem = errors.New("unsupported ecosystem")
+)
+
+// repoTagCacheTTL is how long a repository's tags are reused for mapping versions to tags.
+// Tags published in the meantime fall back to the most likely tag name until it expires.
+const repoTagCacheTTL = 10 * time.Minute
+
+// Default public registry endpoints.
+const (
+	DefaultGoProxyURL     = "https://proxy.golang.org"
+	DefaultNPMRegistryURL = "https://registry.npmjs.org"
+	DefaultPyPIURL        = "https://pypi.org"
+	DefaultCratesURL      = "https://crates.io"
+)
+
+// PackageResolver maps package coordinates (ecosystem + name) to their GitHub source repository
+// and the git tag of every published version, using the public package registries.
+type PackageResolver struct {
+	GoProxyURL     string
+	NPMRegistryURL string
+	PyPIURL        string
+	CratesURL      string
+	HTTPClient     *http.Client
+	// GitHub is used to pick, for each version, the tag naming scheme the repository actually uses.
+	// When nil the first candidate (usually "v" + version) is assumed.
+	GitHub *github.Client
+
+	mu sync.Mutex
+	// tags caches the tags of each repository by URL for repoTagCacheTTL.
+	tags map[string]cachedRepoTags
+}
+
+type cachedRepoTags struct {
+	set     map[string]struct{}
+	fetched time.Time
+}
+
+// ResolvedPackage is the repository and version → tag mapping of a package.
+type ResolvedPackage struct {
+	Ecosystem string            `json:"ecosystem"`
+	Name      string            `json:"name"`
+	RepoUrl   string            `json:"repoUrl"`
+	Versions  map[string]string `json:"versions"`
+}
+
+// NewPackageResolver returns a resolver using the default public registries.
+func NewPackageResolver(client *http.Client, gh *github.Client) *PackageResolver {
+	return &PackageResolver{
+		GoProxyURL:     DefaultGoProxyURL,
+		NPMRegistryURL: DefaultNPMRegistryURL,
+		PyPIURL:        DefaultPyPIURL,
+		CratesURL:      DefaultCratesURL,
+		HTTPClient:     client,
+		GitHub:         gh,
+	}
+}
+
+// TagForVersion returns the tag of version, or version itself when it is unknown (so callers may
+// pass tags straight through).
+func (p ResolvedPackage) TagForVersion(version string) string {
+	if tag, ok := p.Versions[version]; ok {
+		return tag
+	}
+	if tag, ok := p.Versions[strings.TrimPrefix(version, "v")]; ok {
+		return tag
+	}
+	return version
+}
+
+// Resolve looks up name in the registry of ecosystem.
+func (r *PackageResolver) Resolve(ctx context.Context, ecosystem, name string) (ResolvedPackage, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return ResolvedPackage{}, ErrPackageNotFound
+	}
+
+	var (
+		repoURL  string
+		versions []string
+		// candidates returns the tag names a version may be published under, most likely first.
+		candidates func(version string) []string
+		err        error
+	)
+	switch ecosystem {
+	case EcosystemGo:
+		var subdir string
+		repoURL, subdir, versions, err = r.resolveGo(ctx, name)
+		candidates = func(v string) []string { return []string{goModuleVersionTag(subdir, v)} }
+	case EcosystemNPM:
+		repoURL, versions, err = r.resolveNPM(ctx, name)
+		candidates = func(v string) []string { return registryTagCandidates(name, v) }
+	case EcosystemPyPI:
+		repoURL, versions, err = r.resolvePyPI(ctx, name)
+		candidates = func(v string) []string { return registryTagCandidates(name, v) }
+	case EcosystemCrates:
+		repoURL, versions, err = r.resolveCrates(ctx, name)
+		candidates = func(v string) []string { return registryTagCandidates(name, v) }
+	default:
+		return ResolvedPackage{}, ErrUnsupportedEcosystem
+	}
+	if err != nil {
+		return ResolvedPackage{}, err
+	}
+
+	known := r.repoTagSet(ctx, repoURL)
+	mapping := make(map[string]string, len(versions))
+	for _, v := range versions {
+		cands := candidates(v)
+		mapping[v] = cands[0]
+		for _, c := range cands {
+			if _, ok := known[c]; ok {
+				mapping[v] = c
+				break
+			}
+		}
+	}
+
+	return ResolvedPackage{Ecosystem: ecosystem, Name: name, RepoUrl: repoURL, Versions: mapping}, nil
+}
+
+// repoTagSet returns the repository's tags, or nil when no GitHub client is configured or the
+// lookup fails; tag matching is best effort. Listings are cached for repoTagCacheTTL, so
+// resolving the packages of a manifest does not page through a repository's tags each time.
+func (r *PackageResolver) repoTagSet(ctx context.Context, repoURL string) map[string]struct{} {
+	if r.GitHub == nil {
+		return nil
+	}
+	key := strings.ToLower(repoURL)
+	now := time.Now()
+	r.mu.Lock()
+	cached, ok := r.tags[key]
+	r.mu.Unlock()
+	if ok && now.Sub(cached.fetched) <= repoTagCacheTTL {
+		return cached.set
+	}
+
+	tags, err := GetRepoTags(ctx, r.GitHub, repoURL)
+	if err != nil {
+		return nil
+	}
+	set := make(map[string]struct{}, len(tags))
+	for _, t := range tags {
+		set[t] = struct{}{}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tags == nil {
+		r.tags = make(map[string]cachedRepoTags)
+	}
+	for k, c := range r.tags {
+		if now.Sub(c.fetched) > repoTagCacheTTL {
+			delete(r.tags, k)
+		}
+	}
+	r.tags[key] = cachedRepoTags{set: set, fetched: now}
+	return set
+}
+
+func registryTagCandidates(name, version string) []string {
+	base := path.Base(name)
+	return []string{
+		"v" + version,
+		version,
+		name + "@" + version,
+		base + "@" + version,
+		base + "-v" + version,
+		base + "-" + version,
+	}
+}
+
+type goProxyInfo struct {
+	Version string `json:"Version"`
+	Origin  *struct {
+		VCS    string `json:"VCS"`
+		URL    string `json:"URL"`
+		Subdir string `json:"Subdir"`
+	} `json:"Origin"`
+}
+
+func (r *PackageResolver) resolveGo(ctx context.Context, module string) (repoURL, subdir string, versions []string, err error) {
+	base := strings.TrimRight(r.GoProxyURL, "/") + "/" + escapeGoModulePath(module)
+
+	listBody, listErr := r.get(ctx, base+"/@v/list")
+	if listErr == nil {
+		for _, line := range strings.Split(string(listBody), "\n") {
+			if v := strings.TrimSpace(line); v != "" {
+				versions = append(versions, v)
+			}
+		}
+		sortVersions(versions)
+	}
+
+	// github.com module paths name their repository; the proxy is only needed for the version list,
+	// which may be unavailable for private modules.
+	if repoURL, subdir, ok := goModuleGitHubRepo(module); ok {
+		return repoURL, subdir, versions, nil
+	}
+	if listErr != nil {
+		return "", "", nil, listErr
+	}
+
+	var info goProxyInfo
+	if err := r.getJSON(ctx, base+"/@latest", &info); err != nil {
+		return "", "", nil, err
+	}
+	if info.Origin == nil || info.Origin.VCS != "git" {
+		return "", "", nil, ErrPackageRepoUnknown
+	}
+	repoURL, ok := normalizeGitHubRepoURL(info.Origin.URL)
+	if !ok {
+		return "", "", nil, ErrPackageRepoUnknown
+	}
+	return repoURL, info.Origin.Subdir, versions, nil
+}
+
+type npmPackument struct {
+	Repository json.RawMessage            `json:"repository"`
+	Versions   map[string]json.RawMessage `json:"versions"`
+}
+
+func (r *PackageResolver) resolveNPM(ctx context.Context, name string) (string, []string, error) {
+	var doc npmPackument
+	endpoint := strings.TrimRight(r.NPMRegistryURL, "/") + "/" + strings.Replace(url.PathEscape(name), "%40", "@", 1)
+	if err := r.getJSON(ctx, endpoint, &doc); err != nil {
+		return "", nil, err
+	}
+
+	// repository is either a shorthand string or {"type":"git","url":"..."}.
+	var repoField string
+	var repoObj struct {
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal(doc.Repository, &repoField); err != nil {
+		if err := json.Unmarshal(doc.Repository, &repoObj); err == nil {
+			repoField = repoObj.URL
+		}
+	}
+	repoURL, ok := normalizeGitHubRepoURL(repoField)
+	if !ok {
+		return "", nil, ErrPackageRepoUnknown
+	}
+
+	versions := make([]string, 0, len(doc.Versions))
+	for v := range doc.Versions {
+		versions = append(versions, v)
+	}
+	sortVersions(versions)
+	return repoURL, versions, nil
+}
+
+type pypiProject struct {
+	Info struct {
+		HomePage    string            `json:"home_page"`
+		ProjectURLs map[string]string `json:"project_urls"`
+	} `json:"info"`
+	Releases map[string]json.RawMessage `json:"releases"`
+}
+
+func (r *PackageResolver) resolvePyPI(ctx context.Context, name string) (string, []string, error) {
+	var doc pypiProject
+	endpoint := strings.TrimRight(r.PyPIURL, "/") + "/pypi/" + url.PathEscape(name) + "/json"
+	if err := r.getJSON(ctx, endpoint, &doc); err != nil {
+		return "", nil, err
+	}
+
+	// Prefer explicitly labelled source links, then any project URL, then the home page.
+	candidates := []string{}
+	for _, key := range []string{"Source", "Source Code", "Repository", "Code", "GitHub", "Homepage"} {
+		if u, ok := doc.Info.ProjectURLs[key]; ok {
+			candidates = append(candidates, u)
+		}
+	}
+	others := make([]string, 0, len(doc.Info.ProjectURLs))
+	for _, u := range doc.Info.ProjectURLs {
+		others = append(others, u)
+	}
+	sort.Strings(others)
+	candidates = append(candidates, others...)
+	candidates = append(candidates, doc.Info.HomePage)
+
+	repoURL := ""
+	for _, c := range candidates {
+		if u, ok := normalizeGitHubRepoURL(c); ok {
+			repoURL = u
+			break
+		}
+	}
+	if repoURL == "" {
+		return "", nil, ErrPackageRepoUnknown
+	}
+
+	versions := make([]string, 0, len(doc.Releases))
+	for v := range doc.Releases {
+		versions = append(versions, v)
+	}
+	sortVersions(versions)
+	return repoURL, versions, nil
+}
+
+type cratesCrate struct {
+	Crate struct {
+		Repository string `json:"repository"`
+	} `json:"crate"`
+	Versions []struct {
+		Num string `json:"num"`
+	} `json:"versions"`
+}
+
+func (r *PackageResolver) resolveCrates(ctx context.Context, name string) (string, []string, error) {
+	var doc cratesCrate
+	endpoint := strings.TrimRight(r.CratesURL, "/") + "/api/v1/crates/" + url.PathEscape(name)
+	if err := r.getJSON(ctx, endpoint, &doc); err != nil {
+		return "", nil, err
+	}
+	repoURL, ok := normalizeGitHubRepoURL(doc.Crate.Repository)
+	if !ok {
+		return "", nil, ErrPackageRepoUnknown
+	}
+
+	versions := make([]string, 0, len(doc.Versions))
+	for _, v := range doc.Versions {
+		if v.Num != "" {
+			versions = append(versions, v.Num)
+		}
+	}
+	sortVersions(versions)
+	return repoURL, versions, nil
+}
+
+func (r *PackageResolver) getJSON(ctx context.Context, endpoint string, out any) error {
+	body, err := r.get(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("decode registry response: %w", err)
+	}
+	return nil
+}
+
+func (r *PackageResolver) get(ctx context.Context, endpoint string) ([]byte, error) {
+	start := time.Now()
+	status := "ok"
+	defer func() {
+		observeRegistryRequest(status, time.Since(start))
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	// crates.io rejects requests without a descriptive User-Agent.
+	req.Header.Set("User-Agent", "diffbreak (https://diffbreak.fyi)")
+	setRequestIDHeader(ctx, req)
+
+	client := r.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		status = "error"
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		status = "not_found"
+		return nil, ErrPackageNotFound
+	case resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices:
+		status = "error"
+		return nil, fmt.Errorf("registry request failed: status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 32<<20))
+	if err != nil {
+		status = "error"
+		return nil, err
+	}
+	return body, nil
+}
+
+// normalizeGitHubRepoURL turns the repository notations used by registries (git+https://...,
+// git://..., git@github.com:..., github:owner/repo, owner/repo, deep links) into
+// https://github.com/owner/repo.
+func normalizeGitHubRepoURL(raw string) (string, bool) {
+	s := strings.TrimSpace(raw)
+	if s == "" {
+		return "", false
+	}
+	s = strings.TrimPrefix(s, "git+")
+	switch {
+	case strings.HasPrefix(s, "github:"):
+		s = "https://github.com/" + strings.TrimPrefix(s, "github:")
+	case strings.HasPrefix(s, "git@github.com:"):
+		s = "https://github.com/" + strings.TrimPrefix(s, "git@github.com:")
+	case !strings.Contains(s, "://") && !strings.Contains(s, ":") && strings.Count(s, "/") == 1:
+		s = "https://github.com/" + s
+	}
+
+	u, err := url.Parse(s)
+	if err != nil || !strings.EqualFold(strings.TrimPrefix(u.Host, "www."), "github.com") {
+		return "", false
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", false
+	}
+	repo := strings.TrimSuffix(parts[1], ".git")
+	return "https://github.com/" + parts[0] + "/" + repo, true
+}
+
+// escapeGoModulePath applies the module proxy case encoding (uppercase → "!" + lowercase).
+func escapeGoModulePath(module string) string {
+	var b strings.Builder
+	for _, r := range module {
+		if r >= 'A' && r <= 'Z' {
+			b.WriteByte('!')
+			b.WriteRune(r + ('a' - 'A'))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// sortVersions orders versions ascending by semver, followed by the versions that do not parse
+// in lexical order. Mixing both comparisons in one order would not be transitive.
+func sortVersions(versions []string) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		a, aok := parseSemver(versions[i])
+		b, bok := parseSemver(versions[j])
+		switch {
+		case aok && bok:
+			return compareSemver(a, b) < 0
+		case aok != bok:
+			return aok
+		default:
+			return versions[i] < versions[j]
+		}
+	})
+}
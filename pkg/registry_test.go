@@ -0,0 +1,220 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func newFakeRegistry(t *testing.T) *PackageResolver {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/npm/express", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"repository":{"type":"git","url":"git+https://github.com/expressjs/express.git"},"versions":{"4.18.2":{},"4.19.0":{}}}`))
+	})
+	mux.HandleFunc("/npm/@scope%2Fwidget", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"repository":"github:acme/widgets","versions":{"1.0.0":{}}}`))
+	})
+	mux.HandleFunc("/npm/closed", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"repository":{"url":"https://gitlab.com/acme/closed"},"versions":{"1.0.0":{}}}`))
+	})
+	mux.HandleFunc("/pypi/pypi/requests/json", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"info":{"home_page":"https://requests.readthedocs.io","project_urls":{"Documentation":"https://requests.readthedocs.io","Source":"https://github.com/psf/requests"}},"releases":{"2.31.0":[],"2.32.0":[]}}`))
+	})
+	mux.HandleFunc("/crates/api/v1/crates/serde", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") == "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(`{"crate":{"repository":"https://github.com/serde-rs/serde"},"versions":[{"num":"1.0.200"},{"num":"1.0.190"}]}`))
+	})
+	mux.HandleFunc("/goproxy/github.com/spf13/cobra/@v/list", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("v1.8.0\nv1.7.0\n"))
+	})
+	mux.HandleFunc("/goproxy/go.uber.org/zap/@v/list", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("v1.27.0\n"))
+	})
+	mux.HandleFunc("/goproxy/go.uber.org/zap/@latest", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"Version":"v1.27.0","Origin":{"VCS":"git","URL":"https://github.com/uber-go/zap"}}`))
+	})
+	mux.HandleFunc("/goproxy/github.com/!burnt!sushi/toml/@v/list", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("v1.3.2\n"))
+	})
+
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+
+	return &PackageResolver{
+		GoProxyURL:     ts.URL + "/goproxy",
+		NPMRegistryURL: ts.URL + "/npm",
+		PyPIURL:        ts.URL + "/pypi",
+		CratesURL:      ts.URL + "/crates",
+		HTTPClient:     ts.Client(),
+	}
+}
+
+func TestPackageResolverEcosystems(t *testing.T) {
+	resolver := newFakeRegistry(t)
+
+	tests := []struct {
+		ecosystem, name string
+		repo            string
+		version, tag    string
+	}{
+		{EcosystemNPM, "express", "https://github.com/expressjs/express", "4.19.0", "v4.19.0"},
+		{EcosystemNPM, "@scope/widget", "https://github.com/acme/widgets", "1.0.0", "v1.0.0"},
+		{EcosystemPyPI, "requests", "https://github.com/psf/requests", "2.32.0", "v2.32.0"},
+		{EcosystemCrates, "serde", "https://github.com/serde-rs/serde", "1.0.200", "v1.0.200"},
+		{EcosystemGo, "github.com/spf13/cobra", "https://github.com/spf13/cobra", "v1.8.0", "v1.8.0"},
+		{EcosystemGo, "go.uber.org/zap", "https://github.com/uber-go/zap", "v1.27.0", "v1.27.0"},
+		{EcosystemGo, "github.com/BurntSushi/toml", "https://github.com/BurntSushi/toml", "v1.3.2", "v1.3.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ecosystem+"/"+tt.name, func(t *testing.T) {
+			resolved, err := resolver.Resolve(context.Background(), tt.ecosystem, tt.name)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resolved.RepoUrl != tt.repo {
+				t.Fatalf("expected repo %s, got %s", tt.repo, resolved.RepoUrl)
+			}
+			if got := resolved.Versions[tt.version]; got != tt.tag {
+				t.Fatalf("expected %s → %s, got %q (versions %v)", tt.version, tt.tag, got, resolved.Versions)
+			}
+		})
+	}
+}
+
+func TestPackageResolverErrors(t *testing.T) {
+	resolver := newFakeRegistry(t)
+
+	if _, err := resolver.Resolve(context.Background(), EcosystemNPM, "missing"); err != ErrPackageNotFound {
+		t.Fatalf("expected ErrPackageNotFound, got %v", err)
+	}
+	if _, err := resolver.Resolve(context.Background(), EcosystemNPM, "closed"); err != ErrPackageRepoUnknown {
+		t.Fatalf("expected ErrPackageRepoUnknown, got %v", err)
+	}
+	if _, err := resolver.Resolve(context.Background(), "maven", "junit"); err != ErrUnsupportedEcosystem {
+		t.Fatalf("expected ErrUnsupportedEcosystem, got %v", err)
+	}
+}
+
+func TestPackageResolverMatchesRepoTagScheme(t *testing.T) {
+	resolver := newFakeRegistry(t)
+
+	var tagRequests atomic.Int32
+	ghMux := http.NewServeMux()
+	ghMux.HandleFunc("/repos/expressjs/express/tags", func(w http.ResponseWriter, r *http.Request) {
+		tagRequests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"name":"4.19.0"},{"name":"4.18.2"}]`))
+	})
+	resolver.GitHub = newGitHubTestClient(t, ghMux)
+
+	resolved, err := resolver.Resolve(context.Background(), EcosystemNPM, "express")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resolved.Versions["4.19.0"] != "4.19.0" {
+		t.Fatalf("expected unprefixed tag, got %q", resolved.Versions["4.19.0"])
+	}
+	if resolved.TagForVersion("v4.18.2") != "4.18.2" {
+		t.Fatalf("expected v-prefixed version lookup to map to tag")
+	}
+	if resolved.TagForVersion("some-branch") != "some-branch" {
+		t.Fatalf("expected unknown versions to pass through")
+	}
+
+	if _, err := resolver.Resolve(context.Background(), EcosystemNPM, "express"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tagRequests.Load() != 1 {
+		t.Fatalf("expected the repository's tags to be listed once and cached, got %d listings", tagRequests.Load())
+	}
+}
+
+func TestSortVersions(t *testing.T) {
+	versions := []string{"latest", "v1.10.0", "2023-01-01", "v1.2.0", "v1.2.0-rc.1", "v0.9.0", "nightly"}
+	sortVersions(versions)
+	want := []string{"v0.9.0", "v1.2.0-rc.1", "v1.2.0", "v1.10.0", "2023-01-01", "latest", "nightly"}
+	if strings.Join(versions, " ") != strings.Join(want, " ") {
+		t.Fatalf("expected %v, got %v", want, versions)
+	}
+}
+
+func TestNormalizeGitHubRepoURL(t *testing.T) {
+	tests := map[string]string{
+		"git+https://github.com/octo/hello.git":        "https://github.com/octo/hello",
+		"git://github.com/octo/hello.git":              "https://github.com/octo/hello",
+		"git+ssh://git@github.com/octo/hello.git":      "https://github.com/octo/hello",
+		"git@github.com:octo/hello.git":                "https://github.com/octo/hello",
+		"github:octo/hello":                            "https://github.com/octo/hello",
+		"octo/hello":                                   "https://github.com/octo/hello",
+		"https://www.github.com/octo/hello/tree/main/": "https://github.com/octo/hello",
+	}
+	for in, want := range tests {
+		got, ok := normalizeGitHubRepoURL(in)
+		if !ok || got != want {
+			t.Fatalf("normalizeGitHubRepoURL(%q) = %q, %v; want %q", in, got, ok, want)
+		}
+	}
+	if _, ok := normalizeGitHubRepoURL("https://gitlab.com/octo/hello"); ok {
+		t.Fatalf("expected non-GitHub URL to be rejected")
+	}
+}
+
+func TestDetectHandlerResolvesPackage(t *testing.T) {
+	resolver := newFakeRegistry(t)
+
+	ghMux := http.NewServeMux()
+	ghMux.HandleFunc("/repos/expressjs/express/tags", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"name":"v4.19.0"},{"name":"v4.18.2"}]`))
+	})
+	ghClient := newGitHubTestClient(t, ghMux)
+	resolver.GitHub = ghClient
+
+	handler := NewDetectHandler(&Analyzer{GitHub: ghClient, Resolver: resolver, Logger: zap.NewNop()})
+
+	req := httptest.NewRequest(http.MethodGet, "/detect?package=express&ecosystem=npm", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var resp DetectResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Repo.Url != "https://github.com/expressjs/express" {
+		t.Fatalf("unexpected repo url %s", resp.Repo.Url)
+	}
+	if resp.Package == nil || resp.Package.Versions["4.19.0"] != "v4.19.0" {
+		t.Fatalf("expected package version mapping, got %+v", resp.Package)
+	}
+}
+
+func TestAnalyzeHandlerUnknownPackage(t *testing.T) {
+	resolver := newFakeRegistry(t)
+	handler := NewAnalyzeHandler(&Analyzer{Resolver: resolver, Logger: zap.NewNop()})
+
+	body := `{"package":"missing","ecosystem":"npm","fromTag":"1.0.0","toTag":"2.0.0","mode":"fast"}`
+	req := httptest.NewRequest(http.MethodPost, "/analyze", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+	assertErrorJSON(t, rec.Body.Bytes())
+}
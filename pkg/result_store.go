@@ -0,0 +1,146 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// resultStoreMaxEntries bounds the number of stored analyses; the oldest are evicted first.
+const resultStoreMaxEntries = 500
+
+// StoredAnalysis is a precomputed analysis kept by the ResultStore.
+type StoredAnalysis struct {
+	RepoUrl string `json:"repoUrl"`
+	FromTag string `json:"fromTag"`
+	ToTag   string `json:"toTag"`
+	Mode    string `json:"mode"`
+	// Route is the route scope the analysis was made with; see OllamaConfig.routeScope.
+	Route string `json:"route,omitempty"`
+	// Public is set for analyses of public repositories, the only ones served to callers
+	// without GitHub App access.
+	Public   bool            `json:"public,omitempty"`
+	StoredAt string          `json:"storedAt"`
+	Analysis AnalyzeResponse `json:"analysis"`
+}
+
+// ResultStore keeps analyses produced ahead of time (e.g. from release webhooks) so /analyze can
+// answer them without calling the model. When a path is configured the results are persisted to
+// a JSON file.
+type ResultStore struct {
+	path    string
+	mu      sync.Mutex
+	results map[string]StoredAnalysis
+}
+
+// NewResultStore loads the analyses persisted at path. An empty path keeps results in memory only.
+func NewResultStore(path string) (*ResultStore, error) {
+	store := &ResultStore{path: path, results: make(map[string]StoredAnalysis)}
+	if path == "" {
+		return store, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var results []StoredAnalysis
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, err
+	}
+	for _, r := range results {
+		if key, ok := resultKey(r.RepoUrl, r.FromTag, r.ToTag, r.Mode, r.Route); ok {
+			store.results[key] = r
+		}
+	}
+	return store, nil
+}
+
+// Get returns the stored analysis for the given comparison and route scope, if any. Analyses
+// of private repositories are only returned with includePrivate.
+func (s *ResultStore) Get(repoURL, fromTag, toTag, mode, route string, includePrivate bool) (AnalyzeResponse, bool) {
+	key, ok := resultKey(repoURL, fromTag, toTag, mode, route)
+	if !ok {
+		return AnalyzeResponse{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.results[key]
+	if !ok || (!r.Public && !includePrivate) {
+		return AnalyzeResponse{}, false
+	}
+	return r.Analysis, true
+}
+
+// Put stores resp for the given comparison and route scope, replacing any previous result.
+// public tells whether the repository is public.
+func (s *ResultStore) Put(repoURL, fromTag, toTag, mode, route string, public bool, resp AnalyzeResponse) error {
+	key, ok := resultKey(repoURL, fromTag, toTag, mode, route)
+	if !ok {
+		return ErrInvalidRepoURL
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results[key] = StoredAnalysis{
+		RepoUrl:  repoURL,
+		FromTag:  fromTag,
+		ToTag:    toTag,
+		Mode:     mode,
+		Route:    route,
+		Public:   public,
+		StoredAt: time.Now().UTC().Format(time.RFC3339Nano),
+		Analysis: resp,
+	}
+	s.evictLocked()
+	return s.saveLocked()
+}
+
+func (s *ResultStore) listLocked() []StoredAnalysis {
+	results := make([]StoredAnalysis, 0, len(s.results))
+	for _, r := range s.results {
+		results = append(results, r)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].StoredAt < results[j].StoredAt
+	})
+	return results
+}
+
+func (s *ResultStore) evictLocked() {
+	if len(s.results) <= resultStoreMaxEntries {
+		return
+	}
+	for _, r := range s.listLocked()[:len(s.results)-resultStoreMaxEntries] {
+		key, _ := resultKey(r.RepoUrl, r.FromTag, r.ToTag, r.Mode, r.Route)
+		delete(s.results, key)
+	}
+}
+
+func (s *ResultStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.listLocked(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, data)
+}
+
+// resultKey identifies a comparison independently of how the repository URL was spelled.
+func resultKey(repoURL, fromTag, toTag, mode, route string) (string, bool) {
+	owner, repo, err := ParseGitHubRepoURL(repoURL)
+	if err != nil {
+		return "", false
+	}
+	return strings.ToLower(owner+"/"+repo) + "\x00" + strings.TrimSpace(fromTag) + "\x00" + strings.TrimSpace(toTag) + "\x00" + mode + "\x00" + route, true
+}
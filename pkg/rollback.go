@@ -0,0 +1,130 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// rollbackAnswer is the model's answer to a rollback prompt.
+type rollbackAnswer struct {
+	Risk                   RiskInfo         `json:"risk"`
+	Summary                SummaryInfo      `json:"summary"`
+	RemovedFeatures        []RollbackChange `json:"removedFeatures"`
+	IrreversibleMigrations []RollbackChange `json:"irreversibleMigrations"`
+	DataFormatChanges      []RollbackChange `json:"dataFormatChanges"`
+	RollbackSteps          []UpgradeStep    `json:"rollbackSteps"`
+	Evidence               []EvidenceItem   `json:"evidence"`
+}
+
+// buildRollbackPrompt builds the prompt for a downgrade from bundle.From to the older
+// bundle.To. The bundle holds the releases and commits between the two versions, which the
+// rollback undoes.
+func buildRollbackPrompt(bundle analysisInputBundle) (string, error) {
+	payload, err := json.Marshal(bundle)
+	if err != nil {
+		return "", err
+	}
+
+	prompt := fmt.Sprintf(
+		"You are a release risk analyst assessing a ROLLBACK from %s to the older version %s. The input lists the releases, commits and pull requests between the two versions: everything in it is undone by the rollback.\nReport what the rollback loses and what it cannot undo, not what an upgrade would bring.\nOutput MUST be a single JSON object with EXACTLY these top-level keys: risk, summary, removedFeatures, irreversibleMigrations, dataFormatChanges, rollbackSteps, evidence, meta. Do not add extra keys.\nTypes:\n- risk MUST be an object, not a string: {\"level\":\"low|medium|high\",\"score\":0-100,\"confidence\":\"low|medium|high\",\"reasons\":[...]}; score is the risk of rolling back.\n- summary MUST be an object: {\"highlights\":[...],\"grouped\":[{\"title\":\"...\",\"items\":[...]}]}\n- removedFeatures: features and APIs that %s does not have, items {\"title\":\"...\",\"severity\":\"low|medium|high\",\"reason\":\"...\",\"evidence\":[{\"label\":\"...\",\"url\":\"...\"}]}\n- irreversibleMigrations: database, schema or state migrations that %s cannot undo or work with, items like removedFeatures.\n- dataFormatChanges: config, storage, wire or file formats written by %s that %s cannot read, items like removedFeatures.\n- rollbackSteps: items {\"step\":\"...\",\"why\":\"...\",\"evidence\":[...]}\n- removedFeatures / irreversibleMigrations / dataFormatChanges / rollbackSteps / evidence MUST be arrays (can be empty, items are objects).\n- meta MUST be an object.\nNo markdown, no code fences, no commentary. Output must start with { and end with }. No trailing commas. Use double quotes only.\nInput:\n%s",
+		bundle.From, bundle.To, bundle.To, bundle.To, bundle.From, bundle.To,
+		string(payload),
+	)
+	return prompt, nil
+}
+
+func buildRollbackRepairPrompt(raw []byte) (string, error) {
+	if len(raw) == 0 {
+		return "", errors.New("empty model response")
+	}
+	return fmt.Sprintf(
+		"Rewrite the following into valid JSON with EXACTLY these top-level keys: risk, summary, removedFeatures, irreversibleMigrations, dataFormatChanges, rollbackSteps, evidence, meta. Do not add extra keys.\nTypes:\n- risk MUST be an object, not a string: {\"level\":\"low|medium|high\",\"score\":0-100,\"confidence\":\"low|medium|high\",\"reasons\":[...]}\n- summary MUST be an object: {\"highlights\":[...],\"grouped\":[{\"title\":\"...\",\"items\":[...]}]}\n- removedFeatures / irreversibleMigrations / dataFormatChanges / rollbackSteps / evidence MUST be arrays (can be empty, items are objects).\n- meta MUST be an object.\nNo markdown, no code fences, no commentary. Output must start with { and end with }. No trailing commas. Use double quotes only.\nInvalid JSON:\n%s",
+		string(raw),
+	), nil
+}
+
+// validateAndNormalizeRollbackResponse is validateAndNormalizeResponse for answers to a
+// rollback prompt. The rollback findings are returned in Rollback; breakers, behavior changes
+// and upgrade steps stay empty.
+func validateAndNormalizeRollbackResponse(raw []byte) (AnalyzeResponse, bool, error) {
+	cleaned := bytes.TrimSpace(extractJSONObject(raw))
+	if len(cleaned) == 0 {
+		return AnalyzeResponse{}, false, errEmptyModelResponse
+	}
+
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(cleaned, &obj); err != nil {
+		return AnalyzeResponse{}, false, err
+	}
+
+	if err := validateRollbackShape(obj); err != nil {
+		return AnalyzeResponse{}, true, err
+	}
+
+	var answer rollbackAnswer
+	if err := json.Unmarshal(cleaned, &answer); err != nil {
+		return AnalyzeResponse{}, false, err
+	}
+
+	resp := AnalyzeResponse{
+		Risk:     answer.Risk,
+		Summary:  answer.Summary,
+		Evidence: answer.Evidence,
+		Rollback: &RollbackInfo{
+			RemovedFeatures:        normalizeRollbackChanges(answer.RemovedFeatures),
+			IrreversibleMigrations: normalizeRollbackChanges(answer.IrreversibleMigrations),
+			DataFormatChanges:      normalizeRollbackChanges(answer.DataFormatChanges),
+			Steps:                  answer.RollbackSteps,
+		},
+	}
+	if resp.Rollback.Steps == nil {
+		resp.Rollback.Steps = []UpgradeStep{}
+	}
+	for i := range resp.Rollback.Steps {
+		if resp.Rollback.Steps[i].Evidence == nil {
+			resp.Rollback.Steps[i].Evidence = []EvidenceLink{}
+		}
+	}
+	normalizeResponse(&resp)
+	return resp, false, nil
+}
+
+func validateRollbackShape(obj map[string]json.RawMessage) error {
+	required := []string{"risk", "summary", "removedFeatures", "irreversibleMigrations", "dataFormatChanges", "rollbackSteps", "evidence", "meta"}
+	for _, key := range required {
+		if _, ok := obj[key]; !ok {
+			return fmt.Errorf("missing key %s", key)
+		}
+	}
+
+	if err := validateRiskAndSummaryShape(obj); err != nil {
+		return err
+	}
+	for _, key := range []string{"removedFeatures", "irreversibleMigrations", "dataFormatChanges", "rollbackSteps"} {
+		if err := validateArrayOfObjects(obj[key], key, "evidence"); err != nil {
+			return err
+		}
+	}
+	if err := validateArrayOfObjects(obj["evidence"], "evidence", ""); err != nil {
+		return err
+	}
+
+	if !isJSONObject(obj["meta"]) {
+		return errors.New("meta must be object")
+	}
+	return nil
+}
+
+func normalizeRollbackChanges(changes []RollbackChange) []RollbackChange {
+	if changes == nil {
+		return []RollbackChange{}
+	}
+	for i := range changes {
+		if changes[i].Evidence == nil {
+			changes[i].Evidence = []EvidenceLink{}
+		}
+	}
+	return changes
+}
@@ -0,0 +1,306 @@
+package pkg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	sarifSchemaURL = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion   = "2.1.0"
+
+	sarifRuleBreakingChange        = "diffbreak/breaking-change"
+	sarifRuleBehaviorChange        = "diffbreak/behavior-change"
+	sarifRuleIrreversibleMigration = "diffbreak/irreversible-migration"
+	sarifRuleDataFormatChange      = "diffbreak/data-format-change"
+	sarifRuleRemovedFeature        = "diffbreak/removed-feature"
+)
+
+// SARIFLog is the root object of a SARIF 2.1.0 document.
+type SARIFLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []SARIFRun `json:"runs"`
+}
+
+// SARIFRun is a single analysis run inside a SARIF log.
+type SARIFRun struct {
+	Tool       SARIFTool       `json:"tool"`
+	Results    []SARIFResult   `json:"results"`
+	Properties map[string]any  `json:"properties,omitempty"`
+	Artifacts  []SARIFArtifact `json:"artifacts,omitempty"`
+}
+
+// SARIFTool describes the producer of a SARIF run.
+type SARIFTool struct {
+	Driver SARIFDriver `json:"driver"`
+}
+
+// SARIFDriver describes the tool component and its rules.
+type SARIFDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri,omitempty"`
+	Rules          []SARIFRule `json:"rules"`
+}
+
+// SARIFRule describes one category of reported results.
+type SARIFRule struct {
+	ID                   string             `json:"id"`
+	Name                 string             `json:"name"`
+	ShortDescription     SARIFMessage       `json:"shortDescription"`
+	DefaultConfiguration SARIFConfiguration `json:"defaultConfiguration"`
+}
+
+// SARIFConfiguration holds the default reporting level of a rule.
+type SARIFConfiguration struct {
+	Level string `json:"level"`
+}
+
+// SARIFMessage is a plain-text SARIF message.
+type SARIFMessage struct {
+	Text string `json:"text"`
+}
+
+// SARIFResult is a single reported finding.
+type SARIFResult struct {
+	RuleID              string            `json:"ruleId"`
+	RuleIndex           int               `json:"ruleIndex"`
+	Level               string            `json:"level"`
+	Message             SARIFMessage      `json:"message"`
+	Locations           []SARIFLocation   `json:"locations"`
+	RelatedLocations    []SARIFLocation   `json:"relatedLocations,omitempty"`
+	PartialFingerprints map[string]string `json:"partialFingerprints,omitempty"`
+	Properties          map[string]any    `json:"properties,omitempty"`
+}
+
+// SARIFLocation points at a physical artifact and/or a logical entity.
+type SARIFLocation struct {
+	ID               int                    `json:"id,omitempty"`
+	PhysicalLocation *SARIFPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []SARIFLogicalLocation `json:"logicalLocations,omitempty"`
+	Message          *SARIFMessage          `json:"message,omitempty"`
+}
+
+// SARIFPhysicalLocation references an artifact by URI.
+type SARIFPhysicalLocation struct {
+	ArtifactLocation SARIFArtifactLocation `json:"artifactLocation"`
+}
+
+// SARIFArtifactLocation is the URI of an artifact.
+type SARIFArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// SARIFLogicalLocation names a non-file entity such as a dependency.
+type SARIFLogicalLocation struct {
+	Name               string `json:"name"`
+	FullyQualifiedName string `json:"fullyQualifiedName,omitempty"`
+	Kind               string `json:"kind,omitempty"`
+}
+
+// SARIFArtifact lists an artifact referenced by the run.
+type SARIFArtifact struct {
+	Location SARIFArtifactLocation `json:"location"`
+}
+
+// SARIFOptions tunes how an AnalyzeResponse is rendered as SARIF.
+type SARIFOptions struct {
+	// ArtifactURI is the repository-relative file (e.g. go.mod) results are anchored to.
+	// Code-scanning dashboards require a physical location; when empty only a logical
+	// location naming the dependency is emitted.
+	ArtifactURI string
+}
+
+var sarifRules = []SARIFRule{
+	{
+		ID:                   sarifRuleBreakingChange,
+		Name:                 "BreakingChange",
+		ShortDescription:     SARIFMessage{Text: "Breaking change introduced by the dependency upgrade"},
+		DefaultConfiguration: SARIFConfiguration{Level: "error"},
+	},
+	{
+		ID:                   sarifRuleBehaviorChange,
+		Name:                 "BehaviorChange",
+		ShortDescription:     SARIFMessage{Text: "Non-breaking behavior change introduced by the dependency upgrade"},
+		DefaultConfiguration: SARIFConfiguration{Level: "note"},
+	},
+	{
+		ID:                   sarifRuleIrreversibleMigration,
+		Name:                 "IrreversibleMigration",
+		ShortDescription:     SARIFMessage{Text: "Migration the dependency rollback cannot undo"},
+		DefaultConfiguration: SARIFConfiguration{Level: "error"},
+	},
+	{
+		ID:                   sarifRuleDataFormatChange,
+		Name:                 "DataFormatChange",
+		ShortDescription:     SARIFMessage{Text: "Data format the older version of the dependency cannot read"},
+		DefaultConfiguration: SARIFConfiguration{Level: "error"},
+	},
+	{
+		ID:                   sarifRuleRemovedFeature,
+		Name:                 "RemovedFeature",
+		ShortDescription:     SARIFMessage{Text: "Feature lost by the dependency rollback"},
+		DefaultConfiguration: SARIFConfiguration{Level: "warning"},
+	},
+}
+
+// RenderSARIF converts an analysis result into a SARIF 2.1.0 log with one result per breaker
+// and behavior change, or for a rollback per irreversible migration, data format change and
+// removed feature.
+func RenderSARIF(resp AnalyzeResponse, opts SARIFOptions) SARIFLog {
+	subject := sarifSubject(resp.Meta)
+	results := make([]SARIFResult, 0, len(resp.Breakers)+len(resp.BehaviorChanges))
+
+	for _, b := range resp.Breakers {
+		results = append(results, SARIFResult{
+			RuleID:              sarifRuleBreakingChange,
+			RuleIndex:           0,
+			Level:               sarifLevelForSeverity(b.Severity),
+			Message:             SARIFMessage{Text: sarifMessageText(b.Title, b.Reason)},
+			Locations:           sarifLocations(subject, opts),
+			RelatedLocations:    sarifRelatedLocations(b.Evidence),
+			PartialFingerprints: sarifFingerprint(sarifRuleBreakingChange, subject, b.Title),
+			Properties:          map[string]any{"severity": strings.ToLower(strings.TrimSpace(b.Severity))},
+		})
+	}
+	for _, c := range resp.BehaviorChanges {
+		results = append(results, SARIFResult{
+			RuleID:              sarifRuleBehaviorChange,
+			RuleIndex:           1,
+			Level:               "note",
+			Message:             SARIFMessage{Text: sarifMessageText(c.Title, c.Reason)},
+			Locations:           sarifLocations(subject, opts),
+			RelatedLocations:    sarifRelatedLocations(c.Evidence),
+			PartialFingerprints: sarifFingerprint(sarifRuleBehaviorChange, subject, c.Title),
+		})
+	}
+	if rb := resp.Rollback; rb != nil {
+		results = appendRollbackSARIFResults(results, sarifRuleIrreversibleMigration, 2, rb.IrreversibleMigrations, subject, opts)
+		results = appendRollbackSARIFResults(results, sarifRuleDataFormatChange, 3, rb.DataFormatChanges, subject, opts)
+		results = appendRollbackSARIFResults(results, sarifRuleRemovedFeature, 4, rb.RemovedFeatures, subject, opts)
+	}
+
+	run := SARIFRun{
+		Tool: SARIFTool{Driver: SARIFDriver{
+			Name:           "DiffBreak",
+			InformationURI: "https://diffbreak.fyi",
+			Rules:          sarifRules,
+		}},
+		Results: results,
+		Properties: map[string]any{
+			"repo":       resp.Meta.Repo.Url,
+			"fromTag":    resp.Meta.FromTag,
+			"toTag":      resp.Meta.ToTag,
+			"riskLevel":  resp.Risk.Level,
+			"riskScore":  resp.Risk.Score,
+			"confidence": resp.Risk.Confidence,
+		},
+	}
+	if resp.Meta.Model != "" {
+		run.Properties["model"] = resp.Meta.Model
+	}
+	if resp.Rollback != nil {
+		run.Properties["rollback"] = true
+	}
+	if opts.ArtifactURI != "" {
+		run.Artifacts = []SARIFArtifact{{Location: SARIFArtifactLocation{URI: opts.ArtifactURI}}}
+	}
+
+	return SARIFLog{
+		Schema:  sarifSchemaURL,
+		Version: sarifVersion,
+		Runs:    []SARIFRun{run},
+	}
+}
+
+func appendRollbackSARIFResults(results []SARIFResult, ruleID string, ruleIndex int, changes []RollbackChange, subject string, opts SARIFOptions) []SARIFResult {
+	for _, c := range changes {
+		results = append(results, SARIFResult{
+			RuleID:              ruleID,
+			RuleIndex:           ruleIndex,
+			Level:               sarifLevelForSeverity(c.Severity),
+			Message:             SARIFMessage{Text: sarifMessageText(c.Title, c.Reason)},
+			Locations:           sarifLocations(subject, opts),
+			RelatedLocations:    sarifRelatedLocations(c.Evidence),
+			PartialFingerprints: sarifFingerprint(ruleID, subject, c.Title),
+			Properties:          map[string]any{"severity": strings.ToLower(strings.TrimSpace(c.Severity))},
+		})
+	}
+	return results
+}
+
+// sarifLevelForSeverity maps Breaker.Severity and RollbackChange.Severity onto SARIF result
+// levels.
+func sarifLevelForSeverity(severity string) string {
+	switch strings.ToLower(strings.TrimSpace(severity)) {
+	case "high":
+		return "error"
+	case "low":
+		return "note"
+	default:
+		return "warning"
+	}
+}
+
+func sarifSubject(meta MetaInfo) string {
+	subject := meta.Repo.Url
+	if meta.FromTag != "" || meta.ToTag != "" {
+		subject += "@" + meta.FromTag + "..." + meta.ToTag
+	}
+	return subject
+}
+
+func sarifMessageText(title, reason string) string {
+	title = strings.TrimSpace(title)
+	reason = strings.TrimSpace(reason)
+	switch {
+	case title == "":
+		return reason
+	case reason == "":
+		return title
+	default:
+		return title + ": " + reason
+	}
+}
+
+func sarifLocations(subject string, opts SARIFOptions) []SARIFLocation {
+	loc := SARIFLocation{
+		LogicalLocations: []SARIFLogicalLocation{{
+			Name:               subject,
+			FullyQualifiedName: subject,
+			Kind:               "module",
+		}},
+	}
+	if opts.ArtifactURI != "" {
+		loc.PhysicalLocation = &SARIFPhysicalLocation{
+			ArtifactLocation: SARIFArtifactLocation{URI: opts.ArtifactURI},
+		}
+	}
+	return []SARIFLocation{loc}
+}
+
+func sarifRelatedLocations(evidence []EvidenceLink) []SARIFLocation {
+	var related []SARIFLocation
+	for _, e := range evidence {
+		if strings.TrimSpace(e.Url) == "" {
+			continue
+		}
+		loc := SARIFLocation{
+			ID: len(related) + 1,
+			PhysicalLocation: &SARIFPhysicalLocation{
+				ArtifactLocation: SARIFArtifactLocation{URI: e.Url},
+			},
+		}
+		if label := strings.TrimSpace(e.Label); label != "" {
+			loc.Message = &SARIFMessage{Text: label}
+		}
+		related = append(related, loc)
+	}
+	return related
+}
+
+func sarifFingerprint(ruleID, subject, title string) map[string]string {
+	sum := sha256.Sum256([]byte(ruleID + "\x00" + subject + "\x00" + strings.ToLower(strings.TrimSpace(title))))
+	return map[string]string{"diffbreakFinding/v1": hex.EncodeToString(sum[:16])}
+}
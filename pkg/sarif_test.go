@@ -0,0 +1,148 @@
+package pkg
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRenderSARIFMapsBreakers(t *testing.T) {
+	resp := AnalyzeResponse{
+		Risk: RiskInfo{Level: "high", Score: 80, Confidence: "medium"},
+		Breakers: []Breaker{
+			{
+				Title:    "Removed Foo API",
+				Severity: "high",
+				Reason:   "Foo was deleted",
+				Evidence: []EvidenceLink{
+					{Label: "PR #12", Url: "https://github.com/octo/hello/pull/12"},
+					{Label: "no url", Url: ""},
+				},
+			},
+			{Title: "Renamed flag", Severity: "medium", Reason: "--x is now --y"},
+			{Title: "Docs", Severity: "low"},
+		},
+		BehaviorChanges: []BehaviorChange{{Title: "Default timeout", Reason: "now 30s"}},
+		Meta: MetaInfo{
+			Repo:    RepoMeta{Url: "https://github.com/octo/hello"},
+			FromTag: "v1.0.0",
+			ToTag:   "v2.0.0",
+		},
+	}
+
+	log := RenderSARIF(resp, SARIFOptions{ArtifactURI: "go.mod"})
+
+	if log.Version != "2.1.0" {
+		t.Fatalf("unexpected version %q", log.Version)
+	}
+	if len(log.Runs) != 1 {
+		t.Fatalf("expected 1 run, got %d", len(log.Runs))
+	}
+	run := log.Runs[0]
+	if len(run.Results) != 4 {
+		t.Fatalf("expected 4 results, got %d", len(run.Results))
+	}
+
+	wantLevels := []string{"error", "warning", "note", "note"}
+	wantRules := []string{sarifRuleBreakingChange, sarifRuleBreakingChange, sarifRuleBreakingChange, sarifRuleBehaviorChange}
+	for i, res := range run.Results {
+		if res.Level != wantLevels[i] {
+			t.Fatalf("result %d: expected level %q, got %q", i, wantLevels[i], res.Level)
+		}
+		if res.RuleID != wantRules[i] {
+			t.Fatalf("result %d: expected rule %q, got %q", i, wantRules[i], res.RuleID)
+		}
+		if run.Tool.Driver.Rules[res.RuleIndex].ID != res.RuleID {
+			t.Fatalf("result %d: ruleIndex does not match ruleId", i)
+		}
+		if len(res.Locations) != 1 || res.Locations[0].PhysicalLocation == nil || res.Locations[0].PhysicalLocation.ArtifactLocation.URI != "go.mod" {
+			t.Fatalf("result %d: expected go.mod physical location", i)
+		}
+	}
+
+	first := run.Results[0]
+	if first.Message.Text != "Removed Foo API: Foo was deleted" {
+		t.Fatalf("unexpected message %q", first.Message.Text)
+	}
+	if len(first.RelatedLocations) != 1 {
+		t.Fatalf("expected 1 related location, got %d", len(first.RelatedLocations))
+	}
+	if first.RelatedLocations[0].PhysicalLocation.ArtifactLocation.URI != "https://github.com/octo/hello/pull/12" {
+		t.Fatalf("unexpected related location %+v", first.RelatedLocations[0])
+	}
+
+	payload, err := json.Marshal(log)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if decoded["$schema"] == "" {
+		t.Fatalf("expected $schema to be set")
+	}
+}
+
+func TestRenderSARIFWithoutArtifactUsesLogicalLocation(t *testing.T) {
+	resp := AnalyzeResponse{
+		Breakers: []Breaker{{Title: "Removed Foo", Severity: "high"}},
+		Meta:     MetaInfo{Repo: RepoMeta{Url: "https://github.com/octo/hello"}, FromTag: "v1", ToTag: "v2"},
+	}
+
+	log := RenderSARIF(resp, SARIFOptions{})
+	loc := log.Runs[0].Results[0].Locations[0]
+	if loc.PhysicalLocation != nil {
+		t.Fatalf("expected no physical location")
+	}
+	if len(loc.LogicalLocations) != 1 || loc.LogicalLocations[0].Name != "https://github.com/octo/hello@v1...v2" {
+		t.Fatalf("unexpected logical location %+v", loc.LogicalLocations)
+	}
+	if log.Runs[0].Artifacts != nil {
+		t.Fatalf("expected no artifacts")
+	}
+}
+
+func TestRenderSARIFMapsRollbackFindings(t *testing.T) {
+	resp := AnalyzeResponse{
+		Risk: RiskInfo{Level: "high", Score: 70, Confidence: "medium"},
+		Rollback: &RollbackInfo{
+			RemovedFeatures: []RollbackChange{{Title: "Bulk export", Severity: "low"}},
+			IrreversibleMigrations: []RollbackChange{{
+				Title:    "Drops legacy table",
+				Severity: "high",
+				Reason:   "v1 reads the table",
+				Evidence: []EvidenceLink{{Label: "PR #3", Url: "https://github.com/octo/hello/pull/3"}},
+			}},
+			DataFormatChanges: []RollbackChange{{Title: "Config v2", Severity: "medium"}},
+		},
+		Meta: MetaInfo{
+			Repo:    RepoMeta{Url: "https://github.com/octo/hello"},
+			FromTag: "v2.0.0",
+			ToTag:   "v1.0.0",
+		},
+	}
+
+	run := RenderSARIF(resp, SARIFOptions{}).Runs[0]
+	if len(run.Results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(run.Results))
+	}
+	wantLevels := []string{"error", "warning", "note"}
+	wantRules := []string{sarifRuleIrreversibleMigration, sarifRuleDataFormatChange, sarifRuleRemovedFeature}
+	for i, res := range run.Results {
+		if res.Level != wantLevels[i] {
+			t.Fatalf("result %d: expected level %q, got %q", i, wantLevels[i], res.Level)
+		}
+		if res.RuleID != wantRules[i] {
+			t.Fatalf("result %d: expected rule %q, got %q", i, wantRules[i], res.RuleID)
+		}
+		if run.Tool.Driver.Rules[res.RuleIndex].ID != res.RuleID {
+			t.Fatalf("result %d: ruleIndex does not match ruleId", i)
+		}
+	}
+	if run.Results[0].Message.Text != "Drops legacy table: v1 reads the table" || len(run.Results[0].RelatedLocations) != 1 {
+		t.Fatalf("unexpected migration result %+v", run.Results[0])
+	}
+	if run.Properties["rollback"] != true {
+		t.Fatalf("expected the run to be marked as a rollback, got %v", run.Properties)
+	}
+}
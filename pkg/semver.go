@@ -0,0 +1,136 @@
+package pkg
+
+import (
+	"strconv"
+	"strings"
+)
+
+// semver is a parsed semantic version. Tags are parsed leniently: any prefix before the
+// version number (v, release-, pkg@, sub/dir/v) is ignored and a missing patch is treated as 0.
+type semver struct {
+	Major, Minor, Patch int
+	Prerelease          []string
+}
+
+func parseSemver(tag string) (semver, bool) {
+	s := strings.TrimSpace(tag)
+	if s == "" {
+		return semver{}, false
+	}
+	start := strings.IndexAny(s, "0123456789")
+	if start == -1 {
+		return semver{}, false
+	}
+	// Only accept prefixes that end in a separator or "v", so "abc123" is not a version.
+	if start > 0 {
+		switch s[start-1] {
+		case 'v', 'V', '-', '_', '/', '@':
+		default:
+			return semver{}, false
+		}
+	}
+	s = s[start:]
+
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+	var pre string
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		s, pre = s[:i], s[i+1:]
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return semver{}, false
+	}
+	nums := [3]int{}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return semver{}, false
+		}
+		nums[i] = n
+	}
+
+	v := semver{Major: nums[0], Minor: nums[1], Patch: nums[2]}
+	if pre != "" {
+		v.Prerelease = strings.Split(pre, ".")
+	}
+	return v, true
+}
+
+// compareSemver returns -1, 0 or 1 following semantic versioning precedence.
+func compareSemver(a, b semver) int {
+	for _, d := range [][2]int{{a.Major, b.Major}, {a.Minor, b.Minor}, {a.Patch, b.Patch}} {
+		if d[0] != d[1] {
+			if d[0] < d[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	switch {
+	case len(a.Prerelease) == 0 && len(b.Prerelease) == 0:
+		return 0
+	case len(a.Prerelease) == 0:
+		return 1
+	case len(b.Prerelease) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(a.Prerelease) && i < len(b.Prerelease); i++ {
+		if c := comparePrereleaseIdent(a.Prerelease[i], b.Prerelease[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(a.Prerelease) < len(b.Prerelease):
+		return -1
+	case len(a.Prerelease) > len(b.Prerelease):
+		return 1
+	}
+	return 0
+}
+
+func comparePrereleaseIdent(a, b string) int {
+	an, aErr := strconv.Atoi(a)
+	bn, bErr := strconv.Atoi(b)
+	switch {
+	case aErr == nil && bErr == nil:
+		switch {
+		case an < bn:
+			return -1
+		case an > bn:
+			return 1
+		}
+		return 0
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// compareVersionTags compares two tags by semver precedence. ok is false when either tag
+// does not parse as a version.
+func compareVersionTags(a, b string) (cmp int, ok bool) {
+	av, aok := parseSemver(a)
+	bv, bok := parseSemver(b)
+	if !aok || !bok {
+		return 0, false
+	}
+	return compareSemver(av, bv), true
+}
+
+// isDowngrade reports whether fromTag is a newer version than toTag, i.e. going from one to the
+// other rolls back. Tags that are not versions, or versions of different tag prefixes such as
+// two modules of a monorepo, are never a downgrade.
+func isDowngrade(fromTag, toTag string) bool {
+	if versionTagPrefix(fromTag) != versionTagPrefix(toTag) {
+		return false
+	}
+	cmp, ok := compareVersionTags(fromTag, toTag)
+	return ok && cmp > 0
+}
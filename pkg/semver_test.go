@@ -0,0 +1,50 @@
+package pkg
+
+import "testing"
+
+func TestCompareVersionTags(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+		ok   bool
+	}{
+		{"v1.2.3", "v1.2.3", 0, true},
+		{"v1.2.3", "v1.10.0", -1, true},
+		{"2.0.0", "v1.9.9", 1, true},
+		{"v1.0.0-rc.1", "v1.0.0", -1, true},
+		{"v1.0.0-alpha", "v1.0.0-alpha.1", -1, true},
+		{"v1.0.0-rc.2", "v1.0.0-rc.10", -1, true},
+		{"release-1.4", "release-1.3.9", 1, true},
+		{"cobra@1.2.0", "sub/dir/v1.3.0", -1, true},
+		{"v1.0.0+build.5", "v1.0.0", 0, true},
+		{"latest", "v1.0.0", 0, false},
+		{"abc123", "v1.0.0", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := compareVersionTags(tt.a, tt.b)
+		if ok != tt.ok || got != tt.want {
+			t.Fatalf("compareVersionTags(%q, %q) = %d, %v; want %d, %v", tt.a, tt.b, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestIsDowngrade(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{"v2.0.0", "v1.9.0", true},
+		{"v1.9.0", "v2.0.0", false},
+		{"v1.0.0", "v1.0.0", false},
+		{"v1.0.0", "v1.0.0-rc.1", true},
+		{"main", "v1.0.0", false},
+		{"api/v2.0.0", "api/v1.9.0", true},
+		{"api/v2.0.0", "cli/v1.9.0", false},
+		{"v2.0.0", "1.9.0", false},
+	}
+	for _, tt := range tests {
+		if got := isDowngrade(tt.from, tt.to); got != tt.want {
+			t.Fatalf("isDowngrade(%q, %q) = %v; want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// NewHTTPServer builds the API server from cfg, logging server errors through logger.
+func NewHTTPServer(cfg ServerConfig, handler http.Handler, logger *zap.Logger) *http.Server {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	errorLog, err := zap.NewStdLogAt(logger.With(zap.String("component", "http_server")), zap.WarnLevel)
+	if err != nil {
+		errorLog = nil
+	}
+	return &http.Server{
+		Addr:              net.JoinHostPort(cfg.Interface, cfg.Port),
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		ErrorLog:          errorLog,
+	}
+}
+
+// ServeUntilDone serves on srv until ctx is cancelled, then stops accepting connections and
+// waits up to shutdownTimeout for in-flight requests and the drain funcs (e.g. background
+// analyses) to finish. Connections still open after the deadline are closed. It returns the
+// error that stopped the listener, or nil after a shutdown.
+func ServeUntilDone(ctx context.Context, srv *http.Server, shutdownTimeout time.Duration, logger *zap.Logger, drain ...func()) error {
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return err
+	}
+	return serveListenerUntilDone(ctx, srv, ln, shutdownTimeout, logger, drain...)
+}
+
+func serveListenerUntilDone(ctx context.Context, srv *http.Server, ln net.Listener, shutdownTimeout time.Duration, logger *zap.Logger, drain ...func()) error {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Info("shutting down, draining in-flight requests", zap.Duration("timeout", shutdownTimeout))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logger.Warn("requests still running at shutdown deadline, closing connections", zap.Error(err))
+			_ = srv.Close()
+		}
+		for _, fn := range drain {
+			fn()
+		}
+	}()
+
+	select {
+	case <-drained:
+		logger.Info("shutdown complete")
+	case <-shutdownCtx.Done():
+		_ = srv.Close()
+		logger.Warn("shutdown deadline exceeded, abandoning background work")
+	}
+
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
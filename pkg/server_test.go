@@ -0,0 +1,116 @@
+package pkg
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestServeUntilDoneDrainsInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		_, _ = io.WriteString(w, "done")
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	cfg := DefaultConfig().Server
+	srv := NewHTTPServer(cfg, mux, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var drained atomic.Bool
+	served := make(chan error, 1)
+	go func() {
+		served <- serveListenerUntilDone(ctx, srv, ln, 5*time.Second, nil, func() { drained.Store(true) })
+	}()
+
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/slow")
+		if err != nil {
+			body <- "error: " + err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		body <- string(data)
+	}()
+
+	<-started
+	cancel()
+
+	// New connections are refused once the shutdown started.
+	deadline := time.Now().Add(time.Second)
+	for {
+		conn, err := net.DialTimeout("tcp", ln.Addr().String(), 100*time.Millisecond)
+		if err != nil {
+			break
+		}
+		_ = conn.Close()
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the listener to be closed during shutdown")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(release)
+	if got := <-body; got != "done" {
+		t.Fatalf("expected in-flight request to complete, got %q", got)
+	}
+	if err := <-served; err != nil {
+		t.Fatalf("expected clean shutdown, got %v", err)
+	}
+	if !drained.Load() {
+		t.Fatalf("expected drain funcs to run")
+	}
+}
+
+func TestServeUntilDoneAbortsAfterDeadline(t *testing.T) {
+	started := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stuck", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := NewHTTPServer(DefaultConfig().Server, mux, nil)
+
+	blocked := make(chan struct{})
+	t.Cleanup(func() { close(blocked) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serveListenerUntilDone(ctx, srv, ln, 50*time.Millisecond, nil, func() { <-blocked })
+	}()
+	go func() {
+		if resp, err := http.Get("http://" + ln.Addr().String() + "/stuck"); err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	<-started
+	cancel()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatalf("expected shutdown without error, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected shutdown to give up after its deadline")
+	}
+}
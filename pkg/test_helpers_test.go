@@ -1,9 +1,11 @@
 package pkg
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"sync/atomic"
 	"testing"
 
 	"github.com/google/go-github/v83/github"
@@ -25,3 +27,33 @@ func newGitHubTestClient(t *testing.T, handler http.Handler) *github.Client {
 
 	return client
 }
+
+// validModelResponse is a minimal model answer that passes validateAndNormalizeResponse.
+const validModelResponse = `{"risk":{"level":"low","score":10,"confidence":"high","reasons":[]},"summary":{"highlights":["Minor update"],"grouped":[]},"breakers":[],"behaviorChanges":[],"upgradeSteps":[],"evidence":[],"meta":{}}`
+
+// newOllamaTestServer starts a fake Ollama /api/generate that always answers modelResp and
+// returns the server and a pointer to its request count.
+func newOllamaTestServer(t *testing.T, modelResp string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var count atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"response": modelResp, "done": true})
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &count
+}
+
+// emptyCompareMux serves an empty comparison and release list for owner/repo between from and to.
+func emptyCompareMux(mux *http.ServeMux, owner, repo, from, to string) {
+	mux.HandleFunc("/repos/"+owner+"/"+repo+"/compare/"+from+"..."+to, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"commits":[],"files":[]}`))
+	})
+	mux.HandleFunc("/repos/"+owner+"/"+repo+"/releases", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[]`))
+	})
+}
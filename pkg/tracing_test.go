@@ -0,0 +1,104 @@
+package pkg
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordSpans installs a global tracer provider recording every span until the test ends.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		_ = provider.Shutdown(context.Background())
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+	return recorder
+}
+
+func spanAttribute(span sdktrace.ReadOnlySpan, key string) (attribute.Value, bool) {
+	for _, kv := range span.Attributes() {
+		if string(kv.Key) == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestAnalyzeTracing(t *testing.T) {
+	recorder := recordSpans(t)
+
+	ghMux := http.NewServeMux()
+	emptyCompareMux(ghMux, "octo", "hello", "v1.0.0", "v1.1.0")
+	ollama, _ := newOllamaTestServer(t, validModelResponse)
+	analyzer := &Analyzer{GitHub: newGitHubTestClient(t, ghMux), OllamaBaseURL: ollama.URL}
+	handler := WrapHandler("analyze", NewAnalyzeHandler(analyzer), nil)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	body := `{"repoUrl":"https://github.com/octo/hello","fromTag":"v1.0.0","toTag":"v1.1.0","mode":"fast"}`
+	req := httptest.NewRequest(http.MethodPost, "/analyze", strings.NewReader(body))
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range recorder.Ended() {
+		if s.SpanContext().TraceID().String() != traceID {
+			t.Errorf("span %s is not part of the incoming trace", s.Name())
+		}
+		spans[s.Name()] = s
+	}
+	for _, name := range []string{"analyze", "analysis.analyze", "github.compare_commits", "github.list_releases", "analysis.build_prompt", "ollama.generate", "analysis.validate"} {
+		if _, ok := spans[name]; !ok {
+			t.Fatalf("expected span %s, got %v", name, recorder.Ended())
+		}
+	}
+
+	if v, _ := spanAttribute(spans["analyze"], "http.response.status_code"); v.AsInt64() != http.StatusOK {
+		t.Fatalf("expected status code attribute on the server span, got %v", v)
+	}
+	analysis := spans["analysis.analyze"]
+	if v, _ := spanAttribute(analysis, "repo"); v.AsString() != "octo/hello" {
+		t.Fatalf("expected repo attribute, got %v", v)
+	}
+	if analysis.Parent().SpanID() != spans["analyze"].SpanContext().SpanID() {
+		t.Fatalf("expected the analysis span to be a child of the request span")
+	}
+	generate := spans["ollama.generate"]
+	if v, _ := spanAttribute(generate, "model"); v.AsString() != DefaultConfig().Ollama.Fast.Model {
+		t.Fatalf("expected model attribute, got %v", v)
+	}
+	if v, _ := spanAttribute(generate, "phase"); v.AsString() != "initial" {
+		t.Fatalf("expected initial phase, got %v", v)
+	}
+	if v, ok := spanAttribute(spans["analysis.build_prompt"], "prompt.bytes"); !ok || v.AsInt64() == 0 {
+		t.Fatalf("expected prompt size attribute, got %v", v)
+	}
+}
+
+func TestSetupTracingDisabledWithoutEndpoint(t *testing.T) {
+	shutdown, err := SetupTracing(context.Background(), DefaultConfig().Tracing)
+	if err != nil {
+		t.Fatalf("SetupTracing: %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+}
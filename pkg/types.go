@@ -16,15 +16,21 @@ type DetectResponse struct {
 	Tags        []string `json:"tags"`
 	DefaultFrom string   `json:"defaultFrom,omitempty"`
 	DefaultTo   string   `json:"defaultTo,omitempty"`
+	// Package is set when the repository was resolved from package coordinates.
+	Package *ResolvedPackage `json:"package,omitempty"`
 }
 
 // AnalyzeRequest is the input payload expected by the /analyze endpoint.
+// When Package and Ecosystem are set instead of RepoUrl, the repository is resolved through the
+// package registry and FromTag/ToTag may be given as package versions.
 type AnalyzeRequest struct {
-	RepoUrl string `json:"repoUrl"`
-	FromTag string `json:"fromTag"`
-	ToTag   string `json:"toTag"`
-	Mode    string `json:"mode"`
-	Limits  struct {
+	RepoUrl   string `json:"repoUrl"`
+	Package   string `json:"package,omitempty"`
+	Ecosystem string `json:"ecosystem,omitempty"`
+	FromTag   string `json:"fromTag"`
+	ToTag     string `json:"toTag"`
+	Mode      string `json:"mode"`
+	Limits    struct {
 		MaxReleases int `json:"maxReleases"`
 	} `json:"limits"`
 }
@@ -37,7 +43,10 @@ type AnalyzeResponse struct {
 	BehaviorChanges []BehaviorChange `json:"behaviorChanges"`
 	UpgradeSteps    []UpgradeStep    `json:"upgradeSteps"`
 	Evidence        []EvidenceItem   `json:"evidence"`
-	Meta            MetaInfo         `json:"meta"`
+	// Rollback is set instead of breakers, behavior changes and upgrade steps when the analysis
+	// is a downgrade.
+	Rollback *RollbackInfo `json:"rollback,omitempty"`
+	Meta     MetaInfo      `json:"meta"`
 }
 
 // RiskInfo captures the overall migration risk.
@@ -82,6 +91,28 @@ type UpgradeStep struct {
 	Evidence []EvidenceLink `json:"evidence"`
 }
 
+// RollbackInfo describes what rolling back to an older version loses.
+type RollbackInfo struct {
+	// RemovedFeatures are features and APIs the older version does not have.
+	RemovedFeatures []RollbackChange `json:"removedFeatures"`
+	// IrreversibleMigrations are schema or state migrations of the newer versions that the
+	// older version cannot undo or work with.
+	IrreversibleMigrations []RollbackChange `json:"irreversibleMigrations"`
+	// DataFormatChanges are config, storage or wire formats written by the newer version that
+	// the older one cannot read.
+	DataFormatChanges []RollbackChange `json:"dataFormatChanges"`
+	// Steps are the steps to roll back safely.
+	Steps []UpgradeStep `json:"steps"`
+}
+
+// RollbackChange is something a rollback loses or cannot undo.
+type RollbackChange struct {
+	Title    string         `json:"title"`
+	Severity string         `json:"severity"`
+	Reason   string         `json:"reason"`
+	Evidence []EvidenceLink `json:"evidence"`
+}
+
 // EvidenceItem is a top-level evidence entry.
 type EvidenceItem struct {
 	Label string `json:"label"`
@@ -101,6 +132,14 @@ type MetaInfo struct {
 	FromTag     string   `json:"fromTag"`
 	ToTag       string   `json:"toTag"`
 	GeneratedAt string   `json:"generatedAt"`
+	// Model is the model that produced the analysis.
+	Model string `json:"model,omitempty"`
+	// Fallback is set when the routed model failed and a fallback model produced the analysis.
+	Fallback bool `json:"fallback,omitempty"`
+	// Downgrade is set when fromTag is a newer version than toTag.
+	Downgrade bool `json:"downgrade,omitempty"`
+	// SampleScores are the risk scores of the individual samples of a thorough analysis.
+	SampleScores []int `json:"sampleScores,omitempty"`
 }
 
 // RepoMeta identifies the repository analyzed.
@@ -110,6 +149,10 @@ type RepoMeta struct {
 
 type errorResponse struct {
 	Error string `json:"error"`
+	// RequestID is filled in by writeJSON from the response's X-Request-ID header.
+	RequestID string `json:"requestId,omitempty"`
+	// ResetAt is when an exhausted GitHub rate limit resets, in RFC 3339.
+	ResetAt string `json:"resetAt,omitempty"`
 }
 
 type analysisInputBundle struct {
@@ -119,6 +162,7 @@ type analysisInputBundle struct {
 	ReleaseNotes []releaseNote `json:"releaseNotes"`
 	CommitTitles []string      `json:"commitTitles"`
 	ChangedFiles []string      `json:"changedFiles,omitempty"`
+	PullRequests []pullRequest `json:"pullRequests,omitempty"`
 }
 
 type releaseNote struct {
@@ -130,6 +174,18 @@ type comparisonData struct {
 	ReleaseNotes []releaseNote
 	CommitTitles []string
 	ChangedFiles []string
+	// PullRequests are the pull requests the commits were merged with; only the GraphQL fetch
+	// provides them.
+	PullRequests []pullRequest
+	// FromCommit and ToCommit are the commits the tags point to.
+	FromCommit string
+	ToCommit   string
+}
+
+type pullRequest struct {
+	Number int      `json:"number"`
+	Title  string   `json:"title"`
+	Labels []string `json:"labels,omitempty"`
 }
 
 type ollamaGenerateRequest struct {
@@ -142,12 +198,17 @@ type ollamaGenerateRequest struct {
 type ollamaOptions struct {
 	Temperature float64 `json:"temperature"`
 	NumPredict  int     `json:"num_predict"`
+	NumCtx      int     `json:"num_ctx,omitempty"`
 }
 
 type ollamaGenerateResponse struct {
 	Response string `json:"response"`
 	Done     bool   `json:"done"`
 	Error    string `json:"error"`
+	// Token counts and the generation time in nanoseconds, reported once done.
+	PromptEvalCount int   `json:"prompt_eval_count"`
+	EvalCount       int   `json:"eval_count"`
+	EvalDuration    int64 `json:"eval_duration"`
 }
 
 type statusRecorder struct {
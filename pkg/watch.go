@@ -0,0 +1,436 @@
+package pkg
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Notification payload formats for watches.
+const (
+	NotifyFormatJSON  = "json"
+	NotifyFormatSlack = "slack"
+)
+
+// ErrWatchNotFound is returned for unknown watch IDs.
+var ErrWatchNotFound = errors.New("watch not found")
+
+// Watch subscribes a repository at its currently deployed version to new-release notifications.
+type Watch struct {
+	ID                 string `json:"id"`
+	RepoUrl            string `json:"repoUrl"`
+	CurrentVersion     string `json:"currentVersion"`
+	Mode               string `json:"mode"`
+	NotifyURL          string `json:"notifyUrl"`
+	NotifyFormat       string `json:"notifyFormat"`
+	IncludePrereleases bool   `json:"includePrereleases"`
+	// LastNotifiedTag is the newest release a notification was delivered for.
+	LastNotifiedTag string `json:"lastNotifiedTag,omitempty"`
+	LastCheckedAt   string `json:"lastCheckedAt,omitempty"`
+	LastError       string `json:"lastError,omitempty"`
+	CreatedAt       string `json:"createdAt"`
+	UpdatedAt       string `json:"updatedAt"`
+	// ETag of the last tag listing, used for conditional polling.
+	ETag string `json:"etag,omitempty"`
+	// Owner is the ID of the API key that created the watch; only that key can see and change
+	// it. Empty while authentication is disabled.
+	Owner string `json:"owner,omitempty"`
+}
+
+// WatchStore keeps watches in memory and, when a path is configured, persists them to a JSON file.
+type WatchStore struct {
+	path    string
+	mu      sync.Mutex
+	watches map[string]Watch
+}
+
+// NewWatchStore loads the watches persisted at path. An empty path keeps watches in memory only.
+func NewWatchStore(path string) (*WatchStore, error) {
+	store := &WatchStore{path: path, watches: make(map[string]Watch)}
+	if path == "" {
+		return store, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var watches []Watch
+	if err := json.Unmarshal(data, &watches); err != nil {
+		return nil, err
+	}
+	for _, w := range watches {
+		store.watches[w.ID] = w
+	}
+	return store, nil
+}
+
+// List returns all watches ordered by creation time.
+func (s *WatchStore) List() []Watch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listLocked()
+}
+
+// Get returns the watch with the given ID.
+func (s *WatchStore) Get(id string) (Watch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, ok := s.watches[id]
+	if !ok {
+		return Watch{}, ErrWatchNotFound
+	}
+	return w, nil
+}
+
+// Create assigns an ID and timestamps to w and stores it.
+func (s *WatchStore) Create(w Watch) (Watch, error) {
+	id, err := newWatchID()
+	if err != nil {
+		return Watch{}, err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	w.ID = id
+	w.CreatedAt = now
+	w.UpdatedAt = now
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.watches[id] = w
+	if err := s.saveLocked(); err != nil {
+		delete(s.watches, id)
+		return Watch{}, err
+	}
+	return w, nil
+}
+
+// Update applies fn to the stored watch and persists the result.
+func (s *WatchStore) Update(id string, fn func(*Watch)) (Watch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, ok := s.watches[id]
+	if !ok {
+		return Watch{}, ErrWatchNotFound
+	}
+	w := prev
+	fn(&w)
+	w.ID = prev.ID
+	w.CreatedAt = prev.CreatedAt
+	w.Owner = prev.Owner
+	s.watches[id] = w
+	if err := s.saveLocked(); err != nil {
+		s.watches[id] = prev
+		return Watch{}, err
+	}
+	return w, nil
+}
+
+// Delete removes the watch with the given ID.
+func (s *WatchStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, ok := s.watches[id]
+	if !ok {
+		return ErrWatchNotFound
+	}
+	delete(s.watches, id)
+	if err := s.saveLocked(); err != nil {
+		s.watches[id] = prev
+		return err
+	}
+	return nil
+}
+
+func (s *WatchStore) listLocked() []Watch {
+	watches := make([]Watch, 0, len(s.watches))
+	for _, w := range s.watches {
+		watches = append(watches, w)
+	}
+	sort.Slice(watches, func(i, j int) bool {
+		if watches[i].CreatedAt != watches[j].CreatedAt {
+			return watches[i].CreatedAt < watches[j].CreatedAt
+		}
+		return watches[i].ID < watches[j].ID
+	})
+	return watches
+}
+
+func (s *WatchStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.listLocked(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, data)
+}
+
+// writeFileAtomic writes data via a temp file and rename so a crash never leaves a torn file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func newWatchID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// watchInput is the writable subset of a Watch accepted by the CRUD endpoints.
+type watchInput struct {
+	RepoUrl            *string `json:"repoUrl"`
+	CurrentVersion     *string `json:"currentVersion"`
+	Mode               *string `json:"mode"`
+	NotifyURL          *string `json:"notifyUrl"`
+	NotifyFormat       *string `json:"notifyFormat"`
+	IncludePrereleases *bool   `json:"includePrereleases"`
+}
+
+// apply copies the set fields of in onto w and validates the result.
+func (in watchInput) apply(w *Watch) error {
+	if in.RepoUrl != nil {
+		w.RepoUrl = strings.TrimSpace(*in.RepoUrl)
+	}
+	if in.CurrentVersion != nil {
+		if v := strings.TrimSpace(*in.CurrentVersion); v != w.CurrentVersion {
+			// A new deployed version restarts release tracking from there.
+			w.CurrentVersion = v
+			w.LastNotifiedTag = ""
+		}
+	}
+	if in.Mode != nil {
+		w.Mode = *in.Mode
+	}
+	if in.NotifyURL != nil {
+		w.NotifyURL = strings.TrimSpace(*in.NotifyURL)
+	}
+	if in.NotifyFormat != nil {
+		w.NotifyFormat = *in.NotifyFormat
+	}
+	if in.IncludePrereleases != nil {
+		w.IncludePrereleases = *in.IncludePrereleases
+	}
+	// Any change may alter which release counts as new, so the next poll must not be short-circuited
+	// by a 304 on the previous tag listing.
+	w.ETag = ""
+
+	if w.Mode == "" {
+		w.Mode = "fast"
+	}
+	if w.NotifyFormat == "" {
+		w.NotifyFormat = NotifyFormatJSON
+	}
+
+	if _, _, err := ParseGitHubRepoURL(w.RepoUrl); err != nil {
+		return &RequestError{Message: "invalid repoUrl"}
+	}
+	if w.CurrentVersion == "" {
+		return &RequestError{Message: "currentVersion is required"}
+	}
+	if !isAnalysisMode(w.Mode) {
+		return &RequestError{Message: analysisModeMessage}
+	}
+	if w.NotifyFormat != NotifyFormatJSON && w.NotifyFormat != NotifyFormatSlack {
+		return &RequestError{Message: "notifyFormat must be 'json' or 'slack'"}
+	}
+	u, err := url.Parse(w.NotifyURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return &RequestError{Message: "notifyUrl must be an http(s) URL"}
+	}
+	// Hostnames resolving to internal addresses are refused when the notification is delivered.
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if ip := net.ParseIP(host); host == "localhost" || strings.HasSuffix(host, ".localhost") || (ip != nil && !isPublicIP(ip)) {
+		return &RequestError{Message: "notifyUrl must not point to a loopback, private or link-local address"}
+	}
+	return nil
+}
+
+// replace is apply for PUT: fields missing from in are reset to their defaults instead of kept.
+// The poll state survives as long as the deployed version stays the same.
+func (in watchInput) replace(w *Watch) error {
+	replaced := Watch{
+		ID:              w.ID,
+		CreatedAt:       w.CreatedAt,
+		Owner:           w.Owner,
+		LastNotifiedTag: w.LastNotifiedTag,
+		LastCheckedAt:   w.LastCheckedAt,
+		LastError:       w.LastError,
+	}
+	if in.CurrentVersion != nil {
+		replaced.CurrentVersion = w.CurrentVersion
+	}
+	if err := in.apply(&replaced); err != nil {
+		return err
+	}
+	*w = replaced
+	return nil
+}
+
+// watchView is w as returned by the CRUD endpoints. notifyUrl is redacted to its origin, as
+// webhook URLs such as Slack's carry their credentials in the path.
+func watchView(w Watch) Watch {
+	w.Owner = ""
+	if u, err := url.Parse(w.NotifyURL); err == nil && u.Host != "" {
+		redacted := u.Scheme + "://" + u.Host
+		if (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+			redacted += "/…"
+		}
+		w.NotifyURL = redacted
+	}
+	return w
+}
+
+// isPublicIP reports whether ip is a globally routable unicast address, i.e. not loopback,
+// private, link-local, multicast or unspecified.
+func isPublicIP(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate()
+}
+
+// WatchesHandler serves the watch CRUD endpoints:
+// GET/POST /watches and GET/PUT/PATCH/DELETE /watches/{id}. PUT replaces a watch, PATCH only
+// changes the fields it sets. Each API key only sees the watches it created.
+func WatchesHandler(store *WatchStore, logger *zap.Logger) http.HandlerFunc {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := requestLogger(r.Context(), logger).With(zap.String("handler", "watches"))
+		id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/watches"), "/")
+		owner := apiKeyID(r.Context())
+
+		if id == "" {
+			switch r.Method {
+			case http.MethodGet:
+				watches := []Watch{}
+				for _, watch := range store.List() {
+					if watch.Owner == owner {
+						watches = append(watches, watchView(watch))
+					}
+				}
+				writeJSON(w, http.StatusOK, watches)
+			case http.MethodPost:
+				var in watchInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					log.Warn("invalid JSON body", zap.Error(err))
+					writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid JSON body"})
+					return
+				}
+				watch := Watch{Owner: owner}
+				if err := in.apply(&watch); err != nil {
+					writeWatchError(w, err, log)
+					return
+				}
+				created, err := store.Create(watch)
+				if err != nil {
+					writeWatchError(w, err, log)
+					return
+				}
+				log.Info("watch created", zap.String("watch_id", created.ID), zap.String("repo_url", created.RepoUrl))
+				writeJSON(w, http.StatusCreated, watchView(created))
+			default:
+				log.Warn("method not allowed", zap.String("method", r.Method))
+				writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+			}
+			return
+		}
+
+		// Other keys' watches are reported as missing. The owner of a watch never changes, so
+		// checking it up front also covers the update and delete below.
+		watch, err := store.Get(id)
+		if err == nil && watch.Owner != owner {
+			err = ErrWatchNotFound
+		}
+		if err != nil {
+			writeWatchError(w, err, log)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, watchView(watch))
+		case http.MethodPut, http.MethodPatch:
+			var in watchInput
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+				log.Warn("invalid JSON body", zap.Error(err))
+				writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid JSON body"})
+				return
+			}
+			update := in.apply
+			if r.Method == http.MethodPut {
+				update = in.replace
+			}
+			var applyErr error
+			updated, err := store.Update(id, func(watch *Watch) {
+				candidate := *watch
+				if applyErr = update(&candidate); applyErr == nil {
+					candidate.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+					*watch = candidate
+				}
+			})
+			if err == nil {
+				err = applyErr
+			}
+			if err != nil {
+				writeWatchError(w, err, log)
+				return
+			}
+			writeJSON(w, http.StatusOK, watchView(updated))
+		case http.MethodDelete:
+			if err := store.Delete(id); err != nil {
+				writeWatchError(w, err, log)
+				return
+			}
+			log.Info("watch deleted", zap.String("watch_id", id))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			log.Warn("method not allowed", zap.String("method", r.Method))
+			writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+		}
+	}
+}
+
+func writeWatchError(w http.ResponseWriter, err error, logger *zap.Logger) {
+	var reqErr *RequestError
+	switch {
+	case errors.As(err, &reqErr):
+		logger.Warn("invalid watch", zap.String("reason", reqErr.Message))
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: reqErr.Message})
+	case errors.Is(err, ErrWatchNotFound):
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "watch not found"})
+	default:
+		logger.Error("watch store error", zap.Error(err))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "internal server error"})
+	}
+}
@@ -0,0 +1,320 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// WatchPoller periodically checks watched repositories for releases newer than the deployed
+// version, analyzes the upgrade and delivers a notification.
+type WatchPoller struct {
+	Store    *WatchStore
+	Analyzer *Analyzer
+	Interval time.Duration
+	// HTTPClient delivers notifications; when nil, a client that only connects to public
+	// addresses, so notifyUrl cannot be pointed at internal services.
+	HTTPClient *http.Client
+	Logger     *zap.Logger
+}
+
+// WatchNotification is the JSON payload delivered for notifyFormat "json".
+type WatchNotification struct {
+	Event          string           `json:"event"`
+	WatchID        string           `json:"watchId"`
+	RepoUrl        string           `json:"repoUrl"`
+	CurrentVersion string           `json:"currentVersion"`
+	NewTag         string           `json:"newTag"`
+	Analysis       *AnalyzeResponse `json:"analysis,omitempty"`
+	AnalysisError  string           `json:"analysisError,omitempty"`
+}
+
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+// Run polls every Interval until ctx is cancelled.
+func (p *WatchPoller) Run(ctx context.Context) {
+	interval := p.Interval
+	if interval <= 0 {
+		interval = 15 * time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		p.PollOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PollOnce checks every watch once.
+func (p *WatchPoller) PollOnce(ctx context.Context) {
+	for _, w := range p.Store.List() {
+		if ctx.Err() != nil {
+			return
+		}
+		p.checkWatch(ctx, w)
+	}
+}
+
+func (p *WatchPoller) logger() *zap.Logger {
+	if p.Logger == nil {
+		return zap.NewNop()
+	}
+	return p.Logger
+}
+
+func (p *WatchPoller) checkWatch(ctx context.Context, w Watch) {
+	log := p.logger().With(zap.String("watch_id", w.ID), zap.String("repo_url", w.RepoUrl))
+	if w.Owner != "" {
+		// The watch was created with an API key, which may use the GitHub App.
+		ctx = withGitHubAppAccess(ctx)
+	}
+
+	listCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	tags, etag, err := GetRepoTagsWithETag(listCtx, p.Analyzer.GitHub, w.RepoUrl, w.ETag)
+	cancel()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	if errors.Is(err, ErrNotModified) {
+		observeWatchPoll("not_modified")
+		p.updateWatch(w.ID, func(stored *Watch) { stored.LastCheckedAt = now }, log)
+		return
+	}
+	if err != nil {
+		observeWatchPoll("error")
+		log.Warn("watch poll failed", zap.Error(err))
+		p.updateWatch(w.ID, func(stored *Watch) {
+			stored.LastCheckedAt = now
+			stored.LastError = err.Error()
+		}, log)
+		return
+	}
+
+	newTag := newestReleaseTag(tags, w.CurrentVersion, w.IncludePrereleases)
+	if newTag == "" || newTag == w.LastNotifiedTag {
+		observeWatchPoll("no_release")
+		p.updateWatch(w.ID, func(stored *Watch) {
+			stored.LastCheckedAt = now
+			stored.LastError = ""
+			stored.ETag = etag
+		}, log)
+		return
+	}
+
+	observeWatchPoll("new_release")
+	log.Info("new release detected", zap.String("current_version", w.CurrentVersion), zap.String("new_tag", newTag))
+
+	notification := WatchNotification{
+		Event:          "new_release",
+		WatchID:        w.ID,
+		RepoUrl:        w.RepoUrl,
+		CurrentVersion: w.CurrentVersion,
+		NewTag:         newTag,
+	}
+	analyzeCtx, cancel := context.WithTimeout(ctx, p.Analyzer.config().Timeouts.Analyze)
+	resp, err := p.Analyzer.Analyze(analyzeCtx, AnalyzeRequest{RepoUrl: w.RepoUrl, FromTag: w.CurrentVersion, ToTag: newTag, Mode: w.Mode})
+	cancel()
+	if ctx.Err() != nil {
+		// Shutting down: leave the watch as is so the release is picked up again after a restart.
+		log.Info("poller stopped, dropping watch analysis")
+		return
+	}
+	if errors.Is(err, ErrModelBusy) {
+		// Retry on the next poll instead of notifying without an analysis.
+		log.Warn("model busy, deferring watch notification")
+		p.updateWatch(w.ID, func(stored *Watch) {
+			stored.LastCheckedAt = now
+			stored.LastError = "model busy"
+		}, log)
+		return
+	}
+	if err != nil {
+		log.Warn("watch analysis failed", zap.Error(err))
+		notification.AnalysisError = analysisErrorMessage(err)
+	} else {
+		notification.Analysis = &resp
+	}
+
+	if err := p.notify(ctx, w, notification); err != nil {
+		observeWatchNotification("error")
+		log.Warn("watch notification failed", zap.Error(err))
+		// Leave LastNotifiedTag and ETag untouched so the next poll retries the delivery.
+		p.updateWatch(w.ID, func(stored *Watch) {
+			stored.LastCheckedAt = now
+			stored.LastError = "notification failed: " + err.Error()
+		}, log)
+		return
+	}
+	observeWatchNotification("ok")
+
+	p.updateWatch(w.ID, func(stored *Watch) {
+		stored.LastCheckedAt = now
+		stored.LastError = ""
+		stored.LastNotifiedTag = newTag
+		stored.ETag = etag
+	}, log)
+}
+
+func (p *WatchPoller) updateWatch(id string, fn func(*Watch), log *zap.Logger) {
+	if _, err := p.Store.Update(id, fn); err != nil && !errors.Is(err, ErrWatchNotFound) {
+		log.Error("failed to update watch", zap.Error(err))
+	}
+}
+
+func (p *WatchPoller) notify(ctx context.Context, w Watch, n WatchNotification) error {
+	var payload any = n
+	if w.NotifyFormat == NotifyFormatSlack {
+		payload = slackMessage{Text: slackNotificationText(n)}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.NotifyURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := p.HTTPClient
+	if client == nil {
+		client = notifyClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return errors.New("webhook returned status " + strconv.Itoa(resp.StatusCode))
+	}
+	return nil
+}
+
+// notifyClient delivers notifications when WatchPoller.HTTPClient is nil. It checks the address
+// it actually connects to, which also covers hostnames and redirects that resolve to internal
+// addresses.
+var notifyClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 10 * time.Second, Control: dialPublicOnly}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+}
+
+func dialPublicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("refusing to deliver a notification to non-public address %s", host)
+	}
+	return nil
+}
+
+// slackNotificationText renders a Slack mrkdwn message with the risk and the top breakers, or the
+// top findings of each section of a rollback.
+func slackNotificationText(n WatchNotification) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*New release* for <%s|%s>: `%s` (deployed: `%s`)\n", n.RepoUrl, strings.TrimPrefix(n.RepoUrl, "https://github.com/"), n.NewTag, n.CurrentVersion)
+	if n.Analysis == nil {
+		fmt.Fprintf(&b, "Analysis failed: %s", n.AnalysisError)
+		return b.String()
+	}
+
+	a := n.Analysis
+	fmt.Fprintf(&b, "Risk: *%s* (%d/100, confidence %s)\n", strings.ToUpper(a.Risk.Level), a.Risk.Score, a.Risk.Confidence)
+	for i, h := range a.Summary.Highlights {
+		if i == 3 {
+			break
+		}
+		fmt.Fprintf(&b, "• %s\n", markdownInline(h))
+	}
+	if rb := a.Rollback; rb != nil {
+		writeSlackRollbackChanges(&b, "Irreversible migrations", rb.IrreversibleMigrations)
+		writeSlackRollbackChanges(&b, "Data format changes", rb.DataFormatChanges)
+		writeSlackRollbackChanges(&b, "Removed features", rb.RemovedFeatures)
+	}
+	if len(a.Breakers) > 0 {
+		fmt.Fprintf(&b, "Breaking changes (%d):\n", len(a.Breakers))
+		for i, br := range a.Breakers {
+			if i == 5 {
+				fmt.Fprintf(&b, "• …and %d more\n", len(a.Breakers)-5)
+				break
+			}
+			fmt.Fprintf(&b, "• [%s] %s\n", br.Severity, markdownInline(br.Title))
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// writeSlackRollbackChanges lists the top findings of a rollback section like the breakers of an
+// upgrade.
+func writeSlackRollbackChanges(b *strings.Builder, title string, changes []RollbackChange) {
+	if len(changes) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "%s (%d):\n", title, len(changes))
+	for i, c := range changes {
+		if i == 5 {
+			fmt.Fprintf(b, "• …and %d more\n", len(changes)-5)
+			break
+		}
+		fmt.Fprintf(b, "• [%s] %s\n", c.Severity, markdownInline(c.Title))
+	}
+}
+
+// newestReleaseTag returns the highest semver tag above current that uses the same tag prefix
+// (e.g. "v" or "sub/dir/v"), or "" when there is none. Prereleases are skipped unless
+// includePrereleases is set.
+func newestReleaseTag(tags []string, current string, includePrereleases bool) string {
+	cur, ok := parseSemver(current)
+	if !ok {
+		return ""
+	}
+	prefix := versionTagPrefix(current)
+	best := ""
+	var bestVersion semver
+	for _, tag := range tags {
+		if versionTagPrefix(tag) != prefix {
+			continue
+		}
+		v, ok := parseSemver(tag)
+		if !ok || (!includePrereleases && len(v.Prerelease) > 0) {
+			continue
+		}
+		if compareSemver(v, cur) <= 0 {
+			continue
+		}
+		if best == "" || compareSemver(v, bestVersion) > 0 {
+			best, bestVersion = tag, v
+		}
+	}
+	return best
+}
+
+func versionTagPrefix(tag string) string {
+	if i := strings.IndexAny(tag, "0123456789"); i >= 0 {
+		return tag[:i]
+	}
+	return tag
+}
@@ -0,0 +1,367 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestWatchStorePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watches.json")
+
+	store, err := NewWatchStore(path)
+	if err != nil {
+		t.Fatalf("new store: %v", err)
+	}
+	created, err := store.Create(Watch{RepoUrl: "https://github.com/octo/hello", CurrentVersion: "v1.0.0"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := store.Update(created.ID, func(w *Watch) { w.LastNotifiedTag = "v1.1.0" }); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	reloaded, err := NewWatchStore(path)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	got, err := reloaded.Get(created.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.LastNotifiedTag != "v1.1.0" || got.RepoUrl != "https://github.com/octo/hello" {
+		t.Fatalf("unexpected reloaded watch %+v", got)
+	}
+
+	if err := reloaded.Delete(created.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := reloaded.Get(created.ID); err != ErrWatchNotFound {
+		t.Fatalf("expected ErrWatchNotFound, got %v", err)
+	}
+}
+
+func TestWatchesHandlerCRUD(t *testing.T) {
+	store, _ := NewWatchStore("")
+	handler := WatchesHandler(store, zap.NewNop())
+
+	body := `{"repoUrl":"https://github.com/octo/hello","currentVersion":"v1.0.0","notifyUrl":"https://hooks.example.com/x","notifyFormat":"slack"}`
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/watches", strings.NewReader(body)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+	var created Watch
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if created.ID == "" || created.Mode != "fast" || created.NotifyFormat != NotifyFormatSlack {
+		t.Fatalf("unexpected watch %+v", created)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPatch, "/watches/"+created.ID, strings.NewReader(`{"currentVersion":"v1.1.0"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if got, _ := store.Get(created.ID); got.CurrentVersion != "v1.1.0" {
+		t.Fatalf("expected updated version, got %q", got.CurrentVersion)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPatch, "/watches/"+created.ID, strings.NewReader(`{"mode":"slow"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+	if got, _ := store.Get(created.ID); got.Mode != "fast" {
+		t.Fatalf("expected invalid update to be discarded, got mode %q", got.Mode)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/watches", nil))
+	var list []Watch
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil || len(list) != 1 {
+		t.Fatalf("expected 1 watch, got %v (%v)", list, err)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/watches/"+created.ID, nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d", http.StatusNoContent, rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/watches/"+created.ID, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+	assertErrorJSON(t, rec.Body.Bytes())
+}
+
+func TestWatchesHandlerRejectsInvalidNotifyURL(t *testing.T) {
+	store, _ := NewWatchStore("")
+	handler := WatchesHandler(store, zap.NewNop())
+
+	for _, notifyURL := range []string{
+		"file:///etc/passwd",
+		"http://localhost:8080/hook",
+		"http://api.localhost/hook",
+		"http://127.0.0.1/hook",
+		"http://[::1]/hook",
+		"http://10.0.0.5/hook",
+		"http://192.168.1.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[fe80::1]/hook",
+		"http://0.0.0.0/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+	} {
+		body := `{"repoUrl":"https://github.com/octo/hello","currentVersion":"v1.0.0","notifyUrl":"` + notifyURL + `"}`
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/watches", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected status %d, got %d", notifyURL, http.StatusBadRequest, rec.Code)
+		}
+	}
+}
+
+func TestWatchesHandlerPutReplacesWatch(t *testing.T) {
+	store, _ := NewWatchStore("")
+	handler := WatchesHandler(store, zap.NewNop())
+	watch, _ := store.Create(Watch{
+		RepoUrl:            "https://github.com/octo/hello",
+		CurrentVersion:     "v1.0.0",
+		Mode:               "deep",
+		NotifyURL:          "https://hooks.example.com/x",
+		NotifyFormat:       NotifyFormatSlack,
+		IncludePrereleases: true,
+		LastNotifiedTag:    "v1.1.0",
+	})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/watches/"+watch.ID, strings.NewReader(`{"repoUrl":"https://github.com/octo/hello","notifyUrl":"https://hooks.example.com/y"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected a PUT without currentVersion to be rejected, got %d", rec.Code)
+	}
+
+	body := `{"repoUrl":"https://github.com/octo/hello","currentVersion":"v1.0.0","notifyUrl":"https://hooks.example.com/y"}`
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/watches/"+watch.ID, strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	got, _ := store.Get(watch.ID)
+	if got.Mode != "fast" || got.NotifyFormat != NotifyFormatJSON || got.IncludePrereleases || got.NotifyURL != "https://hooks.example.com/y" {
+		t.Fatalf("expected omitted fields to be reset, got %+v", got)
+	}
+	if got.LastNotifiedTag != "v1.1.0" || got.CreatedAt != watch.CreatedAt {
+		t.Fatalf("expected the poll state to survive the same version, got %+v", got)
+	}
+}
+
+func TestWatchesHandlerScopesWatchesToAPIKey(t *testing.T) {
+	store, _ := NewWatchStore("")
+	auth := newTestAPIKeyAuth(t,
+		APIKey{ID: "alice", Key: "alice-0123456789"},
+		APIKey{ID: "bob", Key: "bob-0123456789ab"},
+	)
+	handler := WithAPIKey(auth, WatchesHandler(store, zap.NewNop()))
+	serve := func(key, method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+key)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	body := `{"repoUrl":"https://github.com/octo/hello","currentVersion":"v1.0.0","notifyUrl":"https://hooks.slack.com/services/T0/B0/secret"}`
+	rec := serve("alice-0123456789", http.MethodPost, "/watches", body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), "secret") || strings.Contains(rec.Body.String(), "alice") {
+		t.Fatalf("expected the notify URL and owner to be redacted, got %s", rec.Body.String())
+	}
+	var created Watch
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if created.NotifyURL != "https://hooks.slack.com/…" {
+		t.Fatalf("unexpected redacted notify URL %q", created.NotifyURL)
+	}
+	if got, _ := store.Get(created.ID); got.Owner != "alice" || got.NotifyURL != "https://hooks.slack.com/services/T0/B0/secret" {
+		t.Fatalf("expected the stored watch to keep its owner and notify URL, got %+v", got)
+	}
+
+	rec = serve("bob-0123456789ab", http.MethodGet, "/watches", "")
+	if strings.TrimSpace(rec.Body.String()) != "[]" {
+		t.Fatalf("expected bob to see no watches, got %s", rec.Body.String())
+	}
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		rec = serve("bob-0123456789ab", method, "/watches/"+created.ID, body)
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("%s: expected status %d for another key's watch, got %d", method, http.StatusNotFound, rec.Code)
+		}
+	}
+	if got, err := store.Get(created.ID); err != nil || got.CurrentVersion != "v1.0.0" {
+		t.Fatalf("expected alice's watch to be untouched, got %+v (%v)", got, err)
+	}
+
+	rec = serve("alice-0123456789", http.MethodPut, "/watches/"+created.ID, body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if got, _ := store.Get(created.ID); got.Owner != "alice" {
+		t.Fatalf("expected PUT to keep the owner, got %q", got.Owner)
+	}
+	rec = serve("alice-0123456789", http.MethodGet, "/watches", "")
+	var list []Watch
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil || len(list) != 1 {
+		t.Fatalf("expected alice to see 1 watch, got %v (%v)", list, err)
+	}
+}
+
+func TestWatchPollerRefusesInternalNotifyAddress(t *testing.T) {
+	ghMux := http.NewServeMux()
+	ghMux.HandleFunc("/repos/octo/hello/tags", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"name":"v1.1.0"},{"name":"v1.0.0"}]`))
+	})
+	emptyCompareMux(ghMux, "octo", "hello", "v1.0.0", "v1.1.0")
+	ollama, _ := newOllamaTestServer(t, validModelResponse)
+
+	var delivered atomic.Int32
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered.Add(1)
+	}))
+	defer hook.Close()
+
+	store, _ := NewWatchStore("")
+	watch, _ := store.Create(Watch{
+		RepoUrl:        "https://github.com/octo/hello",
+		CurrentVersion: "v1.0.0",
+		Mode:           "fast",
+		NotifyURL:      hook.URL,
+		NotifyFormat:   NotifyFormatJSON,
+	})
+	poller := &WatchPoller{
+		Store:    store,
+		Analyzer: &Analyzer{GitHub: newGitHubTestClient(t, ghMux), OllamaBaseURL: ollama.URL, Logger: zap.NewNop()},
+		Logger:   zap.NewNop(),
+	}
+	poller.PollOnce(context.Background())
+
+	if delivered.Load() != 0 {
+		t.Fatalf("expected the loopback notifyUrl to be refused")
+	}
+	if got, _ := store.Get(watch.ID); got.LastNotifiedTag != "" || !strings.Contains(got.LastError, "non-public address") {
+		t.Fatalf("expected a delivery error, got %+v", got)
+	}
+}
+
+func TestWatchPollerNotifiesOnceAndUsesETag(t *testing.T) {
+	var tagRequests, notModified atomic.Int32
+	ghMux := http.NewServeMux()
+	ghMux.HandleFunc("/repos/octo/hello/tags", func(w http.ResponseWriter, r *http.Request) {
+		tagRequests.Add(1)
+		if r.Header.Get("If-None-Match") == `"tags-v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"tags-v1"`)
+		_, _ = w.Write([]byte(`[{"name":"v1.2.0-rc.1"},{"name":"v1.1.0"},{"name":"v1.0.0"},{"name":"other/v9.0.0"}]`))
+	})
+	emptyCompareMux(ghMux, "octo", "hello", "v1.0.0", "v1.1.0")
+	ghClient := newGitHubTestClient(t, ghMux)
+
+	ollama, _ := newOllamaTestServer(t, validModelResponse)
+
+	var notifications []map[string]any
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		notifications = append(notifications, payload)
+	}))
+	defer hook.Close()
+
+	store, _ := NewWatchStore("")
+	watch, _ := store.Create(Watch{
+		RepoUrl:        "https://github.com/octo/hello",
+		CurrentVersion: "v1.0.0",
+		Mode:           "fast",
+		NotifyURL:      hook.URL,
+		NotifyFormat:   NotifyFormatSlack,
+	})
+
+	poller := &WatchPoller{
+		Store:    store,
+		Analyzer: &Analyzer{GitHub: ghClient, OllamaBaseURL: ollama.URL, Logger: zap.NewNop()},
+		// The default client refuses the loopback test server.
+		HTTPClient: hook.Client(),
+		Logger:     zap.NewNop(),
+	}
+	poller.PollOnce(context.Background())
+	poller.PollOnce(context.Background())
+
+	if len(notifications) != 1 {
+		t.Fatalf("expected 1 notification, got %d", len(notifications))
+	}
+	text, _ := notifications[0]["text"].(string)
+	if !strings.Contains(text, "`v1.1.0`") || !strings.Contains(text, "Risk: *LOW*") {
+		t.Fatalf("unexpected slack text %q", text)
+	}
+	if notModified.Load() != 1 {
+		t.Fatalf("expected second poll to be a conditional 304, got %d of %d", notModified.Load(), tagRequests.Load())
+	}
+
+	got, _ := store.Get(watch.ID)
+	if got.LastNotifiedTag != "v1.1.0" || got.LastError != "" {
+		t.Fatalf("unexpected watch state %+v", got)
+	}
+}
+
+func TestNewestReleaseTag(t *testing.T) {
+	tags := []string{"v1.0.0", "v1.2.0-beta.1", "v1.1.5", "release-9.0.0", "junk"}
+	if got := newestReleaseTag(tags, "v1.0.0", false); got != "v1.1.5" {
+		t.Fatalf("expected v1.1.5, got %q", got)
+	}
+	if got := newestReleaseTag(tags, "v1.0.0", true); got != "v1.2.0-beta.1" {
+		t.Fatalf("expected v1.2.0-beta.1, got %q", got)
+	}
+	if got := newestReleaseTag(tags, "v1.1.5", false); got != "" {
+		t.Fatalf("expected no newer release, got %q", got)
+	}
+}
+
+func TestSlackNotificationTextListsRollbackFindings(t *testing.T) {
+	text := slackNotificationText(WatchNotification{
+		RepoUrl:        "https://github.com/octo/hello",
+		CurrentVersion: "v2.0.0",
+		NewTag:         "v1.0.0",
+		Analysis: &AnalyzeResponse{
+			Risk: RiskInfo{Level: "high", Score: 70},
+			Rollback: &RollbackInfo{
+				IrreversibleMigrations: []RollbackChange{{Title: "Drops legacy table", Severity: "high"}},
+				DataFormatChanges:      []RollbackChange{{Title: "Config v2", Severity: "medium"}},
+				RemovedFeatures:        []RollbackChange{{Title: "Bulk export", Severity: "low"}},
+			},
+		},
+	})
+	for _, want := range []string{
+		"Irreversible migrations (1):\n• [high] Drops legacy table",
+		"Data format changes (1):\n• [medium] Config v2",
+		"Removed features (1):\n• [low] Bulk export",
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("expected %q in %q", want, text)
+		}
+	}
+}